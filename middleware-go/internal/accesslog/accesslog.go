@@ -0,0 +1,99 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/logfile"
+)
+
+// Record 访问日志中的一条记录，每个代理请求输出一行JSON（JSONL）
+type Record struct {
+	Time                 time.Time `json:"time"`                // 请求开始时间（RFC 3339）
+	Method               string    `json:"method"`              // 客户端请求方法
+	Path                 string    `json:"path"`                // 客户端请求路径，不含查询参数
+	Status               int       `json:"status"`              // 返回给客户端的状态码
+	DurationMs           int64     `json:"duration_ms"`         // 中间层处理总耗时（含重试和响应体传输）
+	UpstreamLatencyMs    int64     `json:"upstream_latency_ms"` // 最后一次尝试从发出请求到收到上游响应头的耗时，未请求上游时为0
+	ClientID             string    `json:"client_id"`           // 客户端身份，不包含API Key本身
+	ClientName           string    `json:"client_name,omitempty"`
+	ClientTeam           string    `json:"client_team,omitempty"`
+	AccountID            string    `json:"account_id,omitempty"`             // 最后一次尝试使用的账户
+	Attempts             int       `json:"attempts"`                         // 请求上游的次数（含重试），未请求上游时为0
+	QueueWaitMs          int64     `json:"queue_wait_ms,omitempty"`          // 在准入队列中等待账户的时间
+	RequestBytes         int64     `json:"request_bytes"`                    // 请求体字节数
+	ResponseBytes        int64     `json:"response_bytes"`                   // 返回给客户端的响应体字节数
+	Model                string    `json:"model,omitempty"`                  // 请求体中的model
+	ServedModel          string    `json:"served_model,omitempty"`           // 账户池耗尽后实际使用的降级模型
+	EstimatedInputTokens int       `json:"estimated_input_tokens,omitempty"` // 本地估算的输入Token数（仅least_tokens策略）
+	Stream               bool      `json:"stream"`                           // 是否为流式请求
+	Hedge                string    `json:"hedge,omitempty"`                  // 发出对冲请求时实际使用的调用：primary、hedge 或 none（都失败）
+	Cache                string    `json:"cache,omitempty"`                  // 响应缓存结果：hit、miss 或 bypass
+	Coalesced            bool      `json:"coalesced,omitempty"`              // 是否直接使用了相同的进行中请求的响应
+	Usage                Usage     `json:"usage"`                            // 上游响应中的Token用量
+	Error                string    `json:"error,omitempty"`                  // 中间层自身返回错误时的原因
+}
+
+// Usage Token用量，OpenAI格式的 prompt_tokens/completion_tokens 分别计入输入/输出
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// Logger 将记录以JSONL格式写入标准输出或按大小轮转的文件
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	closer io.Closer
+}
+
+// New 根据配置创建Logger，未启用时返回nil（nil Logger的方法不做任何事）
+func New(cfg config.AccessLogConfig) (*Logger, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.Output == "stdout" {
+		return &Logger{out: os.Stdout}, nil
+	}
+
+	file, err := logfile.Open(cfg.Output, int64(cfg.MaxFileSize), cfg.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %w", err)
+	}
+	return &Logger{out: file, closer: file}, nil
+}
+
+// Write 写入一条记录
+func (l *Logger) Write(record *Record) {
+	if l == nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("⚠️  Failed to encode access log record: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		log.Printf("⚠️  Failed to write access log: %v", err)
+	}
+}
+
+// Close 关闭日志文件
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
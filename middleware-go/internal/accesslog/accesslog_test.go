@@ -0,0 +1,161 @@
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-middleware/internal/config"
+)
+
+// readLines 逐行解析JSONL文件
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func keys(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoggerWritesJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.jsonl")
+	logger, err := New(config.AccessLogConfig{Enabled: true, Output: path})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	full := &Record{
+		Time:                 time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC),
+		Method:               "POST",
+		Path:                 "/v1/messages",
+		Status:               200,
+		DurationMs:           5321,
+		UpstreamLatencyMs:    812,
+		ClientID:             "key_123",
+		ClientName:           "Search Bot",
+		ClientTeam:           "search",
+		AccountID:            "account_123",
+		Attempts:             2,
+		QueueWaitMs:          15,
+		RequestBytes:         2048,
+		ResponseBytes:        15872,
+		Model:                "claude-opus-4",
+		ServedModel:          "claude-sonnet-4",
+		EstimatedInputTokens: 900,
+		Stream:               true,
+		Hedge:                "hedge",
+		Cache:                "miss",
+		Coalesced:            true,
+		Usage:                Usage{InputTokens: 1024, OutputTokens: 512, CacheReadInputTokens: 256},
+		Error:                "all_accounts_rate_limited",
+	}
+	minimal := &Record{Method: "GET", Path: "/v1/models", Status: 200, ClientID: "anonymous"}
+	logger.Write(full)
+	logger.Write(minimal)
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	wantFull := []string{
+		"account_id", "attempts", "cache", "client_id", "client_name", "client_team", "coalesced", "duration_ms",
+		"error", "estimated_input_tokens", "hedge", "method", "model", "path", "queue_wait_ms", "request_bytes",
+		"response_bytes", "served_model", "status", "stream", "time", "upstream_latency_ms", "usage",
+	}
+	if got := keys(lines[0]); strings.Join(got, ",") != strings.Join(wantFull, ",") {
+		t.Errorf("full record fields = %v, want %v", got, wantFull)
+	}
+
+	// omitempty字段在未设置时不输出
+	wantMinimal := []string{
+		"attempts", "client_id", "duration_ms", "method", "path", "request_bytes", "response_bytes",
+		"status", "stream", "time", "upstream_latency_ms", "usage",
+	}
+	if got := keys(lines[1]); strings.Join(got, ",") != strings.Join(wantMinimal, ",") {
+		t.Errorf("minimal record fields = %v, want %v", got, wantMinimal)
+	}
+
+	if got := lines[0]["time"]; got != "2025-01-01T08:00:00Z" {
+		t.Errorf("time = %v, want RFC 3339", got)
+	}
+	usage, _ := lines[0]["usage"].(map[string]interface{})
+	wantUsage := []string{"cache_creation_input_tokens", "cache_read_input_tokens", "input_tokens", "output_tokens"}
+	if got := keys(usage); strings.Join(got, ",") != strings.Join(wantUsage, ",") {
+		t.Errorf("usage fields = %v, want %v", got, wantUsage)
+	}
+	if usage["input_tokens"] != float64(1024) || usage["cache_read_input_tokens"] != float64(256) {
+		t.Errorf("usage = %v", usage)
+	}
+}
+
+func TestLoggerRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.jsonl")
+	logger, err := New(config.AccessLogConfig{Enabled: true, Output: path, MaxFileSize: 700, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		logger.Write(&Record{Method: "POST", Path: "/v1/messages", Status: 200, ClientID: "key_123"})
+	}
+	logger.Close()
+
+	total := 0
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if info.Size() > 700 {
+			t.Errorf("%s is %d bytes, want at most 700", name, info.Size())
+		}
+		total += len(readLines(t, name))
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", path)
+	}
+	if total == 0 || total >= 10 {
+		t.Errorf("kept %d records across files, want some rotated away", total)
+	}
+}
+
+func TestDisabledLogger(t *testing.T) {
+	logger, err := New(config.AccessLogConfig{Enabled: false, Output: "/nonexistent/access.jsonl"})
+	if err != nil || logger != nil {
+		t.Fatalf("New(disabled) = %v, %v, want nil, nil", logger, err)
+	}
+	// nil Logger的方法不做任何事
+	logger.Write(&Record{})
+	if err := logger.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
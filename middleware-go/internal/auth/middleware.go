@@ -1,10 +1,12 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"net/http"
-	"os"
 	"strings"
 
+	"claude-middleware/internal/config"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,54 +18,52 @@ type AuthConfig struct {
 	APIKeys []string
 	// API Key 前缀
 	Prefix string
+	// 客户端证书Subject -> 客户端身份
+	ClientCerts map[string]string
+	// 管理API的Bearer Token，空表示禁用管理API
+	AdminToken string
 }
 
-// NewAuthConfig 创建认证配置
-func NewAuthConfig() *AuthConfig {
-	config := &AuthConfig{
-		Enabled: false, // 默认关闭，通过环境变量控制
-		Prefix:  "cr_", // 与Node.js服务保持一致
-	}
-
-	// 从环境变量读取配置
-	if os.Getenv("MIDDLEWARE_AUTH_ENABLED") == "true" {
-		config.Enabled = true
+// NewAuthConfig 根据配置创建认证配置
+func NewAuthConfig(cfg config.AuthConfig) *AuthConfig {
+	return &AuthConfig{
+		Enabled:     cfg.Enabled,
+		APIKeys:     cfg.APIKeys,
+		Prefix:      cfg.Prefix,
+		ClientCerts: cfg.ClientCerts,
+		AdminToken:  cfg.AdminToken,
 	}
-
-	// 从环境变量读取API Keys（逗号分隔）
-	if apiKeysEnv := os.Getenv("MIDDLEWARE_API_KEYS"); apiKeysEnv != "" {
-		config.APIKeys = strings.Split(apiKeysEnv, ",")
-		// 清理空白字符
-		for i, key := range config.APIKeys {
-			config.APIKeys[i] = strings.TrimSpace(key)
-		}
-	}
-
-	// 从环境变量读取前缀
-	if prefix := os.Getenv("MIDDLEWARE_API_KEY_PREFIX"); prefix != "" {
-		config.Prefix = prefix
-	}
-
-	return config
 }
 
 // AuthMiddleware API Key认证中间件
-func AuthMiddleware(config *AuthConfig) gin.HandlerFunc {
+// 每次请求通过current获取最新的认证配置，以支持热加载
+func AuthMiddleware(current func() *AuthConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		authConfig := current()
+
+		// 已校验的客户端证书映射到的身份与API Key等价
+		if identity := clientCertIdentity(c, authConfig.ClientCerts); identity != "" {
+			c.Set("authenticated", true)
+			c.Set("api_key", identity)
+			c.Set("auth_method", "client_cert")
+			c.Next()
+			return
+		}
+
 		// 如果认证未启用，直接通过
-		if !config.Enabled {
+		if !authConfig.Enabled {
 			c.Next()
 			return
 		}
 
-		// 如果没有配置API Keys，直接通过
-		if len(config.APIKeys) == 0 {
+		// 如果没有配置API Keys和客户端证书，直接通过
+		if len(authConfig.APIKeys) == 0 && len(authConfig.ClientCerts) == 0 {
 			c.Next()
 			return
 		}
 
 		// 获取API Key（支持多种Header格式）
-		apiKey := extractAPIKey(c)
+		apiKey := ExtractAPIKey(c)
 
 		if apiKey == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -75,7 +75,7 @@ func AuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 		}
 
 		// 基本格式验证
-		if !isValidAPIKeyFormat(apiKey, config.Prefix) {
+		if !isValidAPIKeyFormat(apiKey, authConfig.Prefix) {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error":   "Invalid API key format",
 				"message": "API key format is invalid",
@@ -85,7 +85,7 @@ func AuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 		}
 
 		// 验证API Key
-		if !validateAPIKey(apiKey, config.APIKeys) {
+		if !validateAPIKey(apiKey, authConfig.APIKeys) {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error":   "Invalid API key",
 				"message": "API key is invalid or expired",
@@ -98,12 +98,42 @@ func AuthMiddleware(config *AuthConfig) gin.HandlerFunc {
 		// 认证成功，继续处理
 		c.Set("authenticated", true)
 		c.Set("api_key", apiKey)
+		c.Set("auth_method", "api_key")
+		c.Next()
+	}
+}
+
+// AdminMiddleware 管理API认证中间件，要求 Authorization: Bearer <admin token>
+func AdminMiddleware(current func() *AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := current().AdminToken
+		if adminToken == "" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Admin API disabled",
+				"message": "Set MIDDLEWARE_ADMIN_TOKEN to enable the admin API",
+			})
+			c.Abort()
+			return
+		}
+
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid admin token",
+			})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
-// extractAPIKey 从请求中提取API Key
-func extractAPIKey(c *gin.Context) string {
+// CredentialHeaders 可能携带客户端凭证的请求头，转发到上游前需要全部删除
+var CredentialHeaders = []string{"x-api-key", "Authorization", "api-key", "x-goog-api-key"}
+
+// ExtractAPIKey 从请求中提取API Key
+func ExtractAPIKey(c *gin.Context) string {
 	// 尝试从 x-api-key 头获取
 	if apiKey := c.GetHeader("x-api-key"); apiKey != "" {
 		return apiKey
@@ -124,6 +154,19 @@ func extractAPIKey(c *gin.Context) string {
 	return ""
 }
 
+// clientCertIdentity 根据已校验的客户端证书查找客户端身份（优先匹配CN，其次匹配完整Subject）
+func clientCertIdentity(c *gin.Context, clientCerts map[string]string) string {
+	if len(clientCerts) == 0 || c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+
+	subject := c.Request.TLS.VerifiedChains[0][0].Subject
+	if identity, ok := clientCerts[subject.CommonName]; ok && subject.CommonName != "" {
+		return identity
+	}
+	return clientCerts[subject.String()]
+}
+
 // isValidAPIKeyFormat 检查API Key格式是否有效
 func isValidAPIKeyFormat(apiKey, prefix string) bool {
 	// 检查长度
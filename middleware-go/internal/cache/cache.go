@@ -0,0 +1,81 @@
+// Package cache 确定性请求的响应缓存，支持进程内LRU和Redis两种存储
+package cache
+
+import (
+	"log"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
+	"claude-middleware/internal/redis"
+)
+
+var cacheErrors = metrics.NewCounter("response_cache_errors_total",
+	"Number of response cache backend errors, by operation (get, set)", "op")
+
+// Entry 一条缓存的响应
+type Entry struct {
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	Model       string    `json:"model,omitempty"` // 实际应答的模型，降级后为降级模型
+	StoredAt    time.Time `json:"stored_at"`
+}
+
+// Age 条目已缓存的时间
+func (e *Entry) Age() time.Duration {
+	return time.Since(e.StoredAt)
+}
+
+// backend 缓存存储，过期由存储自身处理
+type backend interface {
+	get(key string) (*Entry, error)
+	set(key string, entry *Entry, ttl time.Duration) error
+}
+
+// Cache 响应缓存，未启用时为nil（nil Cache的方法不做任何事）
+type Cache struct {
+	ttl     time.Duration
+	backend backend
+}
+
+// New 根据配置创建响应缓存，未启用时返回nil
+func New(cfg config.CacheConfig, redisClient *redis.Client) *Cache {
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &Cache{ttl: cfg.TTL.Duration}
+	switch cfg.Backend {
+	case "redis":
+		c.backend = &redisBackend{client: redisClient, prefix: cfg.KeyPrefix}
+	default:
+		c.backend = newMemoryBackend(cfg.MaxEntries)
+	}
+	log.Printf("🗄️  Response cache enabled (backend: %s, ttl: %v)", cfg.Backend, c.ttl)
+	return c
+}
+
+// Get 读取未过期的缓存条目，存储出错时视为未命中
+func (c *Cache) Get(key string) (*Entry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	entry, err := c.backend.get(key)
+	if err != nil {
+		cacheErrors.Inc("get")
+		log.Printf("⚠️  Failed to read response cache: %v", err)
+		return nil, false
+	}
+	return entry, entry != nil
+}
+
+// Set 写入缓存条目，有效期为配置的TTL
+func (c *Cache) Set(key string, entry *Entry) {
+	if c == nil {
+		return
+	}
+	if err := c.backend.set(key, entry, c.ttl); err != nil {
+		cacheErrors.Inc("set")
+		log.Printf("⚠️  Failed to write response cache: %v", err)
+	}
+}
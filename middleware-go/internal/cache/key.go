@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// ignoredFields 不影响响应内容、不参与缓存键的顶层字段（Anthropic的metadata.user_id、OpenAI的user）
+var ignoredFields = []string{"metadata", "user"}
+
+// Request 参与缓存键计算的请求内容
+type Request struct {
+	Scope   string // 客户端范围，共享缓存时为空
+	Method  string
+	Path    string // 包含模型和流式标记（Gemini格式）
+	Query   string
+	Version string   // anthropic-version请求头
+	Betas   []string // anthropic-beta请求头（可以有多个，每个可以是逗号分隔的列表）
+	Body    []byte
+}
+
+// Key 计算请求的规范化哈希，并判断请求是否为确定性请求（temperature为0）
+//
+// 请求体按JSON解析后重新编码（对象的键按字母排序），字段顺序和空白不同的相同请求得到相同的键；
+// 模型、消息和所有参数（包括stream）都参与计算，anthropic-version和anthropic-beta会改变响应内容，同样参与计算
+// （beta列表排序后计算，顺序不同的相同列表得到相同的键）。请求体不是JSON对象时返回错误。
+func Key(r Request) (key string, deterministic bool, err error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(r.Body, &body); err != nil {
+		return "", false, err
+	}
+	for _, field := range ignoredFields {
+		delete(body, field)
+	}
+	canonical, err := json.Marshal(body)
+	if err != nil {
+		return "", false, err
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{r.Scope, r.Method, r.Path, r.Query, r.Version, normalizeBetas(r.Betas)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(canonical)
+	return hex.EncodeToString(hash.Sum(nil)), isDeterministic(body), nil
+}
+
+// normalizeBetas 拆分、去重并排序anthropic-beta的值
+func normalizeBetas(values []string) string {
+	seen := make(map[string]bool)
+	var betas []string
+	for _, value := range values {
+		for _, beta := range strings.Split(value, ",") {
+			if beta = strings.TrimSpace(beta); beta != "" && !seen[beta] {
+				seen[beta] = true
+				betas = append(betas, beta)
+			}
+		}
+	}
+	sort.Strings(betas)
+	return strings.Join(betas, ",")
+}
+
+// isDeterministic 请求是否指定了temperature为0
+// Anthropic/OpenAI格式在顶层，Gemini格式在generationConfig中
+func isDeterministic(body map[string]interface{}) bool {
+	if generation, ok := body["generationConfig"].(map[string]interface{}); ok {
+		body = generation
+	}
+	temperature, ok := body["temperature"].(float64)
+	return ok && temperature == 0
+}
@@ -0,0 +1,89 @@
+package cache
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	base := Request{
+		Scope:   "key_1",
+		Method:  "POST",
+		Path:    "/v1/messages",
+		Version: "2023-06-01",
+		Betas:   []string{"tools-2024-04-04", "prompt-caching-2024-07-31"},
+		Body:    []byte(`{"model":"claude-sonnet-4","temperature":0,"messages":[{"role":"user","content":"hi"}]}`),
+	}
+	baseKey, deterministic, err := Key(base)
+	if err != nil || !deterministic {
+		t.Fatalf("Key(base) = %q, %v, %v", baseKey, deterministic, err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *Request)
+		same   bool
+	}{
+		{"field order and whitespace", func(r *Request) {
+			r.Body = []byte(`{ "messages": [{"content":"hi","role":"user"}], "temperature": 0, "model": "claude-sonnet-4" }`)
+		}, true},
+		{"ignored metadata and user", func(r *Request) {
+			r.Body = []byte(`{"model":"claude-sonnet-4","temperature":0,"messages":[{"role":"user","content":"hi"}],"metadata":{"user_id":"u1"},"user":"u2"}`)
+		}, true},
+		{"beta order", func(r *Request) { r.Betas = []string{"prompt-caching-2024-07-31", "tools-2024-04-04"} }, true},
+		{"beta comma list", func(r *Request) { r.Betas = []string{" prompt-caching-2024-07-31 , tools-2024-04-04"} }, true},
+		{"beta duplicated", func(r *Request) { r.Betas = append(r.Betas, "tools-2024-04-04") }, true},
+		{"scope", func(r *Request) { r.Scope = "key_2" }, false},
+		{"method", func(r *Request) { r.Method = "PUT" }, false},
+		{"path", func(r *Request) { r.Path = "/api/v1/messages" }, false},
+		{"query", func(r *Request) { r.Query = "beta=true" }, false},
+		{"version", func(r *Request) { r.Version = "2024-01-01" }, false},
+		{"no version", func(r *Request) { r.Version = "" }, false},
+		{"beta", func(r *Request) { r.Betas = []string{"tools-2024-04-04"} }, false},
+		{"no beta", func(r *Request) { r.Betas = nil }, false},
+		{"model", func(r *Request) {
+			r.Body = []byte(`{"model":"claude-opus-4","temperature":0,"messages":[{"role":"user","content":"hi"}]}`)
+		}, false},
+		{"stream", func(r *Request) {
+			r.Body = []byte(`{"model":"claude-sonnet-4","temperature":0,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := base
+			r.Betas = append([]string(nil), base.Betas...)
+			tt.modify(&r)
+			key, _, err := Key(r)
+			if err != nil {
+				t.Fatalf("Key: %v", err)
+			}
+			if (key == baseKey) != tt.same {
+				t.Errorf("same key = %v, want %v", key == baseKey, tt.same)
+			}
+		})
+	}
+}
+
+func TestKeyDeterministic(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"temperature":0}`, true},
+		{`{"temperature":0.0}`, true},
+		{`{"temperature":0.5}`, false},
+		{`{}`, false},
+		{`{"generationConfig":{"temperature":0}}`, true},
+		{`{"generationConfig":{"topK":1},"temperature":0}`, false},
+	}
+	for _, tt := range tests {
+		if _, got, err := Key(Request{Body: []byte(tt.body)}); err != nil || got != tt.want {
+			t.Errorf("Key(%s) deterministic = %v, %v, want %v", tt.body, got, err, tt.want)
+		}
+	}
+}
+
+func TestKeyRejectsNonObject(t *testing.T) {
+	for _, body := range []string{``, `not json`, `[1,2]`} {
+		if _, _, err := Key(Request{Body: []byte(body)}); err == nil {
+			t.Errorf("Key(%q) error = nil", body)
+		}
+	}
+}
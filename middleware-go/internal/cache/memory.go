@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"claude-middleware/internal/metrics"
+)
+
+var memoryEntries = metrics.NewGauge("response_cache_entries",
+	"Number of responses held in the in-memory response cache")
+
+// memoryItem LRU链表中的一个条目
+type memoryItem struct {
+	key       string
+	entry     *Entry
+	expiresAt time.Time
+}
+
+// memoryBackend 进程内LRU缓存，超过maxEntries时淘汰最久未使用的条目
+type memoryBackend struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // 最近使用的在前
+	items      map[string]*list.Element
+}
+
+func newMemoryBackend(maxEntries int) *memoryBackend {
+	return &memoryBackend{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (m *memoryBackend) get(key string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*memoryItem)
+	if time.Now().After(item.expiresAt) {
+		m.remove(element)
+		return nil, nil
+	}
+	m.order.MoveToFront(element)
+	return item.entry, nil
+}
+
+func (m *memoryBackend) set(key string, entry *Entry, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := &memoryItem{key: key, entry: entry, expiresAt: time.Now().Add(ttl)}
+	if element, ok := m.items[key]; ok {
+		element.Value = item
+		m.order.MoveToFront(element)
+		return nil
+	}
+	m.items[key] = m.order.PushFront(item)
+	for m.order.Len() > m.maxEntries {
+		m.remove(m.order.Back())
+	}
+	memoryEntries.Set(float64(m.order.Len()))
+	return nil
+}
+
+// remove 删除条目，调用方需持有锁
+func (m *memoryBackend) remove(element *list.Element) {
+	m.order.Remove(element)
+	delete(m.items, element.Value.(*memoryItem).key)
+	memoryEntries.Set(float64(m.order.Len()))
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendEvictsLeastRecentlyUsed(t *testing.T) {
+	m := newMemoryBackend(2)
+	m.set("a", &Entry{Body: []byte("a")}, time.Minute)
+	m.set("b", &Entry{Body: []byte("b")}, time.Minute)
+
+	// 读取a后b成为最久未使用的条目
+	if entry, _ := m.get("a"); entry == nil {
+		t.Fatal("a missing")
+	}
+	m.set("c", &Entry{Body: []byte("c")}, time.Minute)
+
+	if entry, _ := m.get("b"); entry != nil {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if entry, _ := m.get(key); entry == nil || string(entry.Body) != key {
+			t.Errorf("get(%s) = %v", key, entry)
+		}
+	}
+	if m.order.Len() != 2 || len(m.items) != 2 {
+		t.Errorf("entries = %d/%d, want 2", m.order.Len(), len(m.items))
+	}
+}
+
+func TestMemoryBackendOverwrite(t *testing.T) {
+	m := newMemoryBackend(2)
+	m.set("a", &Entry{Body: []byte("old")}, time.Minute)
+	m.set("b", &Entry{Body: []byte("b")}, time.Minute)
+	m.set("a", &Entry{Body: []byte("new")}, time.Minute)
+	m.set("c", &Entry{Body: []byte("c")}, time.Minute)
+
+	if entry, _ := m.get("a"); entry == nil || string(entry.Body) != "new" {
+		t.Errorf("get(a) = %v, want new", entry)
+	}
+	if entry, _ := m.get("b"); entry != nil {
+		t.Error("b was not evicted after a was overwritten")
+	}
+}
+
+func TestMemoryBackendExpires(t *testing.T) {
+	m := newMemoryBackend(10)
+	m.set("short", &Entry{}, 10*time.Millisecond)
+	m.set("long", &Entry{}, time.Minute)
+
+	time.Sleep(20 * time.Millisecond)
+	if entry, _ := m.get("short"); entry != nil {
+		t.Error("expired entry returned")
+	}
+	if _, ok := m.items["short"]; ok {
+		t.Error("expired entry was not removed")
+	}
+	if entry, _ := m.get("long"); entry == nil {
+		t.Error("unexpired entry missing")
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	c.Set("key", &Entry{})
+	if _, ok := c.Get("key"); ok {
+		t.Error("nil cache returned an entry")
+	}
+}
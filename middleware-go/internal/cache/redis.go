@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"claude-middleware/internal/redis"
+)
+
+// redisBackend 使用Redis存储缓存条目（JSON），多个中间层实例可共享，过期由Redis的TTL处理
+type redisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+func (r *redisBackend) get(key string) (*Entry, error) {
+	data, err := r.client.GetCachedResponse(r.prefix + key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode cached response: %w", err)
+	}
+	return &entry, nil
+}
+
+func (r *redisBackend) set(key string, entry *Entry, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cached response: %w", err)
+	}
+	return r.client.SetCachedResponse(r.prefix+key, data, ttl)
+}
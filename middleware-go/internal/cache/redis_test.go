@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/redis"
+)
+
+func newRedisCache(t *testing.T) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client, err := redis.NewClient(config.RedisConfig{URL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	cfg := config.Defaults().Cache
+	cfg.Enabled = true
+	cfg.Backend = "redis"
+	cfg.TTL = config.Duration{Duration: time.Minute}
+	return New(cfg, client), server
+}
+
+func TestRedisBackendRoundTrip(t *testing.T) {
+	c, server := newRedisCache(t)
+	stream := []byte("event: message_start\ndata: {\"type\":\"message_start\"}\n\nevent: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	stored := &Entry{Status: 200, ContentType: "text/event-stream", Body: stream, Model: "claude-sonnet-4", StoredAt: time.Now()}
+	c.Set("abc", stored)
+
+	prefix := config.Defaults().Cache.KeyPrefix
+	if !server.Exists(prefix + "abc") {
+		t.Fatalf("key %q not stored, keys: %v", prefix+"abc", server.Keys())
+	}
+	if ttl := server.TTL(prefix + "abc"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+
+	entry, ok := c.Get("abc")
+	if !ok {
+		t.Fatal("entry not found")
+	}
+	if entry.Status != 200 || entry.ContentType != stored.ContentType || entry.Model != stored.Model ||
+		!bytes.Equal(entry.Body, stream) || !entry.StoredAt.Equal(stored.StoredAt) {
+		t.Errorf("entry = %+v, want %+v", entry, stored)
+	}
+}
+
+func TestRedisBackendExpires(t *testing.T) {
+	c, server := newRedisCache(t)
+	c.Set("abc", &Entry{Status: 200})
+
+	server.FastForward(2 * time.Minute)
+	if _, ok := c.Get("abc"); ok {
+		t.Error("expired entry returned")
+	}
+}
+
+func TestRedisBackendErrorsAreMisses(t *testing.T) {
+	c, server := newRedisCache(t)
+	server.Set(config.Defaults().Cache.KeyPrefix+"corrupt", "not json")
+	if _, ok := c.Get("corrupt"); ok {
+		t.Error("corrupt entry returned")
+	}
+
+	server.Close()
+	c.Set("abc", &Entry{Status: 200})
+	if _, ok := c.Get("abc"); ok {
+		t.Error("entry returned while Redis is down")
+	}
+}
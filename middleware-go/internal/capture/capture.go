@@ -0,0 +1,411 @@
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/logfile"
+)
+
+// redactedValue 隐藏后的头的值
+const redactedValue = "[REDACTED]"
+
+// Exchange 一次抓取的请求/响应
+type Exchange struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"duration_ms"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name,omitempty"`
+	AccountID  string    `json:"account_id,omitempty"`
+	Attempts   int       `json:"attempts"`
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+
+	requestHeader  http.Header
+	responseHeader http.Header
+	responseBody   *BodyBuffer
+}
+
+// Request 抓取的客户端请求，请求头为客户端原始请求头（已隐藏敏感头）
+type Request struct {
+	Method        string              `json:"method"`
+	Path          string              `json:"path"`
+	Query         string              `json:"query,omitempty"`
+	Headers       map[string][]string `json:"headers"`
+	Body          string              `json:"body"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+}
+
+// Response 返回给客户端的响应
+type Response struct {
+	Status        int                 `json:"status"`
+	Headers       map[string][]string `json:"headers,omitempty"`
+	Body          string              `json:"body"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	Events        []SSEEvent          `json:"events,omitempty"` // SSE响应拆分出的事件
+	Text          string              `json:"text,omitempty"`   // 从SSE增量事件拼接出的完整文本
+}
+
+// SetAttempt 记录当前尝试使用的账户，未抓取（nil）时不做任何事
+func (x *Exchange) SetAttempt(accountID string, attempt int) {
+	if x == nil {
+		return
+	}
+	x.AccountID = accountID
+	x.Attempts = attempt
+}
+
+// SetRequestBody 记录请求体，最多limit字节
+func (x *Exchange) SetRequestBody(r io.Reader, limit int) {
+	if x == nil {
+		return
+	}
+	buf := NewBodyBuffer(limit)
+	io.Copy(buf, r)
+	x.Request.Body = buf.String()
+	x.Request.BodyTruncated = buf.Truncated()
+}
+
+// ResponseWriter 记录上游响应头，返回用于同时记录响应体的Writer
+func (x *Exchange) ResponseWriter(w io.Writer, status int, header http.Header) io.Writer {
+	if x == nil {
+		return w
+	}
+	x.Response.Status = status
+	x.responseHeader = header.Clone()
+	return io.MultiWriter(w, x.responseBody)
+}
+
+// BodyBuffer 最多保存limit字节的Writer，超出部分丢弃但不报错
+type BodyBuffer struct {
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// NewBodyBuffer 创建BodyBuffer，limit为0表示不限制
+func NewBodyBuffer(limit int) *BodyBuffer {
+	return &BodyBuffer{limit: limit}
+}
+
+func (b *BodyBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 {
+		remaining := b.limit - b.buf.Len()
+		if remaining < len(p) {
+			b.truncated = true
+			if remaining > 0 {
+				b.buf.Write(p[:remaining])
+			}
+			return len(p), nil
+		}
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *BodyBuffer) Bytes() []byte   { return b.buf.Bytes() }
+func (b *BodyBuffer) String() string  { return b.buf.String() }
+func (b *BodyBuffer) Truncated() bool { return b.truncated }
+
+// Filter 抓取记录的筛选条件，空字段表示不筛选
+type Filter struct {
+	Client  string // 客户端ID或名称
+	Account string
+	Status  int
+}
+
+func (f Filter) match(x *Exchange) bool {
+	if f.Client != "" && f.Client != x.ClientID && f.Client != x.ClientName {
+		return false
+	}
+	if f.Account != "" && f.Account != x.AccountID {
+		return false
+	}
+	if f.Status != 0 && f.Status != x.Response.Status {
+		return false
+	}
+	return true
+}
+
+// Recorder 按采样率抓取请求/响应，保存到内存环形缓冲区或轮转文件
+type Recorder struct {
+	mu   sync.RWMutex
+	cfg  config.CaptureConfig
+	ring []*Exchange
+	next int
+	file *logfile.RotatingFile
+
+	seq atomic.Uint64
+}
+
+// NewRecorder 创建Recorder
+func NewRecorder(cfg config.CaptureConfig) *Recorder {
+	r := &Recorder{}
+	r.Configure(cfg)
+	return r
+}
+
+// Configure 应用新的抓取配置（热加载时调用），内存中已有的记录尽量保留
+func (r *Recorder) Configure(cfg config.CaptureConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fileChanged := !cfg.Enabled || cfg.Storage != "file" || cfg.File != r.cfg.File ||
+		cfg.MaxFileSize != r.cfg.MaxFileSize || cfg.MaxBackups != r.cfg.MaxBackups
+	if r.file != nil && fileChanged {
+		r.file.Close()
+		r.file = nil
+	}
+	if cfg.Enabled && cfg.Storage == "file" && r.file == nil {
+		file, err := logfile.Open(cfg.File, int64(cfg.MaxFileSize), cfg.MaxBackups)
+		if err != nil {
+			log.Printf("❌ Failed to open capture file, capture disabled: %v", err)
+			cfg.Enabled = false
+		}
+		r.file = file
+	}
+
+	if cfg.Storage == "memory" && cfg.RingSize != len(r.ring) {
+		r.ring = resizeRing(r.entries(), cfg.RingSize)
+		r.next = 0
+		if n := countEntries(r.ring); n < len(r.ring) {
+			r.next = n
+		}
+	}
+
+	if cfg.Enabled && !r.cfg.Enabled {
+		log.Printf("🔍 Request capture enabled (storage=%s, sample_rate=%v)", cfg.Storage, cfg.SampleRate)
+	}
+	r.cfg = cfg
+}
+
+// Sample 按采样率决定是否抓取当前请求，抓取时返回新的Exchange，否则返回nil
+func (r *Recorder) Sample(req *http.Request, clientID, clientName string) *Exchange {
+	r.mu.RLock()
+	cfg := r.cfg
+	r.mu.RUnlock()
+
+	if !cfg.Enabled || rand.Float64() >= cfg.SampleRate {
+		return nil
+	}
+	if len(cfg.Clients) > 0 && !contains(cfg.Clients, clientID) && !contains(cfg.Clients, clientName) {
+		return nil
+	}
+
+	return &Exchange{
+		ID:         strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(r.seq.Add(1), 36),
+		Time:       time.Now(),
+		ClientID:   clientID,
+		ClientName: clientName,
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  req.URL.RawQuery,
+		},
+		requestHeader: req.Header.Clone(),
+		responseBody:  NewBodyBuffer(cfg.MaxBodySize),
+	}
+}
+
+// MaxBodySize 每个请求体/响应体最多记录的字节数
+func (r *Recorder) MaxBodySize() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cfg.MaxBodySize
+}
+
+// Record 完成抓取并保存，status为最终返回给客户端的状态码
+func (r *Recorder) Record(x *Exchange, status int) {
+	if x == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := r.cfg
+	if !cfg.Enabled {
+		return
+	}
+	if len(cfg.Accounts) > 0 && !contains(cfg.Accounts, x.AccountID) {
+		return
+	}
+	if len(cfg.Statuses) > 0 && !containsInt(cfg.Statuses, status) {
+		return
+	}
+
+	x.DurationMs = time.Since(x.Time).Milliseconds()
+	x.Response.Status = status
+	x.Request.Headers = redact(x.requestHeader, cfg.RedactHeaders)
+	x.Response.Headers = redact(x.responseHeader, cfg.RedactHeaders)
+
+	body := x.responseBody.Bytes()
+	x.Response.BodyTruncated = x.responseBody.Truncated()
+	if x.responseHeader.Get("Content-Encoding") == "gzip" && !x.Response.BodyTruncated {
+		if decoded, err := gunzip(body); err == nil {
+			body = decoded
+		}
+	}
+	x.Response.Body = string(body)
+	if mediaType, _, _ := mime.ParseMediaType(x.responseHeader.Get("Content-Type")); mediaType == "text/event-stream" {
+		x.Response.Events, x.Response.Text = ParseSSE(body)
+	}
+	x.requestHeader, x.responseHeader, x.responseBody = nil, nil, nil
+
+	if cfg.Storage == "file" {
+		if r.file == nil {
+			return
+		}
+		line, err := json.Marshal(x)
+		if err != nil {
+			log.Printf("⚠️  Failed to encode capture %s: %v", x.ID, err)
+			return
+		}
+		if _, err := r.file.Write(append(line, '\n')); err != nil {
+			log.Printf("⚠️  Failed to write capture %s: %v", x.ID, err)
+		}
+		return
+	}
+
+	if len(r.ring) == 0 {
+		return
+	}
+	r.ring[r.next] = x
+	r.next = (r.next + 1) % len(r.ring)
+}
+
+// List 返回内存中符合条件的记录（新的在前），limit为0表示不限制
+func (r *Recorder) List(filter Filter, limit int) []*Exchange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := r.entries()
+	result := make([]*Exchange, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if filter.match(entries[i]) {
+			result = append(result, entries[i])
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Get 按ID查找内存中的记录
+func (r *Recorder) Get(id string) *Exchange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, x := range r.ring {
+		if x != nil && x.ID == id {
+			return x
+		}
+	}
+	return nil
+}
+
+// Clear 清空内存中的记录
+func (r *Recorder) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ring = make([]*Exchange, len(r.ring))
+	r.next = 0
+}
+
+// entries 按时间顺序（旧的在前）返回环形缓冲区中的记录，调用方需持有锁
+func (r *Recorder) entries() []*Exchange {
+	result := make([]*Exchange, 0, len(r.ring))
+	for i := range r.ring {
+		if x := r.ring[(r.next+i)%len(r.ring)]; x != nil {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// resizeRing 创建指定大小的环形缓冲区，保留最新的记录
+func resizeRing(entries []*Exchange, size int) []*Exchange {
+	if size <= 0 {
+		return nil
+	}
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	ring := make([]*Exchange, size)
+	copy(ring, entries)
+	return ring
+}
+
+func countEntries(ring []*Exchange) int {
+	n := 0
+	for _, x := range ring {
+		if x != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// redact 复制头并隐藏敏感头的值
+func redact(header http.Header, names []string) map[string][]string {
+	if header == nil {
+		return nil
+	}
+	result := make(map[string][]string, len(header))
+	for key, values := range header {
+		result[key] = values
+	}
+	for _, name := range names {
+		key := http.CanonicalHeaderKey(name)
+		if values, ok := result[key]; ok {
+			redacted := make([]string, len(values))
+			for i := range redacted {
+				redacted[i] = redactedValue
+			}
+			result[key] = redacted
+		}
+	}
+	return result
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package capture
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListHandler 查询内存中的抓取记录
+// GET /admin/captures?client=&account=&status=&limit=
+func (r *Recorder) ListHandler(c *gin.Context) {
+	status, _ := strconv.Atoi(c.Query("status"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	r.mu.RLock()
+	enabled, storage := r.cfg.Enabled, r.cfg.Storage
+	r.mu.RUnlock()
+
+	captures := r.List(Filter{
+		Client:  c.Query("client"),
+		Account: c.Query("account"),
+		Status:  status,
+	}, limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  enabled,
+		"storage":  storage,
+		"count":    len(captures),
+		"captures": captures,
+	})
+}
+
+// GetHandler 查询单条抓取记录
+// GET /admin/captures/:id
+func (r *Recorder) GetHandler(c *gin.Context) {
+	x := r.Get(c.Param("id"))
+	if x == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Capture not found"})
+		return
+	}
+	c.JSON(http.StatusOK, x)
+}
+
+// ClearHandler 清空内存中的抓取记录
+// DELETE /admin/captures
+func (r *Recorder) ClearHandler(c *gin.Context) {
+	r.Clear()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// SSEEvent SSE流中的一个事件
+type SSEEvent struct {
+	Event string `json:"event,omitempty"`
+	Data  string `json:"data"`
+}
+
+// sseDelta 增量事件中携带文本的字段（Anthropic content_block_delta 与 OpenAI chat.completion.chunk）
+type sseDelta struct {
+	Delta struct {
+		Text string `json:"text"`
+	} `json:"delta"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// ParseSSE 将SSE响应体拆分为事件，并拼接增量事件中的文本
+func ParseSSE(body []byte) ([]SSEEvent, string) {
+	var (
+		events  []SSEEvent
+		text    strings.Builder
+		current SSEEvent
+		data    []string
+	)
+
+	flush := func() {
+		if current.Event == "" && len(data) == 0 {
+			return
+		}
+		current.Data = strings.Join(data, "\n")
+		events = append(events, current)
+
+		var delta sseDelta
+		if json.Unmarshal([]byte(current.Data), &delta) == nil {
+			text.WriteString(delta.Delta.Text)
+			for _, choice := range delta.Choices {
+				text.WriteString(choice.Delta.Content)
+			}
+		}
+		current, data = SSEEvent{}, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, ":"):
+			// 注释行（如心跳）
+		case strings.HasPrefix(line, "event:"):
+			current.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	flush()
+
+	return events, text.String()
+}
@@ -1,64 +1,689 @@
 package config
 
 import (
-	"os"
-	"strconv"
+	"errors"
+	"fmt"
+	"time"
 )
 
 type Config struct {
-	Server ServerConfig
-	Redis  RedisConfig
-	Proxy  ProxyConfig
+	Server     ServerConfig     `yaml:"server" toml:"server"`
+	Redis      RedisConfig      `yaml:"redis" toml:"redis"`
+	Proxy      ProxyConfig      `yaml:"proxy" toml:"proxy"`
+	Auth       AuthConfig       `yaml:"auth" toml:"auth"`
+	SharedPool SharedPoolConfig `yaml:"shared_pool" toml:"shared_pool"`
+	Binding    BindingConfig    `yaml:"binding" toml:"binding"`
+	Selection  SelectionConfig  `yaml:"selection" toml:"selection"`
+	Cooldown   CooldownConfig   `yaml:"cooldown" toml:"cooldown"`
+	Retry      RetryConfig      `yaml:"retry" toml:"retry"`
+	Reload     ReloadConfig     `yaml:"reload" toml:"reload"`
+	Accounts   AccountsConfig   `yaml:"accounts" toml:"accounts"`
+	Headers    HeadersConfig    `yaml:"headers" toml:"headers"`
+	Capture    CaptureConfig    `yaml:"capture" toml:"capture"`
+	AccessLog  AccessLogConfig  `yaml:"access_log" toml:"access_log"`
+	Translate  TranslateConfig  `yaml:"translate" toml:"translate"`
+	Models     ModelsConfig     `yaml:"models" toml:"models"`
+	Fallback   FallbackConfig   `yaml:"fallback" toml:"fallback"`
+	Hedge      HedgeConfig      `yaml:"hedge" toml:"hedge"`
+	Queue      QueueConfig      `yaml:"queue" toml:"queue"`
+	Cache      CacheConfig      `yaml:"cache" toml:"cache"`
+	Coalesce   CoalesceConfig   `yaml:"coalesce" toml:"coalesce"`
 }
 
 type ServerConfig struct {
-	Port int
-	Mode string
+	Port  int             `yaml:"port" toml:"port"`
+	Mode  string          `yaml:"mode" toml:"mode"`
+	TLS   ServerTLSConfig `yaml:"tls" toml:"tls"`
+	HTTP2 bool            `yaml:"http2" toml:"http2"` // HTTPS监听时启用HTTP/2
+	H2C   bool            `yaml:"h2c" toml:"h2c"`     // 明文监听时启用HTTP/2（h2c）
+}
+
+// ServerTLSConfig HTTPS监听与客户端证书认证
+type ServerTLSConfig struct {
+	Enabled        bool     `yaml:"enabled" toml:"enabled"`
+	CertFile       string   `yaml:"cert_file" toml:"cert_file"`
+	KeyFile        string   `yaml:"key_file" toml:"key_file"`
+	ClientCAFile   string   `yaml:"client_ca_file" toml:"client_ca_file"`   // 校验客户端证书的CA
+	ClientAuth     string   `yaml:"client_auth" toml:"client_auth"`         // none、request、verify_if_given、require
+	ReloadInterval Duration `yaml:"reload_interval" toml:"reload_interval"` // 检查证书文件变化的间隔，0表示不自动重新加载
 }
 
 type RedisConfig struct {
-	Host     string
-	Port     int
-	Password string
-	DB       int
+	URL      string `yaml:"url" toml:"url"` // redis:// 或 rediss://，设置后覆盖host/port/password/db
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	Username string `yaml:"username" toml:"username"` // Redis 6+ ACL用户名
+	Password string `yaml:"password" toml:"password"`
+	DB       int    `yaml:"db" toml:"db"`
+
+	TLS RedisTLSConfig `yaml:"tls" toml:"tls"`
+
+	// Sentinel：设置主节点名称后通过Sentinel发现主节点
+	SentinelMaster   string   `yaml:"sentinel_master" toml:"sentinel_master"`
+	SentinelAddrs    []string `yaml:"sentinel_addrs" toml:"sentinel_addrs"`
+	SentinelUsername string   `yaml:"sentinel_username" toml:"sentinel_username"`
+	SentinelPassword string   `yaml:"sentinel_password" toml:"sentinel_password"`
+
+	// Cluster：设置节点地址后使用集群模式
+	ClusterAddrs []string `yaml:"cluster_addrs" toml:"cluster_addrs"`
+
+	PoolSize     int      `yaml:"pool_size" toml:"pool_size"` // 0表示使用go-redis默认值
+	MinIdleConns int      `yaml:"min_idle_conns" toml:"min_idle_conns"`
+	DialTimeout  Duration `yaml:"dial_timeout" toml:"dial_timeout"`
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout"`
+}
+
+// RedisTLSConfig Redis TLS配置
+type RedisTLSConfig struct {
+	Enabled            bool   `yaml:"enabled" toml:"enabled"`
+	CAFile             string `yaml:"ca_file" toml:"ca_file"`
+	CertFile           string `yaml:"cert_file" toml:"cert_file"` // 客户端证书（双向TLS）
+	KeyFile            string `yaml:"key_file" toml:"key_file"`
+	ServerName         string `yaml:"server_name" toml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
 }
 
 type ProxyConfig struct {
-	TargetURL string
-	Timeout   int // seconds
+	TargetURL string `yaml:"target_url" toml:"target_url"`
+	Timeout   int    `yaml:"timeout" toml:"timeout"` // seconds
+
+	// 请求体
+	MaxBodySize     int    `yaml:"max_body_size" toml:"max_body_size"`         // 字节，超过返回413，0表示不限制
+	BodyMemoryLimit int    `yaml:"body_memory_limit" toml:"body_memory_limit"` // 字节，超过后写入临时文件，0表示始终保存在内存
+	BodySpillDir    string `yaml:"body_spill_dir" toml:"body_spill_dir"`       // 临时文件目录，空表示系统临时目录
+
+	// 上游账户标识与签名
+	AccountHeader   string `yaml:"account_header" toml:"account_header"`     // 携带选中账户ID的请求头
+	SignatureHeader string `yaml:"signature_header" toml:"signature_header"` // 携带HMAC签名的请求头
+	SigningSecret   string `yaml:"signing_secret" toml:"signing_secret"`     // 与Node.js服务共享的签名密钥，空表示不签名
+	IdentityHeader  string `yaml:"identity_header" toml:"identity_header"`   // 携带客户端身份的请求头，空表示不转发
+
+	// 上游连接（到Node.js服务）
+	TLS                   UpstreamTLSConfig `yaml:"tls" toml:"tls"`
+	EgressProxy           string            `yaml:"egress_proxy" toml:"egress_proxy"` // http://、https:// 或 socks5://
+	MaxIdleConns          int               `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int               `yaml:"max_idle_conns_per_host" toml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int               `yaml:"max_conns_per_host" toml:"max_conns_per_host"` // 0表示不限制
+	IdleConnTimeout       Duration          `yaml:"idle_conn_timeout" toml:"idle_conn_timeout"`
+	KeepAlive             Duration          `yaml:"keep_alive" toml:"keep_alive"`
+	DialTimeout           Duration          `yaml:"dial_timeout" toml:"dial_timeout"`
+	TLSHandshakeTimeout   Duration          `yaml:"tls_handshake_timeout" toml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout Duration          `yaml:"response_header_timeout" toml:"response_header_timeout"` // 0表示不限制
+	HTTP2                 bool              `yaml:"http2" toml:"http2"`
+}
+
+// UpstreamTLSConfig 连接上游时使用的TLS配置
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"ca_file" toml:"ca_file"`     // 自定义CA证书
+	CertFile           string `yaml:"cert_file" toml:"cert_file"` // 客户端证书（到Node.js服务的双向TLS）
+	KeyFile            string `yaml:"key_file" toml:"key_file"`
+	ServerName         string `yaml:"server_name" toml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+}
+
+// AuthConfig 中间层API Key认证配置（可热加载）
+type AuthConfig struct {
+	Enabled     bool              `yaml:"enabled" toml:"enabled"`
+	APIKeys     []string          `yaml:"api_keys" toml:"api_keys"`
+	Prefix      string            `yaml:"prefix" toml:"prefix"`
+	ClientCerts map[string]string `yaml:"client_certs" toml:"client_certs"` // 客户端证书Subject（CN或完整DN） -> 客户端身份（与API Key等价使用）
+	ClientNames map[string]string `yaml:"client_names" toml:"client_names"` // API Key、Node.js API Key ID或证书身份 -> 客户端名称（覆盖Node.js中的名称）
+	ClientTeams map[string]string `yaml:"client_teams" toml:"client_teams"` // API Key、Node.js API Key ID或证书身份 -> 团队标签
+	AdminToken  string            `yaml:"admin_token" toml:"admin_token"`   // 管理API的Bearer Token，空表示禁用管理API
+}
+
+type SharedPoolConfig struct {
+	Enabled       bool     `yaml:"enabled" toml:"enabled"`
+	EncryptionKey string   `yaml:"encryption_key" toml:"encryption_key"` // 与Node.js服务的ENCRYPTION_KEY一致，用于计算API Key哈希
+	CacheTTL      Duration `yaml:"cache_ttl" toml:"cache_ttl"`           // API Key -> 共享池映射的缓存时间
+}
+
+type SelectionConfig struct {
+	Strategy          string   `yaml:"strategy" toml:"strategy"`                       // 未使用共享池时的选择策略：least_used、least_tokens、round_robin、random
+	TokenExpiryWindow Duration `yaml:"token_expiry_window" toml:"token_expiry_window"` // OAuth Token在此时间内过期的账户降低优先级
+
+	MaxConcurrency     int            `yaml:"max_concurrency" toml:"max_concurrency"`         // 每个账户同时处理的最大请求数，0表示不限制
+	AccountConcurrency map[string]int `yaml:"account_concurrency" toml:"account_concurrency"` // 账户ID -> 单独设置的最大并发数（0表示不限制）
+
+	TokenWindow Duration `yaml:"token_window" toml:"token_window"` // least_tokens策略统计每个账户估算输入Token的时间窗口
+}
+
+type BindingConfig struct {
+	Bindings        map[string][]string `yaml:"bindings" toml:"bindings"`                   // API Key或API Key ID -> 专属账户ID
+	UseNodeBindings bool                `yaml:"use_node_bindings" toml:"use_node_bindings"` // 是否读取Node.js API Key的claudeAccountId绑定
+	FallbackPolicy  string              `yaml:"fallback_policy" toml:"fallback_policy"`     // 专属账户不可用时：shared（回退共享池）或 reject（返回503）
+}
+
+// CooldownConfig 账户出错后的冷却时长
+type CooldownConfig struct {
+	RateLimit    Duration `yaml:"rate_limit" toml:"rate_limit"`       // 429限流
+	AuthError    Duration `yaml:"auth_error" toml:"auth_error"`       // 401/403
+	ServerError  Duration `yaml:"server_error" toml:"server_error"`   // 5xx
+	NetworkError Duration `yaml:"network_error" toml:"network_error"` // 网络错误等
+}
+
+// RetryConfig 换账户重试策略
+type RetryConfig struct {
+	MaxAttempts int   `yaml:"max_attempts" toml:"max_attempts"` // 包含首次请求在内的最大尝试次数
+	Statuses    []int `yaml:"statuses" toml:"statuses"`         // 触发换账户重试的状态码
+}
+
+// ReloadConfig 配置文件热加载
+type ReloadConfig struct {
+	WatchInterval Duration `yaml:"watch_interval" toml:"watch_interval"` // 检查配置文件变化的间隔，0表示只响应SIGHUP
 }
 
-func Load() *Config {
+// AccountsConfig 账户数据刷新与Redis故障降级
+type AccountsConfig struct {
+	RefreshInterval     Duration `yaml:"refresh_interval" toml:"refresh_interval"`
+	SnapshotFile        string   `yaml:"snapshot_file" toml:"snapshot_file"`                 // 最近一次成功加载的账户快照，空表示不持久化
+	MaxStaleness        Duration `yaml:"max_staleness" toml:"max_staleness"`                 // Redis不可用时允许使用的最旧账户数据，0表示不限制
+	ReconnectMinBackoff Duration `yaml:"reconnect_min_backoff" toml:"reconnect_min_backoff"` // Redis重连的初始退避时间
+	ReconnectMaxBackoff Duration `yaml:"reconnect_max_backoff" toml:"reconnect_max_backoff"` // Redis重连的最大退避时间
+}
+
+// HeadersConfig 转发时的请求头与响应头处理
+type HeadersConfig struct {
+	Forwarded bool         `yaml:"forwarded" toml:"forwarded"` // 注入X-Forwarded-For/Proto/Host
+	Rules     []HeaderRule `yaml:"rules" toml:"rules"`         // 按顺序执行所有匹配的规则
+}
+
+// HeaderRule 按路由匹配的请求头/响应头改写规则
+type HeaderRule struct {
+	PathPrefix string        `yaml:"path_prefix" toml:"path_prefix"` // 客户端请求路径前缀，空表示所有路由
+	Request    HeaderActions `yaml:"request" toml:"request"`         // 发往Node.js服务的请求头
+	Response   HeaderActions `yaml:"response" toml:"response"`       // 返回客户端的响应头
+}
+
+// HeaderActions 依次执行删除、改写、设置、追加
+type HeaderActions struct {
+	Remove  []string          `yaml:"remove" toml:"remove"` // 支持 "X-Internal-*" 前缀匹配
+	Rewrite []HeaderRewrite   `yaml:"rewrite" toml:"rewrite"`
+	Set     map[string]string `yaml:"set" toml:"set"`
+	Add     map[string]string `yaml:"add" toml:"add"`
+}
+
+// HeaderRewrite 使用正则表达式改写已有的头
+type HeaderRewrite struct {
+	Name        string `yaml:"name" toml:"name"`
+	Pattern     string `yaml:"pattern" toml:"pattern"`
+	Replacement string `yaml:"replacement" toml:"replacement"` // 支持 $1 等分组引用
+}
+
+// CaptureConfig 调试用的请求/响应抓取（默认关闭）
+type CaptureConfig struct {
+	Enabled       bool     `yaml:"enabled" toml:"enabled"`
+	SampleRate    float64  `yaml:"sample_rate" toml:"sample_rate"`       // 抓取比例，0-1
+	Storage       string   `yaml:"storage" toml:"storage"`               // memory（管理API查询）或 file（JSONL文件）
+	RingSize      int      `yaml:"ring_size" toml:"ring_size"`           // memory模式下保留的最近记录数
+	File          string   `yaml:"file" toml:"file"`                     // file模式下的文件路径
+	MaxFileSize   int      `yaml:"max_file_size" toml:"max_file_size"`   // 字节，超过后轮转
+	MaxBackups    int      `yaml:"max_backups" toml:"max_backups"`       // 保留的轮转文件数
+	MaxBodySize   int      `yaml:"max_body_size" toml:"max_body_size"`   // 每个请求体/响应体最多记录的字节数
+	RedactHeaders []string `yaml:"redact_headers" toml:"redact_headers"` // 记录时隐藏值的头
+	Clients       []string `yaml:"clients" toml:"clients"`               // 只抓取这些客户端（ID或名称），空表示全部
+	Accounts      []string `yaml:"accounts" toml:"accounts"`             // 只抓取这些账户，空表示全部
+	Statuses      []int    `yaml:"statuses" toml:"statuses"`             // 只抓取这些响应状态码，空表示全部
+}
+
+// AccessLogConfig JSONL格式的访问日志
+type AccessLogConfig struct {
+	Enabled     bool   `yaml:"enabled" toml:"enabled"`
+	Output      string `yaml:"output" toml:"output"`               // stdout 或文件路径
+	MaxFileSize int    `yaml:"max_file_size" toml:"max_file_size"` // 字节，超过后轮转，0表示不轮转
+	MaxBackups  int    `yaml:"max_backups" toml:"max_backups"`     // 保留的轮转文件数
+}
+
+// TranslateConfig 请求/响应格式转换
+type TranslateConfig struct {
+	OpenAI           bool   `yaml:"openai" toml:"openai"`                         // 在中间件内将OpenAI chat/completions转换为Anthropic Messages
+	MessagesPath     string `yaml:"messages_path" toml:"messages_path"`           // 转换后请求的上游Messages路径
+	DefaultMaxTokens int    `yaml:"default_max_tokens" toml:"default_max_tokens"` // 请求未指定max_tokens时使用
+
+	// Anthropic Messages ↔ Gemini generateContent
+	Gemini       bool     `yaml:"gemini" toml:"gemini"`
+	GeminiModels []string `yaml:"gemini_models" toml:"gemini_models"` // 由Gemini格式上游提供的模型前缀
+	GeminiPath   string   `yaml:"gemini_path" toml:"gemini_path"`     // Gemini上游路径模板，{model}和{method}会被替换
+}
+
+// FallbackConfig 账户池耗尽时按模型降级
+type FallbackConfig struct {
+	Enabled     bool                `yaml:"enabled" toml:"enabled"`
+	Chains      map[string][]string `yaml:"chains" toml:"chains"`             // 请求的模型 -> 依次尝试的降级模型
+	ModelHeader string              `yaml:"model_header" toml:"model_header"` // 返回实际响应模型的响应头
+}
+
+// HedgeConfig 非流式请求的对冲：首个账户在延迟内未返回响应头时，用第二个账户发送同一请求
+type HedgeConfig struct {
+	Enabled     bool     `yaml:"enabled" toml:"enabled"`
+	Clients     []string `yaml:"clients" toml:"clients"`             // 启用对冲的API Key、Key ID或客户端名称，空表示全部
+	Percentile  float64  `yaml:"percentile" toml:"percentile"`       // 按该模型最近响应头耗时的百分位数确定对冲延迟，0-1
+	MinDelay    Duration `yaml:"min_delay" toml:"min_delay"`         // 对冲延迟下限
+	MaxDelay    Duration `yaml:"max_delay" toml:"max_delay"`         // 对冲延迟上限，样本不足时使用
+	MinSamples  int      `yaml:"min_samples" toml:"min_samples"`     // 计算百分位数至少需要的样本数
+	Window      int      `yaml:"window" toml:"window"`               // 每个模型保留的最近样本数
+	MaxBodySize int      `yaml:"max_body_size" toml:"max_body_size"` // 只对冲不超过此大小（字节）的请求，0表示不限制
+}
+
+// QueueConfig 没有可用账户时的准入排队（按客户端公平调度）
+type QueueConfig struct {
+	Enabled      bool     `yaml:"enabled" toml:"enabled"`
+	MaxWait      Duration `yaml:"max_wait" toml:"max_wait"`             // 最长排队时间，超过后返回503
+	MaxDepth     int      `yaml:"max_depth" toml:"max_depth"`           // 排队请求总数上限
+	MaxPerClient int      `yaml:"max_per_client" toml:"max_per_client"` // 每个客户端排队请求数上限
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"`   // 检查账户冷却是否结束的间隔
+}
+
+// CacheConfig 确定性请求的响应缓存（默认关闭）
+type CacheConfig struct {
+	Enabled           bool     `yaml:"enabled" toml:"enabled"`
+	Backend           string   `yaml:"backend" toml:"backend"`                       // memory（进程内LRU）或 redis
+	TTL               Duration `yaml:"ttl" toml:"ttl"`                               // 缓存条目的有效期
+	MaxEntries        int      `yaml:"max_entries" toml:"max_entries"`               // memory模式下最多保留的条目数，超过后淘汰最久未使用的
+	MaxBodySize       int      `yaml:"max_body_size" toml:"max_body_size"`           // 只缓存不超过此大小（字节）的响应体
+	Routes            []string `yaml:"routes" toml:"routes"`                         // 启用缓存的客户端请求路径前缀
+	Clients           []string `yaml:"clients" toml:"clients"`                       // 启用缓存的API Key、Key ID或客户端名称，空表示全部
+	Shared            bool     `yaml:"shared" toml:"shared"`                         // 不同客户端之间共享缓存，默认每个客户端独立
+	DeterministicOnly bool     `yaml:"deterministic_only" toml:"deterministic_only"` // 只缓存temperature为0的请求
+	KeyPrefix         string   `yaml:"key_prefix" toml:"key_prefix"`                 // redis模式下的键前缀
+	StatusHeader      string   `yaml:"status_header" toml:"status_header"`           // 返回缓存结果（HIT、MISS、BYPASS）的响应头
+}
+
+// CoalesceConfig 合并同一客户端相同的进行中非流式请求，只请求一次上游
+type CoalesceConfig struct {
+	Enabled           bool     `yaml:"enabled" toml:"enabled"`
+	Routes            []string `yaml:"routes" toml:"routes"`                         // 启用合并的客户端请求路径前缀
+	DeterministicOnly bool     `yaml:"deterministic_only" toml:"deterministic_only"` // 只合并temperature为0的请求
+	MaxResponseSize   int      `yaml:"max_response_size" toml:"max_response_size"`   // 响应体超过此大小（字节）时等待的请求各自请求上游
+}
+
+// ModelsConfig 中间层合成的模型列表（/v1/models）
+type ModelsConfig struct {
+	Enabled       bool                `yaml:"enabled" toml:"enabled"`
+	Registry      []ModelInfo         `yaml:"registry" toml:"registry"`
+	Allowed       map[string][]string `yaml:"allowed" toml:"allowed"`                 // API Key或API Key ID -> 允许的模型，未配置的Key可见全部模型
+	UseNodeLimits bool                `yaml:"use_node_limits" toml:"use_node_limits"` // 是否排除Node.js API Key的restrictedModels
+}
+
+// ModelInfo 模型列表中的一个模型
+type ModelInfo struct {
+	ID          string `yaml:"id" toml:"id"`
+	DisplayName string `yaml:"display_name" toml:"display_name"`
+	OwnedBy     string `yaml:"owned_by" toml:"owned_by"` // anthropic、google 等
+	Created     string `yaml:"created" toml:"created"`   // 发布日期，如 2025-05-14
+}
+
+// Duration 支持 "30s"、"1h" 形式的时长配置
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText 解析时长字符串（YAML/TOML共用）
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", string(text), err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalText 输出时长字符串
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Defaults 返回默认配置
+func Defaults() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnvInt("PORT", 8080),
-			Mode: getEnv("GIN_MODE", "debug"),
+			Port:  8080,
+			Mode:  "debug",
+			HTTP2: true,
+			TLS: ServerTLSConfig{
+				ClientAuth:     "none",
+				ReloadInterval: Duration{time.Minute},
+			},
 		},
 		Redis: RedisConfig{
-			Host:     getEnv("REDIS_HOST", "localhost"),
-			Port:     getEnvInt("REDIS_PORT", 6379),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       getEnvInt("REDIS_DB", 0),
+			Host:         "localhost",
+			Port:         6379,
+			DialTimeout:  Duration{5 * time.Second},
+			ReadTimeout:  Duration{3 * time.Second},
+			WriteTimeout: Duration{3 * time.Second},
 		},
 		Proxy: ProxyConfig{
-			TargetURL: getEnv("TARGET_URL", "http://localhost:3001"),
-			Timeout:   getEnvInt("PROXY_TIMEOUT", 300),
+			TargetURL:           "http://localhost:3001",
+			Timeout:             300,
+			MaxBodySize:         32 << 20,
+			BodyMemoryLimit:     1 << 20,
+			AccountHeader:       "x-api-key",
+			SignatureHeader:     "X-Middleware-Signature",
+			IdentityHeader:      "X-Middleware-Client",
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     Duration{90 * time.Second},
+			KeepAlive:           Duration{30 * time.Second},
+			DialTimeout:         Duration{30 * time.Second},
+			TLSHandshakeTimeout: Duration{10 * time.Second},
+			HTTP2:               true,
+		},
+		Auth: AuthConfig{
+			Prefix: "cr_", // 与Node.js服务保持一致
+		},
+		SharedPool: SharedPoolConfig{
+			Enabled:  true,
+			CacheTTL: Duration{time.Minute},
+		},
+		Binding: BindingConfig{
+			Bindings:        map[string][]string{},
+			UseNodeBindings: true,
+			FallbackPolicy:  "shared",
+		},
+		Selection: SelectionConfig{
+			Strategy:           "least_used",
+			TokenExpiryWindow:  Duration{5 * time.Minute},
+			AccountConcurrency: map[string]int{},
+			TokenWindow:        Duration{time.Minute},
+		},
+		Cooldown: CooldownConfig{
+			RateLimit:    Duration{time.Hour},
+			AuthError:    Duration{30 * time.Minute},
+			ServerError:  Duration{10 * time.Minute},
+			NetworkError: Duration{5 * time.Minute},
+		},
+		Retry: RetryConfig{
+			MaxAttempts: 2,
+			Statuses:    []int{401, 403, 429, 500, 502, 503, 504},
+		},
+		Reload: ReloadConfig{
+			WatchInterval: Duration{5 * time.Second},
+		},
+		Accounts: AccountsConfig{
+			RefreshInterval:     Duration{30 * time.Second},
+			MaxStaleness:        Duration{24 * time.Hour},
+			ReconnectMinBackoff: Duration{time.Second},
+			ReconnectMaxBackoff: Duration{30 * time.Second},
+		},
+		Headers: HeadersConfig{
+			Forwarded: true,
+		},
+		AccessLog: AccessLogConfig{
+			Output:      "stdout",
+			MaxFileSize: 100 << 20,
+			MaxBackups:  5,
+		},
+		Fallback: FallbackConfig{
+			Chains:      map[string][]string{},
+			ModelHeader: "X-Middleware-Model",
+		},
+		Hedge: HedgeConfig{
+			Percentile:  0.95,
+			MinDelay:    Duration{500 * time.Millisecond},
+			MaxDelay:    Duration{10 * time.Second},
+			MinSamples:  20,
+			Window:      200,
+			MaxBodySize: 32 << 10,
+		},
+		Queue: QueueConfig{
+			MaxWait:      Duration{30 * time.Second},
+			MaxDepth:     1000,
+			MaxPerClient: 100,
+			PollInterval: Duration{time.Second},
+		},
+		Cache: CacheConfig{
+			Backend:     "memory",
+			TTL:         Duration{10 * time.Minute},
+			MaxEntries:  1000,
+			MaxBodySize: 1 << 20,
+			Routes: []string{
+				"/v1/messages",
+				"/api/v1/messages",
+				"/claude/v1/messages",
+				"/openai/claude/v1/chat/completions",
+				"/gemini/",
+			},
+			DeterministicOnly: true,
+			KeyPrefix:         "claude_middleware:response_cache:",
+			StatusHeader:      "X-Middleware-Cache",
+		},
+		Coalesce: CoalesceConfig{
+			Routes: []string{
+				"/v1/messages",
+				"/api/v1/messages",
+				"/claude/v1/messages",
+				"/openai/claude/v1/chat/completions",
+				"/gemini/",
+			},
+			DeterministicOnly: true,
+			MaxResponseSize:   1 << 20,
+		},
+		Models: ModelsConfig{
+			Registry: []ModelInfo{
+				{ID: "claude-opus-4-20250514", DisplayName: "Claude Opus 4", OwnedBy: "anthropic", Created: "2025-05-14"},
+				{ID: "claude-sonnet-4-20250514", DisplayName: "Claude Sonnet 4", OwnedBy: "anthropic", Created: "2025-05-14"},
+			},
+			Allowed:       map[string][]string{},
+			UseNodeLimits: true,
+		},
+		Translate: TranslateConfig{
+			MessagesPath:     "/v1/messages",
+			DefaultMaxTokens: 4096,
+			GeminiModels:     []string{"gemini-"},
+			GeminiPath:       "/gemini/v1beta/models/{model}:{method}",
+		},
+		Capture: CaptureConfig{
+			SampleRate:  1,
+			Storage:     "memory",
+			RingSize:    200,
+			File:        "logs/capture.jsonl",
+			MaxFileSize: 100 << 20,
+			MaxBackups:  3,
+			MaxBodySize: 64 << 10,
+			RedactHeaders: []string{
+				"Authorization", "Proxy-Authorization", "x-api-key", "api-key", "x-goog-api-key",
+				"Cookie", "Set-Cookie", "X-Middleware-Signature",
+			},
 		},
 	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// Load 加载配置：默认值 → 配置文件（可选） → 环境变量覆盖
+// 返回的错误汇总了所有无效的配置项
+func Load(path string) (*Config, error) {
+	cfg := Defaults()
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	envErr := applyEnv(cfg)
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return nil, err
 	}
-	return defaultValue
+	return cfg, nil
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
+// applyEnv 使用环境变量覆盖配置，未设置的变量保持原值
+func applyEnv(cfg *Config) error {
+	env := &envReader{}
+
+	cfg.Server.Port = env.Int("PORT", cfg.Server.Port)
+	cfg.Server.Mode = env.String("GIN_MODE", cfg.Server.Mode)
+	cfg.Server.HTTP2 = env.Bool("HTTP2_ENABLED", cfg.Server.HTTP2)
+	cfg.Server.H2C = env.Bool("H2C_ENABLED", cfg.Server.H2C)
+	cfg.Server.TLS.Enabled = env.Bool("TLS_ENABLED", cfg.Server.TLS.Enabled)
+	cfg.Server.TLS.CertFile = env.String("TLS_CERT_FILE", cfg.Server.TLS.CertFile)
+	cfg.Server.TLS.KeyFile = env.String("TLS_KEY_FILE", cfg.Server.TLS.KeyFile)
+	cfg.Server.TLS.ClientCAFile = env.String("TLS_CLIENT_CA_FILE", cfg.Server.TLS.ClientCAFile)
+	cfg.Server.TLS.ClientAuth = env.String("TLS_CLIENT_AUTH", cfg.Server.TLS.ClientAuth)
+	cfg.Server.TLS.ReloadInterval = env.Duration("TLS_RELOAD_INTERVAL", cfg.Server.TLS.ReloadInterval)
+
+	cfg.Redis.Host = env.String("REDIS_HOST", cfg.Redis.Host)
+	cfg.Redis.Port = env.Int("REDIS_PORT", cfg.Redis.Port)
+	cfg.Redis.Password = env.String("REDIS_PASSWORD", cfg.Redis.Password)
+	cfg.Redis.DB = env.Int("REDIS_DB", cfg.Redis.DB)
+	cfg.Redis.URL = env.String("REDIS_URL", cfg.Redis.URL)
+	cfg.Redis.Username = env.String("REDIS_USERNAME", cfg.Redis.Username)
+	cfg.Redis.TLS.Enabled = env.Bool("REDIS_TLS", cfg.Redis.TLS.Enabled)
+	cfg.Redis.TLS.CAFile = env.String("REDIS_TLS_CA_FILE", cfg.Redis.TLS.CAFile)
+	cfg.Redis.TLS.CertFile = env.String("REDIS_TLS_CERT_FILE", cfg.Redis.TLS.CertFile)
+	cfg.Redis.TLS.KeyFile = env.String("REDIS_TLS_KEY_FILE", cfg.Redis.TLS.KeyFile)
+	cfg.Redis.TLS.ServerName = env.String("REDIS_TLS_SERVER_NAME", cfg.Redis.TLS.ServerName)
+	cfg.Redis.TLS.InsecureSkipVerify = env.Bool("REDIS_TLS_INSECURE_SKIP_VERIFY", cfg.Redis.TLS.InsecureSkipVerify)
+	cfg.Redis.SentinelMaster = env.String("REDIS_SENTINEL_MASTER", cfg.Redis.SentinelMaster)
+	cfg.Redis.SentinelAddrs = env.List("REDIS_SENTINEL_ADDRS", cfg.Redis.SentinelAddrs)
+	cfg.Redis.SentinelUsername = env.String("REDIS_SENTINEL_USERNAME", cfg.Redis.SentinelUsername)
+	cfg.Redis.SentinelPassword = env.String("REDIS_SENTINEL_PASSWORD", cfg.Redis.SentinelPassword)
+	cfg.Redis.ClusterAddrs = env.List("REDIS_CLUSTER_ADDRS", cfg.Redis.ClusterAddrs)
+	cfg.Redis.PoolSize = env.Int("REDIS_POOL_SIZE", cfg.Redis.PoolSize)
+	cfg.Redis.MinIdleConns = env.Int("REDIS_MIN_IDLE_CONNS", cfg.Redis.MinIdleConns)
+	cfg.Redis.DialTimeout = env.Duration("REDIS_DIAL_TIMEOUT", cfg.Redis.DialTimeout)
+	cfg.Redis.ReadTimeout = env.Duration("REDIS_READ_TIMEOUT", cfg.Redis.ReadTimeout)
+	cfg.Redis.WriteTimeout = env.Duration("REDIS_WRITE_TIMEOUT", cfg.Redis.WriteTimeout)
+
+	cfg.Proxy.TargetURL = env.String("TARGET_URL", cfg.Proxy.TargetURL)
+	cfg.Proxy.Timeout = env.Int("PROXY_TIMEOUT", cfg.Proxy.Timeout)
+	cfg.Proxy.MaxBodySize = env.Int("PROXY_MAX_BODY_SIZE", cfg.Proxy.MaxBodySize)
+	cfg.Proxy.BodyMemoryLimit = env.Int("PROXY_BODY_MEMORY_LIMIT", cfg.Proxy.BodyMemoryLimit)
+	cfg.Proxy.BodySpillDir = env.String("PROXY_BODY_SPILL_DIR", cfg.Proxy.BodySpillDir)
+	cfg.Proxy.AccountHeader = env.String("UPSTREAM_ACCOUNT_HEADER", cfg.Proxy.AccountHeader)
+	cfg.Proxy.SignatureHeader = env.String("UPSTREAM_SIGNATURE_HEADER", cfg.Proxy.SignatureHeader)
+	cfg.Proxy.SigningSecret = env.String("UPSTREAM_SIGNING_SECRET", cfg.Proxy.SigningSecret)
+	cfg.Proxy.IdentityHeader = env.String("UPSTREAM_IDENTITY_HEADER", cfg.Proxy.IdentityHeader)
+	cfg.Proxy.TLS.CAFile = env.String("UPSTREAM_CA_FILE", cfg.Proxy.TLS.CAFile)
+	cfg.Proxy.TLS.CertFile = env.String("UPSTREAM_CERT_FILE", cfg.Proxy.TLS.CertFile)
+	cfg.Proxy.TLS.KeyFile = env.String("UPSTREAM_KEY_FILE", cfg.Proxy.TLS.KeyFile)
+	cfg.Proxy.TLS.ServerName = env.String("UPSTREAM_TLS_SERVER_NAME", cfg.Proxy.TLS.ServerName)
+	cfg.Proxy.TLS.InsecureSkipVerify = env.Bool("UPSTREAM_TLS_INSECURE_SKIP_VERIFY", cfg.Proxy.TLS.InsecureSkipVerify)
+	cfg.Proxy.EgressProxy = env.String("UPSTREAM_PROXY", cfg.Proxy.EgressProxy)
+	cfg.Proxy.MaxIdleConns = env.Int("UPSTREAM_MAX_IDLE_CONNS", cfg.Proxy.MaxIdleConns)
+	cfg.Proxy.MaxIdleConnsPerHost = env.Int("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", cfg.Proxy.MaxIdleConnsPerHost)
+	cfg.Proxy.MaxConnsPerHost = env.Int("UPSTREAM_MAX_CONNS_PER_HOST", cfg.Proxy.MaxConnsPerHost)
+	cfg.Proxy.IdleConnTimeout = env.Duration("UPSTREAM_IDLE_CONN_TIMEOUT", cfg.Proxy.IdleConnTimeout)
+	cfg.Proxy.KeepAlive = env.Duration("UPSTREAM_KEEP_ALIVE", cfg.Proxy.KeepAlive)
+	cfg.Proxy.DialTimeout = env.Duration("UPSTREAM_DIAL_TIMEOUT", cfg.Proxy.DialTimeout)
+	cfg.Proxy.TLSHandshakeTimeout = env.Duration("UPSTREAM_TLS_HANDSHAKE_TIMEOUT", cfg.Proxy.TLSHandshakeTimeout)
+	cfg.Proxy.ResponseHeaderTimeout = env.Duration("UPSTREAM_RESPONSE_HEADER_TIMEOUT", cfg.Proxy.ResponseHeaderTimeout)
+	cfg.Proxy.HTTP2 = env.Bool("UPSTREAM_HTTP2", cfg.Proxy.HTTP2)
+
+	cfg.Auth.Enabled = env.Bool("MIDDLEWARE_AUTH_ENABLED", cfg.Auth.Enabled)
+	cfg.Auth.APIKeys = env.List("MIDDLEWARE_API_KEYS", cfg.Auth.APIKeys)
+	cfg.Auth.Prefix = env.String("MIDDLEWARE_API_KEY_PREFIX", cfg.Auth.Prefix)
+	cfg.Auth.ClientCerts = env.Map("MIDDLEWARE_CLIENT_CERTS", cfg.Auth.ClientCerts)
+	cfg.Auth.ClientNames = env.Map("MIDDLEWARE_CLIENT_NAMES", cfg.Auth.ClientNames)
+	cfg.Auth.ClientTeams = env.Map("MIDDLEWARE_CLIENT_TEAMS", cfg.Auth.ClientTeams)
+	cfg.Auth.AdminToken = env.String("MIDDLEWARE_ADMIN_TOKEN", cfg.Auth.AdminToken)
+
+	cfg.SharedPool.Enabled = env.Bool("SHARED_POOL_ENABLED", cfg.SharedPool.Enabled)
+	cfg.SharedPool.EncryptionKey = env.String("ENCRYPTION_KEY", cfg.SharedPool.EncryptionKey)
+	cfg.SharedPool.CacheTTL = env.Duration("SHARED_POOL_CACHE_TTL", cfg.SharedPool.CacheTTL)
+
+	cfg.Binding.Bindings = env.Bindings("ACCOUNT_BINDINGS", cfg.Binding.Bindings)
+	cfg.Binding.UseNodeBindings = env.Bool("ACCOUNT_BINDINGS_FROM_NODE", cfg.Binding.UseNodeBindings)
+	cfg.Binding.FallbackPolicy = env.String("BOUND_ACCOUNT_FALLBACK", cfg.Binding.FallbackPolicy)
+
+	cfg.Selection.Strategy = env.String("SELECTION_STRATEGY", cfg.Selection.Strategy)
+	cfg.Selection.TokenExpiryWindow = env.Duration("TOKEN_EXPIRY_WINDOW", cfg.Selection.TokenExpiryWindow)
+	cfg.Selection.MaxConcurrency = env.Int("ACCOUNT_MAX_CONCURRENCY", cfg.Selection.MaxConcurrency)
+	cfg.Selection.AccountConcurrency = env.IntMap("ACCOUNT_CONCURRENCY", cfg.Selection.AccountConcurrency)
+	cfg.Selection.TokenWindow = env.Duration("SELECTION_TOKEN_WINDOW", cfg.Selection.TokenWindow)
+
+	cfg.Cooldown.RateLimit = env.Duration("COOLDOWN_RATE_LIMIT", cfg.Cooldown.RateLimit)
+	cfg.Cooldown.AuthError = env.Duration("COOLDOWN_AUTH_ERROR", cfg.Cooldown.AuthError)
+	cfg.Cooldown.ServerError = env.Duration("COOLDOWN_SERVER_ERROR", cfg.Cooldown.ServerError)
+	cfg.Cooldown.NetworkError = env.Duration("COOLDOWN_NETWORK_ERROR", cfg.Cooldown.NetworkError)
+
+	cfg.Retry.MaxAttempts = env.Int("RETRY_MAX_ATTEMPTS", cfg.Retry.MaxAttempts)
+	cfg.Retry.Statuses = env.IntList("RETRY_STATUSES", cfg.Retry.Statuses)
+
+	cfg.Reload.WatchInterval = env.Duration("CONFIG_WATCH_INTERVAL", cfg.Reload.WatchInterval)
+
+	cfg.Accounts.RefreshInterval = env.Duration("ACCOUNT_REFRESH_INTERVAL", cfg.Accounts.RefreshInterval)
+	cfg.Accounts.SnapshotFile = env.String("ACCOUNT_SNAPSHOT_FILE", cfg.Accounts.SnapshotFile)
+	cfg.Accounts.MaxStaleness = env.Duration("ACCOUNT_MAX_STALENESS", cfg.Accounts.MaxStaleness)
+	cfg.Accounts.ReconnectMinBackoff = env.Duration("REDIS_RECONNECT_MIN_BACKOFF", cfg.Accounts.ReconnectMinBackoff)
+	cfg.Accounts.ReconnectMaxBackoff = env.Duration("REDIS_RECONNECT_MAX_BACKOFF", cfg.Accounts.ReconnectMaxBackoff)
+
+	cfg.Headers.Forwarded = env.Bool("FORWARDED_HEADERS", cfg.Headers.Forwarded)
+	requestRemove := env.List("REQUEST_HEADERS_REMOVE", nil)
+	responseRemove := env.List("RESPONSE_HEADERS_REMOVE", nil)
+	if len(requestRemove) > 0 || len(responseRemove) > 0 {
+		// 环境变量中的删除列表作为对所有路由生效的规则追加在配置文件规则之后
+		cfg.Headers.Rules = append(cfg.Headers.Rules, HeaderRule{
+			Request:  HeaderActions{Remove: requestRemove},
+			Response: HeaderActions{Remove: responseRemove},
+		})
 	}
-	return defaultValue
-}
\ No newline at end of file
+
+	cfg.Capture.Enabled = env.Bool("CAPTURE_ENABLED", cfg.Capture.Enabled)
+	cfg.Capture.SampleRate = env.Float("CAPTURE_SAMPLE_RATE", cfg.Capture.SampleRate)
+	cfg.Capture.Storage = env.String("CAPTURE_STORAGE", cfg.Capture.Storage)
+	cfg.Capture.RingSize = env.Int("CAPTURE_RING_SIZE", cfg.Capture.RingSize)
+	cfg.Capture.File = env.String("CAPTURE_FILE", cfg.Capture.File)
+	cfg.Capture.MaxFileSize = env.Int("CAPTURE_MAX_FILE_SIZE", cfg.Capture.MaxFileSize)
+	cfg.Capture.MaxBackups = env.Int("CAPTURE_MAX_BACKUPS", cfg.Capture.MaxBackups)
+	cfg.Capture.MaxBodySize = env.Int("CAPTURE_MAX_BODY_SIZE", cfg.Capture.MaxBodySize)
+	cfg.Capture.RedactHeaders = env.List("CAPTURE_REDACT_HEADERS", cfg.Capture.RedactHeaders)
+	cfg.Capture.Clients = env.List("CAPTURE_CLIENTS", cfg.Capture.Clients)
+	cfg.Capture.Accounts = env.List("CAPTURE_ACCOUNTS", cfg.Capture.Accounts)
+	cfg.Capture.Statuses = env.IntList("CAPTURE_STATUSES", cfg.Capture.Statuses)
+
+	cfg.AccessLog.Enabled = env.Bool("ACCESS_LOG_ENABLED", cfg.AccessLog.Enabled)
+	cfg.AccessLog.Output = env.String("ACCESS_LOG_OUTPUT", cfg.AccessLog.Output)
+	cfg.AccessLog.MaxFileSize = env.Int("ACCESS_LOG_MAX_FILE_SIZE", cfg.AccessLog.MaxFileSize)
+	cfg.AccessLog.MaxBackups = env.Int("ACCESS_LOG_MAX_BACKUPS", cfg.AccessLog.MaxBackups)
+
+	cfg.Models.Enabled = env.Bool("MODELS_ENABLED", cfg.Models.Enabled)
+	cfg.Models.Registry = env.Models("MODELS_REGISTRY", cfg.Models.Registry)
+	cfg.Models.Allowed = env.Bindings("MODELS_ALLOWED", cfg.Models.Allowed)
+	cfg.Models.UseNodeLimits = env.Bool("MODELS_FROM_NODE", cfg.Models.UseNodeLimits)
+
+	cfg.Fallback.Enabled = env.Bool("FALLBACK_ENABLED", cfg.Fallback.Enabled)
+	cfg.Fallback.Chains = env.Bindings("FALLBACK_CHAINS", cfg.Fallback.Chains)
+	cfg.Fallback.ModelHeader = env.String("FALLBACK_MODEL_HEADER", cfg.Fallback.ModelHeader)
+
+	cfg.Hedge.Enabled = env.Bool("HEDGE_ENABLED", cfg.Hedge.Enabled)
+	cfg.Hedge.Clients = env.List("HEDGE_CLIENTS", cfg.Hedge.Clients)
+	cfg.Hedge.Percentile = env.Float("HEDGE_PERCENTILE", cfg.Hedge.Percentile)
+	cfg.Hedge.MinDelay = env.Duration("HEDGE_MIN_DELAY", cfg.Hedge.MinDelay)
+	cfg.Hedge.MaxDelay = env.Duration("HEDGE_MAX_DELAY", cfg.Hedge.MaxDelay)
+	cfg.Hedge.MinSamples = env.Int("HEDGE_MIN_SAMPLES", cfg.Hedge.MinSamples)
+	cfg.Hedge.Window = env.Int("HEDGE_WINDOW", cfg.Hedge.Window)
+	cfg.Hedge.MaxBodySize = env.Int("HEDGE_MAX_BODY_SIZE", cfg.Hedge.MaxBodySize)
+
+	cfg.Queue.Enabled = env.Bool("QUEUE_ENABLED", cfg.Queue.Enabled)
+	cfg.Queue.MaxWait = env.Duration("QUEUE_MAX_WAIT", cfg.Queue.MaxWait)
+	cfg.Queue.MaxDepth = env.Int("QUEUE_MAX_DEPTH", cfg.Queue.MaxDepth)
+	cfg.Queue.MaxPerClient = env.Int("QUEUE_MAX_PER_CLIENT", cfg.Queue.MaxPerClient)
+	cfg.Queue.PollInterval = env.Duration("QUEUE_POLL_INTERVAL", cfg.Queue.PollInterval)
+
+	cfg.Cache.Enabled = env.Bool("CACHE_ENABLED", cfg.Cache.Enabled)
+	cfg.Cache.Backend = env.String("CACHE_BACKEND", cfg.Cache.Backend)
+	cfg.Cache.TTL = env.Duration("CACHE_TTL", cfg.Cache.TTL)
+	cfg.Cache.MaxEntries = env.Int("CACHE_MAX_ENTRIES", cfg.Cache.MaxEntries)
+	cfg.Cache.MaxBodySize = env.Int("CACHE_MAX_BODY_SIZE", cfg.Cache.MaxBodySize)
+	cfg.Cache.Routes = env.List("CACHE_ROUTES", cfg.Cache.Routes)
+	cfg.Cache.Clients = env.List("CACHE_CLIENTS", cfg.Cache.Clients)
+	cfg.Cache.Shared = env.Bool("CACHE_SHARED", cfg.Cache.Shared)
+	cfg.Cache.DeterministicOnly = env.Bool("CACHE_DETERMINISTIC_ONLY", cfg.Cache.DeterministicOnly)
+	cfg.Cache.KeyPrefix = env.String("CACHE_KEY_PREFIX", cfg.Cache.KeyPrefix)
+	cfg.Cache.StatusHeader = env.String("CACHE_STATUS_HEADER", cfg.Cache.StatusHeader)
+
+	cfg.Coalesce.Enabled = env.Bool("COALESCE_ENABLED", cfg.Coalesce.Enabled)
+	cfg.Coalesce.Routes = env.List("COALESCE_ROUTES", cfg.Coalesce.Routes)
+	cfg.Coalesce.DeterministicOnly = env.Bool("COALESCE_DETERMINISTIC_ONLY", cfg.Coalesce.DeterministicOnly)
+	cfg.Coalesce.MaxResponseSize = env.Int("COALESCE_MAX_RESPONSE_SIZE", cfg.Coalesce.MaxResponseSize)
+
+	cfg.Translate.OpenAI = env.Bool("TRANSLATE_OPENAI", cfg.Translate.OpenAI)
+	cfg.Translate.MessagesPath = env.String("TRANSLATE_MESSAGES_PATH", cfg.Translate.MessagesPath)
+	cfg.Translate.DefaultMaxTokens = env.Int("TRANSLATE_DEFAULT_MAX_TOKENS", cfg.Translate.DefaultMaxTokens)
+	cfg.Translate.Gemini = env.Bool("TRANSLATE_GEMINI", cfg.Translate.Gemini)
+	cfg.Translate.GeminiModels = env.List("TRANSLATE_GEMINI_MODELS", cfg.Translate.GeminiModels)
+	cfg.Translate.GeminiPath = env.String("TRANSLATE_GEMINI_PATH", cfg.Translate.GeminiPath)
+
+	return env.Err()
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envReader 读取环境变量并记录所有解析失败的变量
+// 解析失败时保留原值，由调用方通过Err()获取汇总错误
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) fail(key, value, expected string) {
+	e.errs = append(e.errs, fmt.Errorf("%s: invalid %s %q", key, expected, value))
+}
+
+// Err 返回所有解析错误的汇总
+func (e *envReader) Err() error {
+	return errors.Join(e.errs...)
+}
+
+func (e *envReader) String(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (e *envReader) Int(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		e.fail(key, value, "integer")
+		return defaultValue
+	}
+	return intValue
+}
+
+func (e *envReader) Float(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		e.fail(key, value, "number")
+		return defaultValue
+	}
+	return floatValue
+}
+
+func (e *envReader) Bool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		e.fail(key, value, "boolean")
+		return defaultValue
+	}
+	return boolValue
+}
+
+func (e *envReader) Duration(key string, defaultValue Duration) Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		e.fail(key, value, "duration (e.g. 30s, 5m, 1h)")
+		return defaultValue
+	}
+	return Duration{d}
+}
+
+// List 解析逗号分隔的列表
+func (e *envReader) List(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// IntList 解析逗号分隔的整数列表
+func (e *envReader) IntList(key string, defaultValue []int) []int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []int
+	for _, item := range strings.Split(value, ",") {
+		intValue, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			e.fail(key, value, "integer list")
+			return defaultValue
+		}
+		items = append(items, intValue)
+	}
+	return items
+}
+
+// Map 解析形如 "key1:value1,key2:value2" 的映射
+func (e *envReader) Map(key string, defaultValue map[string]string) map[string]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	result := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			e.fail(key, entry, "mapping (expected key:value)")
+			continue
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result
+}
+
+// IntMap 解析形如 "key1:1,key2:2" 的整数映射
+func (e *envReader) IntMap(key string, defaultValue map[string]int) map[string]int {
+	entries := e.Map(key, nil)
+	if entries == nil {
+		return defaultValue
+	}
+
+	result := make(map[string]int, len(entries))
+	for name, value := range entries {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, name+":"+value, "integer mapping (expected key:number)")
+			continue
+		}
+		result[name] = intValue
+	}
+	return result
+}
+
+// Bindings 解析形如 "key1:acc1|acc2,key2:acc3" 的绑定配置
+func (e *envReader) Bindings(key string, defaultValue map[string][]string) map[string][]string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	bindings := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			e.fail(key, entry, "binding (expected key:account1|account2)")
+			continue
+		}
+
+		var accountIDs []string
+		for _, accountID := range strings.Split(parts[1], "|") {
+			if accountID = strings.TrimSpace(accountID); accountID != "" {
+				accountIDs = append(accountIDs, accountID)
+			}
+		}
+		clientKey := strings.TrimSpace(parts[0])
+		if clientKey == "" || len(accountIDs) == 0 {
+			e.fail(key, entry, "binding (expected key:account1|account2)")
+			continue
+		}
+		bindings[clientKey] = accountIDs
+	}
+	return bindings
+}
+
+// Models 解析形如 "claude-opus-4-20250514,gemini-2.5-pro" 的模型列表
+// 以 gemini 开头的模型归属 google，其余归属 anthropic
+func (e *envReader) Models(key string, defaultValue []ModelInfo) []ModelInfo {
+	ids := e.List(key, nil)
+	if ids == nil {
+		return defaultValue
+	}
+
+	models := make([]ModelInfo, 0, len(ids))
+	for _, id := range ids {
+		ownedBy := "anthropic"
+		if strings.HasPrefix(id, "gemini") {
+			ownedBy = "google"
+		}
+		models = append(models, ModelInfo{ID: id, DisplayName: id, OwnedBy: ownedBy})
+	}
+	return models
+}
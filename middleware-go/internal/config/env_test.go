@@ -0,0 +1,180 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvReaderScalars(t *testing.T) {
+	t.Setenv("TEST_STRING", "value")
+	t.Setenv("TEST_INT", " 42 ")
+	t.Setenv("TEST_FLOAT", "0.25")
+	t.Setenv("TEST_BOOL", "true")
+	t.Setenv("TEST_DURATION", "1m30s")
+
+	env := &envReader{}
+	if got := env.String("TEST_STRING", "default"); got != "value" {
+		t.Errorf("String = %q, want value", got)
+	}
+	if got := env.String("TEST_UNSET", "default"); got != "default" {
+		t.Errorf("String(unset) = %q, want default", got)
+	}
+	if got := env.Int("TEST_INT", 1); got != 42 {
+		t.Errorf("Int = %d, want 42", got)
+	}
+	if got := env.Int("TEST_UNSET", 7); got != 7 {
+		t.Errorf("Int(unset) = %d, want 7", got)
+	}
+	if got := env.Float("TEST_FLOAT", 1); got != 0.25 {
+		t.Errorf("Float = %v, want 0.25", got)
+	}
+	if got := env.Bool("TEST_BOOL", false); !got {
+		t.Errorf("Bool = %v, want true", got)
+	}
+	if got := env.Duration("TEST_DURATION", Duration{}); got.Duration != 90*time.Second {
+		t.Errorf("Duration = %v, want 1m30s", got)
+	}
+	if err := env.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestEnvReaderInvalidValuesKeepDefaults(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		read  func(env *envReader) interface{}
+		want  interface{}
+	}{
+		{"TEST_INT", "ten", func(env *envReader) interface{} { return env.Int("TEST_INT", 10) }, 10},
+		{"TEST_FLOAT", "half", func(env *envReader) interface{} { return env.Float("TEST_FLOAT", 0.5) }, 0.5},
+		{"TEST_BOOL", "maybe", func(env *envReader) interface{} { return env.Bool("TEST_BOOL", true) }, true},
+		{"TEST_DURATION", "300", func(env *envReader) interface{} {
+			return env.Duration("TEST_DURATION", Duration{time.Minute}).Duration
+		}, time.Minute},
+		{"TEST_INT_LIST", "429,x", func(env *envReader) interface{} { return env.IntList("TEST_INT_LIST", []int{503}) }, []int{503}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			env := &envReader{}
+			if got := tt.read(env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want default %v", got, tt.want)
+			}
+			err := env.Err()
+			if err == nil || !strings.Contains(err.Error(), tt.key) || !strings.Contains(err.Error(), tt.value) {
+				t.Errorf("Err() = %v, want error naming %s and %q", err, tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestEnvReaderCollections(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		read    func(env *envReader) interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"list", " a, b ,,c ", func(env *envReader) interface{} { return env.List("TEST_VALUE", nil) }, []string{"a", "b", "c"}, false},
+		{"int list", "429, 500,503", func(env *envReader) interface{} { return env.IntList("TEST_VALUE", nil) }, []int{429, 500, 503}, false},
+		{"map", "a:1, b : 2", func(env *envReader) interface{} { return env.Map("TEST_VALUE", nil) },
+			map[string]string{"a": "1", "b": "2"}, false},
+		{"map invalid entry", "a:1,b", func(env *envReader) interface{} { return env.Map("TEST_VALUE", nil) },
+			map[string]string{"a": "1"}, true},
+		{"map url value", "up:http://host:80", func(env *envReader) interface{} { return env.Map("TEST_VALUE", nil) },
+			map[string]string{"up": "http://host:80"}, false},
+		{"int map", "acc1:5,acc2:0", func(env *envReader) interface{} { return env.IntMap("TEST_VALUE", nil) },
+			map[string]int{"acc1": 5, "acc2": 0}, false},
+		{"int map invalid number", "acc1:5,acc2:many", func(env *envReader) interface{} { return env.IntMap("TEST_VALUE", nil) },
+			map[string]int{"acc1": 5}, true},
+		{"bindings", "key1:acc1|acc2, key2:acc3", func(env *envReader) interface{} { return env.Bindings("TEST_VALUE", nil) },
+			map[string][]string{"key1": {"acc1", "acc2"}, "key2": {"acc3"}}, false},
+		{"bindings without accounts", "key1:acc1,key2:|", func(env *envReader) interface{} { return env.Bindings("TEST_VALUE", nil) },
+			map[string][]string{"key1": {"acc1"}}, true},
+		{"bindings without key", ":acc1", func(env *envReader) interface{} { return env.Bindings("TEST_VALUE", nil) },
+			map[string][]string{}, true},
+		{"models", "claude-opus-4,gemini-2.5-pro", func(env *envReader) interface{} { return env.Models("TEST_VALUE", nil) },
+			[]ModelInfo{
+				{ID: "claude-opus-4", DisplayName: "claude-opus-4", OwnedBy: "anthropic"},
+				{ID: "gemini-2.5-pro", DisplayName: "gemini-2.5-pro", OwnedBy: "google"},
+			}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_VALUE", tt.value)
+			env := &envReader{}
+			if got := tt.read(env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if err := env.Err(); (err != nil) != tt.wantErr {
+				t.Errorf("Err() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvReaderUnsetCollectionsKeepDefaults(t *testing.T) {
+	env := &envReader{}
+	if got := env.List("TEST_UNSET", []string{"x"}); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("List(unset) = %v", got)
+	}
+	if got := env.IntMap("TEST_UNSET", map[string]int{"a": 1}); !reflect.DeepEqual(got, map[string]int{"a": 1}) {
+		t.Errorf("IntMap(unset) = %v", got)
+	}
+	if got := env.Bindings("TEST_UNSET", map[string][]string{}); got == nil || len(got) != 0 {
+		t.Errorf("Bindings(unset) = %v", got)
+	}
+}
+
+func TestLoadAppliesEnv(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("TARGET_URL", "https://relay.internal:3443")
+	t.Setenv("TOKEN_EXPIRY_WINDOW", "10m")
+	t.Setenv("ACCOUNT_CONCURRENCY", "acc1:3")
+	t.Setenv("CACHE_ENABLED", "true")
+	t.Setenv("CACHE_ROUTES", "/v1/messages")
+	t.Setenv("COALESCE_ENABLED", "true")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if cfg.Server.Port != 9090 {
+		t.Errorf("Server.Port = %d, want 9090", cfg.Server.Port)
+	}
+	if cfg.Proxy.TargetURL != "https://relay.internal:3443" {
+		t.Errorf("Proxy.TargetURL = %q", cfg.Proxy.TargetURL)
+	}
+	if cfg.Selection.TokenExpiryWindow.Duration != 10*time.Minute {
+		t.Errorf("Selection.TokenExpiryWindow = %v, want 10m", cfg.Selection.TokenExpiryWindow)
+	}
+	if cfg.Selection.AccountConcurrency["acc1"] != 3 {
+		t.Errorf("Selection.AccountConcurrency = %v", cfg.Selection.AccountConcurrency)
+	}
+	if !cfg.Cache.Enabled || !reflect.DeepEqual(cfg.Cache.Routes, []string{"/v1/messages"}) {
+		t.Errorf("Cache = %+v", cfg.Cache)
+	}
+	if !cfg.Coalesce.Enabled {
+		t.Error("Coalesce.Enabled = false, want true")
+	}
+}
+
+func TestLoadReportsEnvAndValidationErrors(t *testing.T) {
+	t.Setenv("PORT", "eighty")
+	t.Setenv("RETRY_MAX_ATTEMPTS", "0")
+	t.Setenv("SELECTION_STRATEGY", "fastest")
+
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("Load() = nil, want error")
+	}
+	for _, want := range []string{"PORT: invalid integer", "retry.max_attempts", "selection.strategy"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() = %v, missing %q", err, want)
+		}
+	}
+}
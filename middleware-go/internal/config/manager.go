@@ -0,0 +1,146 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// hotReloadSections 可以在热加载时生效的配置部分（按配置文件中的名称），其余部分的修改需要重启服务
+// Reload按此列表合并新配置，config.example.yaml中的 [热加载] 标记与此保持一致
+var hotReloadSections = map[string]bool{
+	"auth":      true,
+	"binding":   true,
+	"selection": true,
+	"cooldown":  true,
+	"retry":     true,
+	"accounts":  true,
+	"headers":   true,
+	"capture":   true,
+	"translate": true,
+	"models":    true,
+	"fallback":  true,
+	"hedge":     true,
+	"queue":     true,
+	"coalesce":  true,
+}
+
+// Manager 持有当前生效的配置，并负责热加载
+//
+// 只有 hotReloadSections 中的配置会在热加载时生效，其余配置的修改需要重启服务。
+type Manager struct {
+	path    string
+	current atomic.Pointer[Config]
+	modTime time.Time
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+// NewManager 加载配置并创建配置管理器
+func NewManager(path string) (*Manager, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{path: path}
+	m.current.Store(cfg)
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			m.modTime = info.ModTime()
+		}
+	}
+	return m, nil
+}
+
+// Current 返回当前生效的配置，调用方不应修改返回值
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// OnReload 注册热加载成功后的回调
+func (m *Manager) OnReload(listener func(*Config)) {
+	m.mu.Lock()
+	m.listeners = append(m.listeners, listener)
+	m.mu.Unlock()
+}
+
+// Reload 重新加载配置，失败时保留旧配置
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	loaded, err := Load(m.path)
+	if err != nil {
+		log.Printf("❌ Config reload rejected, keeping previous config: %v", err)
+		return err
+	}
+
+	old := m.current.Load()
+	merged := *old
+
+	oldValue, loadedValue, mergedValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(loaded).Elem(), reflect.ValueOf(&merged).Elem()
+	for i := 0; i < mergedValue.NumField(); i++ {
+		name := sectionName(mergedValue.Type().Field(i))
+		if hotReloadSections[name] {
+			mergedValue.Field(i).Set(loadedValue.Field(i))
+		} else if !reflect.DeepEqual(oldValue.Field(i).Interface(), loadedValue.Field(i).Interface()) {
+			log.Printf("⚠️  Config section %q changed but requires a restart to take effect", name)
+		}
+	}
+
+	m.current.Store(&merged)
+	log.Printf("✅ Config reloaded")
+
+	for _, listener := range m.listeners {
+		listener(&merged)
+	}
+	return nil
+}
+
+// Watch 监听SIGHUP信号和配置文件变化，触发热加载
+func (m *Manager) Watch() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var ticks <-chan time.Time
+	if interval := m.Current().Reload.WatchInterval.Duration; m.path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+		log.Printf("👀 Watching config file %s (every %v)", m.path, interval)
+	}
+
+	for {
+		select {
+		case <-signals:
+			log.Printf("🔄 Received SIGHUP, reloading config...")
+			m.Reload()
+		case <-ticks:
+			info, err := os.Stat(m.path)
+			if err != nil {
+				log.Printf("⚠️  Failed to stat config file %s: %v", m.path, err)
+				continue
+			}
+			if info.ModTime().Equal(m.modTime) {
+				continue
+			}
+			m.modTime = info.ModTime()
+			log.Printf("🔄 Config file %s changed, reloading config...", m.path)
+			m.Reload()
+		}
+	}
+}
+
+// sectionName 配置部分在配置文件中的名称
+func sectionName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
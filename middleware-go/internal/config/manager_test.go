@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReloadAppliesOnlyHotReloadSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	write("server:\n  port: 8080\nretry:\n  max_attempts: 2\ncoalesce:\n  enabled: false\n")
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	reloaded := 0
+	m.OnReload(func(*Config) { reloaded++ })
+	write("server:\n  port: 9090\nretry:\n  max_attempts: 5\ncoalesce:\n  enabled: true\n")
+	if err := m.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	cfg := m.Current()
+	if cfg.Server.Port != 8080 {
+		t.Errorf("server.port = %d, want 8080 until restart", cfg.Server.Port)
+	}
+	if cfg.Retry.MaxAttempts != 5 || !cfg.Coalesce.Enabled {
+		t.Errorf("retry.max_attempts = %d, coalesce.enabled = %v, want hot-reloaded", cfg.Retry.MaxAttempts, cfg.Coalesce.Enabled)
+	}
+	if reloaded != 1 {
+		t.Errorf("listeners called %d times, want 1", reloaded)
+	}
+
+	write("retry:\n  max_attempts: 0\n")
+	if err := m.Reload(); err == nil || m.Current().Retry.MaxAttempts != 5 {
+		t.Errorf("invalid reload: err = %v, max_attempts = %d, want previous config kept", err, m.Current().Retry.MaxAttempts)
+	}
+}
+
+func TestHotReloadSectionsExist(t *testing.T) {
+	sections := make(map[string]bool)
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		sections[sectionName(configType.Field(i))] = true
+	}
+	for name := range hotReloadSections {
+		if !sections[name] {
+			t.Errorf("hot reload section %q is not a config section", name)
+		}
+	}
+}
+
+// TestExampleConfigMarksHotReloadSections config.example.yaml中的 [热加载] 标记与hotReloadSections一致
+func TestExampleConfigMarksHotReloadSections(t *testing.T) {
+	file, err := os.Open("../../config.example.yaml")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+
+	marked := make(map[string]bool)
+	var comment string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			comment += line
+		case strings.HasSuffix(line, ":") && !strings.HasPrefix(line, " "):
+			marked[strings.TrimSuffix(line, ":")] = strings.Contains(comment, "[热加载]")
+			comment = ""
+		default:
+			comment = ""
+		}
+	}
+
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		name := sectionName(configType.Field(i))
+		if marked[name] != hotReloadSections[name] {
+			t.Errorf("config.example.yaml: section %q marked [热加载] = %v, want %v", name, marked[name], hotReloadSections[name])
+		}
+	}
+}
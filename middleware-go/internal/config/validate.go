@@ -0,0 +1,379 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// validator 收集所有校验失败的配置项
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	v.check(false, field, "unsupported value %q (allowed: %v)", value, allowed)
+}
+
+func (v *validator) port(field string, port int) {
+	v.check(port > 0 && port <= 65535, field, "must be between 1 and 65535, got %d", port)
+}
+
+// Validate 校验配置取值，返回所有无效配置项的汇总错误
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.port("server.port (PORT)", c.Server.Port)
+	v.oneOf("server.mode (GIN_MODE)", c.Server.Mode, "debug", "release", "test", "production")
+	v.oneOf("server.tls.client_auth (TLS_CLIENT_AUTH)", c.Server.TLS.ClientAuth,
+		"none", "request", "verify_if_given", "require")
+	if c.Server.TLS.Enabled {
+		v.check(c.Server.TLS.CertFile != "" && c.Server.TLS.KeyFile != "", "server.tls (TLS_CERT_FILE/TLS_KEY_FILE)",
+			"TLS is enabled but certificate or key file is missing")
+		v.check(c.Server.TLS.ClientAuth == "none" || c.Server.TLS.ClientAuth == "request" || c.Server.TLS.ClientCAFile != "",
+			"server.tls.client_ca_file (TLS_CLIENT_CA_FILE)", "client certificate verification requires a client CA file")
+	} else {
+		v.check(c.Server.TLS.ClientAuth == "none", "server.tls.client_auth (TLS_CLIENT_AUTH)",
+			"client certificate authentication requires TLS to be enabled")
+	}
+	v.check(c.Server.TLS.ReloadInterval.Duration >= 0, "server.tls.reload_interval (TLS_RELOAD_INTERVAL)",
+		"must not be negative, got %s", c.Server.TLS.ReloadInterval)
+
+	v.check(c.Redis.Host != "", "redis.host (REDIS_HOST)", "must not be empty")
+	v.port("redis.port (REDIS_PORT)", c.Redis.Port)
+	v.check(c.Redis.DB >= 0, "redis.db (REDIS_DB)", "must not be negative, got %d", c.Redis.DB)
+	if c.Redis.URL != "" {
+		if redisURL, err := url.Parse(c.Redis.URL); err != nil {
+			v.check(false, "redis.url (REDIS_URL)", "invalid URL: %v", err)
+		} else {
+			v.check(redisURL.Scheme == "redis" || redisURL.Scheme == "rediss", "redis.url (REDIS_URL)",
+				"scheme must be redis or rediss, got %q", redisURL.Scheme)
+		}
+	}
+	v.check((c.Redis.TLS.CertFile == "") == (c.Redis.TLS.KeyFile == ""), "redis.tls (REDIS_TLS_CERT_FILE/REDIS_TLS_KEY_FILE)",
+		"client certificate and key must be set together")
+	v.check(c.Redis.SentinelMaster == "" || len(c.Redis.ClusterAddrs) == 0, "redis.sentinel_master (REDIS_SENTINEL_MASTER)",
+		"sentinel and cluster modes are mutually exclusive")
+	v.check(c.Redis.SentinelMaster == "" || len(c.Redis.SentinelAddrs) > 0, "redis.sentinel_addrs (REDIS_SENTINEL_ADDRS)",
+		"sentinel master is set but no sentinel addresses are configured")
+	v.check(c.Redis.PoolSize >= 0, "redis.pool_size (REDIS_POOL_SIZE)", "must not be negative, got %d", c.Redis.PoolSize)
+	v.check(c.Redis.MinIdleConns >= 0, "redis.min_idle_conns (REDIS_MIN_IDLE_CONNS)",
+		"must not be negative, got %d", c.Redis.MinIdleConns)
+	v.check(c.Redis.DialTimeout.Duration >= 0, "redis.dial_timeout (REDIS_DIAL_TIMEOUT)",
+		"must not be negative, got %s", c.Redis.DialTimeout)
+	v.check(c.Redis.ReadTimeout.Duration >= 0, "redis.read_timeout (REDIS_READ_TIMEOUT)",
+		"must not be negative, got %s", c.Redis.ReadTimeout)
+	v.check(c.Redis.WriteTimeout.Duration >= 0, "redis.write_timeout (REDIS_WRITE_TIMEOUT)",
+		"must not be negative, got %s", c.Redis.WriteTimeout)
+
+	if target, err := url.Parse(c.Proxy.TargetURL); err != nil {
+		v.check(false, "proxy.target_url (TARGET_URL)", "invalid URL %q: %v", c.Proxy.TargetURL, err)
+	} else {
+		v.check(target.Scheme == "http" || target.Scheme == "https", "proxy.target_url (TARGET_URL)",
+			"scheme must be http or https, got %q", target.Scheme)
+		v.check(target.Host != "", "proxy.target_url (TARGET_URL)", "missing host in %q", c.Proxy.TargetURL)
+	}
+	v.check(c.Proxy.Timeout > 0, "proxy.timeout (PROXY_TIMEOUT)", "must be positive, got %d", c.Proxy.Timeout)
+	v.check(c.Proxy.MaxBodySize >= 0, "proxy.max_body_size (PROXY_MAX_BODY_SIZE)",
+		"must not be negative, got %d", c.Proxy.MaxBodySize)
+	v.check(c.Proxy.BodyMemoryLimit >= 0, "proxy.body_memory_limit (PROXY_BODY_MEMORY_LIMIT)",
+		"must not be negative, got %d", c.Proxy.BodyMemoryLimit)
+	if c.Proxy.BodySpillDir != "" {
+		info, err := os.Stat(c.Proxy.BodySpillDir)
+		v.check(err == nil && info.IsDir(), "proxy.body_spill_dir (PROXY_BODY_SPILL_DIR)",
+			"%q is not an existing directory", c.Proxy.BodySpillDir)
+	}
+	v.check(validHeaderName(c.Proxy.AccountHeader), "proxy.account_header (UPSTREAM_ACCOUNT_HEADER)",
+		"invalid header name %q", c.Proxy.AccountHeader)
+	if c.Proxy.IdentityHeader != "" {
+		v.check(validHeaderName(c.Proxy.IdentityHeader), "proxy.identity_header (UPSTREAM_IDENTITY_HEADER)",
+			"invalid header name %q", c.Proxy.IdentityHeader)
+		v.check(!strings.EqualFold(c.Proxy.IdentityHeader, c.Proxy.AccountHeader), "proxy.identity_header (UPSTREAM_IDENTITY_HEADER)",
+			"must differ from the account header")
+	}
+	if c.Proxy.SigningSecret != "" {
+		v.check(validHeaderName(c.Proxy.SignatureHeader), "proxy.signature_header (UPSTREAM_SIGNATURE_HEADER)",
+			"invalid header name %q", c.Proxy.SignatureHeader)
+		v.check(!strings.EqualFold(c.Proxy.SignatureHeader, c.Proxy.AccountHeader), "proxy.signature_header (UPSTREAM_SIGNATURE_HEADER)",
+			"must differ from the account header")
+	}
+	if c.Proxy.EgressProxy != "" {
+		if egress, err := url.Parse(c.Proxy.EgressProxy); err != nil {
+			v.check(false, "proxy.egress_proxy (UPSTREAM_PROXY)", "invalid URL: %v", err)
+		} else {
+			v.oneOf("proxy.egress_proxy (UPSTREAM_PROXY) scheme", egress.Scheme, "http", "https", "socks5", "socks5h")
+			v.check(egress.Host != "", "proxy.egress_proxy (UPSTREAM_PROXY)", "missing host in %q", c.Proxy.EgressProxy)
+		}
+	}
+	v.check((c.Proxy.TLS.CertFile == "") == (c.Proxy.TLS.KeyFile == ""), "proxy.tls (UPSTREAM_CERT_FILE/UPSTREAM_KEY_FILE)",
+		"client certificate and key must be set together")
+	v.check(c.Proxy.MaxIdleConns >= 0, "proxy.max_idle_conns (UPSTREAM_MAX_IDLE_CONNS)",
+		"must not be negative, got %d", c.Proxy.MaxIdleConns)
+	v.check(c.Proxy.MaxIdleConnsPerHost >= 0, "proxy.max_idle_conns_per_host (UPSTREAM_MAX_IDLE_CONNS_PER_HOST)",
+		"must not be negative, got %d", c.Proxy.MaxIdleConnsPerHost)
+	v.check(c.Proxy.MaxConnsPerHost >= 0, "proxy.max_conns_per_host (UPSTREAM_MAX_CONNS_PER_HOST)",
+		"must not be negative, got %d", c.Proxy.MaxConnsPerHost)
+	for _, d := range []struct {
+		field string
+		value Duration
+	}{
+		{"proxy.idle_conn_timeout (UPSTREAM_IDLE_CONN_TIMEOUT)", c.Proxy.IdleConnTimeout},
+		{"proxy.keep_alive (UPSTREAM_KEEP_ALIVE)", c.Proxy.KeepAlive},
+		{"proxy.dial_timeout (UPSTREAM_DIAL_TIMEOUT)", c.Proxy.DialTimeout},
+		{"proxy.tls_handshake_timeout (UPSTREAM_TLS_HANDSHAKE_TIMEOUT)", c.Proxy.TLSHandshakeTimeout},
+		{"proxy.response_header_timeout (UPSTREAM_RESPONSE_HEADER_TIMEOUT)", c.Proxy.ResponseHeaderTimeout},
+	} {
+		v.check(d.value.Duration >= 0, d.field, "must not be negative, got %s", d.value)
+	}
+
+	v.check(!c.Auth.Enabled || len(c.Auth.APIKeys) > 0 || len(c.Auth.ClientCerts) > 0, "auth.api_keys (MIDDLEWARE_API_KEYS)",
+		"authentication is enabled but no API keys or client certificates are configured")
+	for i, key := range c.Auth.APIKeys {
+		v.check(key != "", fmt.Sprintf("auth.api_keys[%d]", i), "must not be empty")
+	}
+
+	v.check(c.SharedPool.CacheTTL.Duration >= 0, "shared_pool.cache_ttl (SHARED_POOL_CACHE_TTL)",
+		"must not be negative, got %s", c.SharedPool.CacheTTL)
+
+	v.oneOf("binding.fallback_policy (BOUND_ACCOUNT_FALLBACK)", c.Binding.FallbackPolicy, "shared", "reject")
+	for key, accountIDs := range c.Binding.Bindings {
+		v.check(len(accountIDs) > 0, "binding.bindings", "no accounts bound to %q", key)
+	}
+
+	v.oneOf("selection.strategy (SELECTION_STRATEGY)", c.Selection.Strategy, "least_used", "least_tokens", "round_robin", "random")
+	v.check(c.Selection.TokenExpiryWindow.Duration >= 0, "selection.token_expiry_window (TOKEN_EXPIRY_WINDOW)",
+		"must not be negative, got %s", c.Selection.TokenExpiryWindow)
+	v.check(c.Selection.TokenWindow.Duration > 0, "selection.token_window (SELECTION_TOKEN_WINDOW)",
+		"must be positive, got %v", c.Selection.TokenWindow.Duration)
+	v.check(c.Selection.MaxConcurrency >= 0, "selection.max_concurrency (ACCOUNT_MAX_CONCURRENCY)",
+		"must not be negative, got %d", c.Selection.MaxConcurrency)
+	for accountID, limit := range c.Selection.AccountConcurrency {
+		v.check(limit >= 0, fmt.Sprintf("selection.account_concurrency[%s] (ACCOUNT_CONCURRENCY)", accountID),
+			"must not be negative, got %d", limit)
+	}
+
+	v.check(c.Cooldown.RateLimit.Duration > 0, "cooldown.rate_limit (COOLDOWN_RATE_LIMIT)",
+		"must be positive, got %s", c.Cooldown.RateLimit)
+	v.check(c.Cooldown.AuthError.Duration > 0, "cooldown.auth_error (COOLDOWN_AUTH_ERROR)",
+		"must be positive, got %s", c.Cooldown.AuthError)
+	v.check(c.Cooldown.ServerError.Duration > 0, "cooldown.server_error (COOLDOWN_SERVER_ERROR)",
+		"must be positive, got %s", c.Cooldown.ServerError)
+	v.check(c.Cooldown.NetworkError.Duration > 0, "cooldown.network_error (COOLDOWN_NETWORK_ERROR)",
+		"must be positive, got %s", c.Cooldown.NetworkError)
+
+	v.check(c.Retry.MaxAttempts >= 1, "retry.max_attempts (RETRY_MAX_ATTEMPTS)",
+		"must be at least 1, got %d", c.Retry.MaxAttempts)
+	for _, status := range c.Retry.Statuses {
+		v.check(status >= 400 && status <= 599, "retry.statuses (RETRY_STATUSES)",
+			"%d is not an HTTP error status", status)
+	}
+
+	v.check(c.Reload.WatchInterval.Duration >= 0, "reload.watch_interval (CONFIG_WATCH_INTERVAL)",
+		"must not be negative, got %s", c.Reload.WatchInterval)
+
+	v.check(c.Accounts.RefreshInterval.Duration > 0, "accounts.refresh_interval (ACCOUNT_REFRESH_INTERVAL)",
+		"must be positive, got %s", c.Accounts.RefreshInterval)
+	v.check(c.Accounts.MaxStaleness.Duration >= 0, "accounts.max_staleness (ACCOUNT_MAX_STALENESS)",
+		"must not be negative, got %s", c.Accounts.MaxStaleness)
+	v.check(c.Accounts.ReconnectMinBackoff.Duration > 0, "accounts.reconnect_min_backoff (REDIS_RECONNECT_MIN_BACKOFF)",
+		"must be positive, got %s", c.Accounts.ReconnectMinBackoff)
+	v.check(c.Accounts.ReconnectMaxBackoff.Duration >= c.Accounts.ReconnectMinBackoff.Duration,
+		"accounts.reconnect_max_backoff (REDIS_RECONNECT_MAX_BACKOFF)", "must not be less than the minimum backoff %s",
+		c.Accounts.ReconnectMinBackoff)
+
+	if c.Capture.Enabled {
+		v.check(c.Capture.SampleRate > 0 && c.Capture.SampleRate <= 1, "capture.sample_rate (CAPTURE_SAMPLE_RATE)",
+			"must be in (0, 1], got %v", c.Capture.SampleRate)
+		v.oneOf("capture.storage (CAPTURE_STORAGE)", c.Capture.Storage, "memory", "file")
+		if c.Capture.Storage == "file" {
+			v.check(c.Capture.File != "", "capture.file (CAPTURE_FILE)", "must not be empty when storage is file")
+		} else {
+			v.check(c.Capture.RingSize > 0, "capture.ring_size (CAPTURE_RING_SIZE)",
+				"must be positive, got %d", c.Capture.RingSize)
+		}
+		v.check(c.Capture.MaxFileSize >= 0, "capture.max_file_size (CAPTURE_MAX_FILE_SIZE)",
+			"must not be negative, got %d", c.Capture.MaxFileSize)
+		v.check(c.Capture.MaxBackups >= 0, "capture.max_backups (CAPTURE_MAX_BACKUPS)",
+			"must not be negative, got %d", c.Capture.MaxBackups)
+		v.check(c.Capture.MaxBodySize >= 0, "capture.max_body_size (CAPTURE_MAX_BODY_SIZE)",
+			"must not be negative, got %d", c.Capture.MaxBodySize)
+	}
+
+	if c.AccessLog.Enabled {
+		v.check(c.AccessLog.Output != "", "access_log.output (ACCESS_LOG_OUTPUT)", "must be stdout or a file path")
+		v.check(c.AccessLog.MaxFileSize >= 0, "access_log.max_file_size (ACCESS_LOG_MAX_FILE_SIZE)",
+			"must not be negative, got %d", c.AccessLog.MaxFileSize)
+		v.check(c.AccessLog.MaxBackups >= 0, "access_log.max_backups (ACCESS_LOG_MAX_BACKUPS)",
+			"must not be negative, got %d", c.AccessLog.MaxBackups)
+	}
+
+	if c.Translate.OpenAI || c.Translate.Gemini {
+		v.check(strings.HasPrefix(c.Translate.MessagesPath, "/"), "translate.messages_path (TRANSLATE_MESSAGES_PATH)",
+			"must start with /, got %q", c.Translate.MessagesPath)
+		v.check(c.Translate.DefaultMaxTokens > 0, "translate.default_max_tokens (TRANSLATE_DEFAULT_MAX_TOKENS)",
+			"must be positive, got %d", c.Translate.DefaultMaxTokens)
+	}
+	if c.Translate.Gemini {
+		v.check(len(c.Translate.GeminiModels) > 0, "translate.gemini_models (TRANSLATE_GEMINI_MODELS)",
+			"must list at least one model prefix")
+		v.check(strings.HasPrefix(c.Translate.GeminiPath, "/") && strings.Contains(c.Translate.GeminiPath, "{model}") &&
+			strings.Contains(c.Translate.GeminiPath, "{method}"), "translate.gemini_path (TRANSLATE_GEMINI_PATH)",
+			"must start with / and contain {model} and {method}, got %q", c.Translate.GeminiPath)
+	}
+
+	if c.Fallback.Enabled {
+		v.check(validHeaderName(c.Fallback.ModelHeader), "fallback.model_header (FALLBACK_MODEL_HEADER)",
+			"must be a valid header name, got %q", c.Fallback.ModelHeader)
+		for model, chain := range c.Fallback.Chains {
+			field := fmt.Sprintf("fallback.chains[%s] (FALLBACK_CHAINS)", model)
+			v.check(len(chain) > 0, field, "must list at least one fallback model")
+			for _, next := range chain {
+				v.check(next != model && next != "", field, "must not contain %q", next)
+			}
+		}
+	}
+
+	if c.Hedge.Enabled {
+		v.check(c.Hedge.Percentile > 0 && c.Hedge.Percentile < 1, "hedge.percentile (HEDGE_PERCENTILE)",
+			"must be in (0, 1), got %v", c.Hedge.Percentile)
+		v.check(c.Hedge.MinDelay.Duration > 0, "hedge.min_delay (HEDGE_MIN_DELAY)",
+			"must be positive, got %v", c.Hedge.MinDelay.Duration)
+		v.check(c.Hedge.MaxDelay.Duration >= c.Hedge.MinDelay.Duration, "hedge.max_delay (HEDGE_MAX_DELAY)",
+			"must not be less than hedge.min_delay, got %v", c.Hedge.MaxDelay.Duration)
+		v.check(c.Hedge.MinSamples > 0, "hedge.min_samples (HEDGE_MIN_SAMPLES)",
+			"must be positive, got %d", c.Hedge.MinSamples)
+		v.check(c.Hedge.Window >= c.Hedge.MinSamples, "hedge.window (HEDGE_WINDOW)",
+			"must not be less than hedge.min_samples, got %d", c.Hedge.Window)
+		v.check(c.Hedge.MaxBodySize >= 0, "hedge.max_body_size (HEDGE_MAX_BODY_SIZE)",
+			"must not be negative, got %d", c.Hedge.MaxBodySize)
+	}
+
+	if c.Queue.Enabled {
+		v.check(c.Queue.MaxWait.Duration > 0, "queue.max_wait (QUEUE_MAX_WAIT)",
+			"must be positive, got %v", c.Queue.MaxWait.Duration)
+		v.check(c.Queue.MaxDepth > 0, "queue.max_depth (QUEUE_MAX_DEPTH)",
+			"must be positive, got %d", c.Queue.MaxDepth)
+		v.check(c.Queue.MaxPerClient > 0 && c.Queue.MaxPerClient <= c.Queue.MaxDepth, "queue.max_per_client (QUEUE_MAX_PER_CLIENT)",
+			"must be in [1, queue.max_depth], got %d", c.Queue.MaxPerClient)
+		v.check(c.Queue.PollInterval.Duration > 0, "queue.poll_interval (QUEUE_POLL_INTERVAL)",
+			"must be positive, got %v", c.Queue.PollInterval.Duration)
+	}
+
+	if c.Cache.Enabled {
+		v.check(c.Cache.Backend == "memory" || c.Cache.Backend == "redis", "cache.backend (CACHE_BACKEND)",
+			"must be memory or redis, got %q", c.Cache.Backend)
+		v.check(c.Cache.TTL.Duration > 0, "cache.ttl (CACHE_TTL)",
+			"must be positive, got %v", c.Cache.TTL.Duration)
+		v.check(c.Cache.Backend != "memory" || c.Cache.MaxEntries > 0, "cache.max_entries (CACHE_MAX_ENTRIES)",
+			"must be positive, got %d", c.Cache.MaxEntries)
+		v.check(c.Cache.MaxBodySize > 0, "cache.max_body_size (CACHE_MAX_BODY_SIZE)",
+			"must be positive, got %d", c.Cache.MaxBodySize)
+		v.check(len(c.Cache.Routes) > 0, "cache.routes (CACHE_ROUTES)", "must list at least one path prefix")
+		v.check(c.Cache.Backend != "redis" || c.Cache.KeyPrefix != "", "cache.key_prefix (CACHE_KEY_PREFIX)",
+			"must not be empty")
+		v.check(validHeaderName(c.Cache.StatusHeader), "cache.status_header (CACHE_STATUS_HEADER)",
+			"must be a valid header name, got %q", c.Cache.StatusHeader)
+	}
+
+	if c.Coalesce.Enabled {
+		v.check(len(c.Coalesce.Routes) > 0, "coalesce.routes (COALESCE_ROUTES)", "must list at least one path prefix")
+		v.check(c.Coalesce.MaxResponseSize > 0, "coalesce.max_response_size (COALESCE_MAX_RESPONSE_SIZE)",
+			"must be positive, got %d", c.Coalesce.MaxResponseSize)
+	}
+
+	seenModels := make(map[string]bool, len(c.Models.Registry))
+	for i, model := range c.Models.Registry {
+		field := fmt.Sprintf("models.registry[%d]", i)
+		v.check(model.ID != "", field+".id (MODELS_REGISTRY)", "must not be empty")
+		v.check(!seenModels[model.ID], field+".id (MODELS_REGISTRY)", "duplicate model %q", model.ID)
+		seenModels[model.ID] = true
+		if model.Created != "" {
+			_, err := time.Parse(time.DateOnly, model.Created)
+			v.check(err == nil, field+".created", "must be a date like 2025-05-14, got %q", model.Created)
+		}
+	}
+
+	// 账户、身份和签名头由中间层设置，规则不能修改
+	reserved := []string{c.Proxy.AccountHeader, c.Proxy.SignatureHeader, c.Proxy.IdentityHeader}
+	for i, rule := range c.Headers.Rules {
+		field := fmt.Sprintf("headers.rules[%d]", i)
+		v.check(rule.PathPrefix == "" || strings.HasPrefix(rule.PathPrefix, "/"), field+".path_prefix",
+			"must start with /, got %q", rule.PathPrefix)
+		v.headerActions(field+".request", rule.Request)
+		v.headerActions(field+".response", rule.Response)
+		for _, name := range rule.Request.names() {
+			for _, header := range reserved {
+				v.check(header == "" || !strings.EqualFold(name, header), field+".request",
+					"must not modify the upstream header %q", header)
+			}
+		}
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// validHeaderName 判断是否为合法的HTTP头名称（RFC 7230 token）
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// headerActions 校验请求头/响应头改写动作
+func (v *validator) headerActions(field string, actions HeaderActions) {
+	for _, name := range actions.Remove {
+		v.check(strings.TrimSuffix(name, "*") != "", field+".remove", "header name must not be empty")
+	}
+	for i, rewrite := range actions.Rewrite {
+		rewriteField := fmt.Sprintf("%s.rewrite[%d]", field, i)
+		v.check(rewrite.Name != "", rewriteField+".name", "must not be empty")
+		if _, err := regexp.Compile(rewrite.Pattern); err != nil {
+			v.check(false, rewriteField+".pattern", "invalid regular expression: %v", err)
+		}
+	}
+	for name := range actions.Set {
+		v.check(name != "", field+".set", "header name must not be empty")
+	}
+	for name := range actions.Add {
+		v.check(name != "", field+".add", "header name must not be empty")
+	}
+}
+
+// names 动作涉及的所有头名称（删除的前缀匹配去掉末尾的*）
+func (actions HeaderActions) names() []string {
+	var names []string
+	for _, name := range actions.Remove {
+		names = append(names, strings.TrimSuffix(name, "*"))
+	}
+	for _, rewrite := range actions.Rewrite {
+		names = append(names, rewrite.Name)
+	}
+	for name := range actions.Set {
+		names = append(names, name)
+	}
+	for name := range actions.Add {
+		names = append(names, name)
+	}
+	return names
+}
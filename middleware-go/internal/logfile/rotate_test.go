@@ -0,0 +1,106 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "app.log")
+	file, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	file.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path, "gggg\n"},
+		{path + ".1", "eeee\nffff\n"},
+		{path + ".2", "cccc\ndddd\n"},
+	}
+	for _, tt := range tests {
+		if got := readFile(t, tt.path); got != tt.want {
+			t.Errorf("%s = %q, want %q", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("app.log.3 exists, want at most 2 backups")
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := Open(path, 8, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	file.Write([]byte("first\n"))
+	file.Write([]byte("second\n"))
+	file.Close()
+
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("app.log = %q, want only the latest record", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Error("app.log.1 exists, want no backups")
+	}
+}
+
+func TestRotatingFileAppendsAndCountsExistingSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("existing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Open(path, 12, 1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	file.Write([]byte("next\n"))
+	file.Close()
+
+	if got := readFile(t, path+".1"); got != "existing\n" {
+		t.Errorf("app.log.1 = %q, want the existing content", got)
+	}
+	if got := readFile(t, path); got != "next\n" {
+		t.Errorf("app.log = %q, want next", got)
+	}
+}
+
+func TestRotatingFileUnlimited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := Open(path, 0, 3)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		file.Write([]byte("line\n"))
+	}
+	file.Close()
+
+	if got := strings.Count(readFile(t, path), "\n"); got != 100 {
+		t.Errorf("app.log has %d lines, want 100", got)
+	}
+	if _, err := file.Write([]byte("x")); err != os.ErrClosed {
+		t.Errorf("Write after Close = %v, want os.ErrClosed", err)
+	}
+}
@@ -0,0 +1,284 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 所有指标名称的统一前缀
+const namespace = "claude_middleware_"
+
+// metric 可以输出为Prometheus文本格式的指标
+type metric interface {
+	write(sb *strings.Builder)
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu      sync.RWMutex
+	metrics []metric
+}
+
+// Default 默认注册表
+var Default = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// ServeHTTP 以Prometheus文本格式输出所有指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var sb strings.Builder
+
+	r.mu.RLock()
+	for _, m := range r.metrics {
+		m.write(&sb)
+	}
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(sb.String()))
+}
+
+// Handler 返回默认注册表的HTTP处理器
+func Handler() http.Handler {
+	return Default
+}
+
+// vec 带标签的指标值集合
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]float64 // 标签值（\xff分隔） -> 指标值
+}
+
+func newVec(name, help, kind string, labelNames []string) *vec {
+	return &vec{
+		name:       namespace + name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+	}
+}
+
+// labelKey 拼接标签值，数量与标签名不一致时记录日志并返回false，丢弃本次更新而不影响请求处理
+func labelKey(name string, labelNames, labelValues []string) (string, bool) {
+	if len(labelValues) != len(labelNames) {
+		log.Printf("⚠️  Metric %s expects %d labels, got %d, dropping update", name, len(labelNames), len(labelValues))
+		return "", false
+	}
+	return strings.Join(labelValues, "\xff"), true
+}
+
+func (v *vec) add(labelValues []string, delta float64) {
+	key, ok := labelKey(v.name, v.labelNames, labelValues)
+	if !ok {
+		return
+	}
+	v.mu.Lock()
+	v.values[key] += delta
+	v.mu.Unlock()
+}
+
+func (v *vec) set(labelValues []string, value float64) {
+	key, ok := labelKey(v.name, v.labelNames, labelValues)
+	if !ok {
+		return
+	}
+	v.mu.Lock()
+	v.values[key] = value
+	v.mu.Unlock()
+}
+
+func (v *vec) write(sb *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(sb, "%s%s %s\n", v.name, formatLabels(v.labelNames, key, ""), formatValue(v.values[key]))
+	}
+}
+
+// CounterVec 只增计数器
+type CounterVec struct{ v *vec }
+
+// NewCounter 创建并注册计数器
+func NewCounter(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{v: newVec(name, help, "counter", labelNames)}
+	Default.register(c.v)
+	return c
+}
+
+// Inc 计数加一
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.v.add(labelValues, 1)
+}
+
+// Add 计数增加delta
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.v.add(labelValues, delta)
+}
+
+// GaugeVec 可增可减的仪表
+type GaugeVec struct{ v *vec }
+
+// NewGauge 创建并注册仪表
+func NewGauge(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{v: newVec(name, help, "gauge", labelNames)}
+	Default.register(g.v)
+	return g
+}
+
+// Set 设置当前值
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.set(labelValues, value)
+}
+
+// Add 当前值增加delta（可为负数）
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.add(labelValues, delta)
+}
+
+// Reset 清空所有标签组合，用于整体重新统计
+func (g *GaugeVec) Reset() {
+	g.v.mu.Lock()
+	g.v.values = make(map[string]float64)
+	g.v.mu.Unlock()
+}
+
+// HistogramVec 直方图
+type HistogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // 与buckets一一对应（非累计）
+	count  uint64
+	sum    float64
+}
+
+// DefaultBuckets 默认的耗时分桶（秒）
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// NewHistogram 创建并注册直方图
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:       namespace + name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*histogram),
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key, ok := labelKey(h.name, h.labelNames, labelValues)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			series.counts[i]++
+			break
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *HistogramVec) write(sb *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		series := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += series.counts[i]
+			le := "le=\"" + formatValue(upper) + "\""
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, key, le), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, key, "le=\"+Inf\""), series.count)
+		fmt.Fprintf(sb, "%s_sum%s %s\n", h.name, formatLabels(h.labelNames, key, ""), formatValue(series.sum))
+		fmt.Fprintf(sb, "%s_count%s %d\n", h.name, formatLabels(h.labelNames, key, ""), series.count)
+	}
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels 拼接标签，extra为附加的已格式化标签（如le）
+func formatLabels(labelNames []string, key string, extra string) string {
+	var pairs []string
+	if len(labelNames) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, labelNames[i]+"=\""+escapeLabel(value)+"\"")
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "\n", "\\n")
+	return strings.ReplaceAll(value, "\"", "\\\"")
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
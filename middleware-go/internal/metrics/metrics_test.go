@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape 返回默认注册表中以name开头的指标行
+func scrape(t *testing.T, name string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, namespace+name) || strings.Contains(line, " "+namespace+name+" ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCounter(t *testing.T) {
+	counter := NewCounter("test_requests_total", "Test requests", "account", "status")
+	counter.Inc("acc1", "200")
+	counter.Inc("acc1", "200")
+	counter.Add(2.5, "acc2", "429")
+
+	want := `# HELP claude_middleware_test_requests_total Test requests
+# TYPE claude_middleware_test_requests_total counter
+claude_middleware_test_requests_total{account="acc1",status="200"} 2
+claude_middleware_test_requests_total{account="acc2",status="429"} 2.5`
+	if got := scrape(t, "test_requests_total"); got != want {
+		t.Errorf("scrape =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	gauge := NewGauge("test_in_flight", "Test gauge", "account")
+	gauge.Set(3, "acc1")
+	gauge.Add(-1, "acc1")
+	gauge.Add(1, `a"b\c`+"\n")
+
+	want := `# HELP claude_middleware_test_in_flight Test gauge
+# TYPE claude_middleware_test_in_flight gauge
+claude_middleware_test_in_flight{account="a\"b\\c\n"} 1
+claude_middleware_test_in_flight{account="acc1"} 2`
+	if got := scrape(t, "test_in_flight"); got != want {
+		t.Errorf("scrape =\n%s\nwant\n%s", got, want)
+	}
+
+	gauge.Reset()
+	if got := scrape(t, "test_in_flight"); strings.Contains(got, "acc1") {
+		t.Errorf("Reset() kept series:\n%s", got)
+	}
+}
+
+func TestGaugeWithoutLabels(t *testing.T) {
+	gauge := NewGauge("test_up", "Test unlabeled gauge")
+	gauge.Set(1)
+	if got := scrape(t, "test_up"); !strings.HasSuffix(got, "\nclaude_middleware_test_up 1") {
+		t.Errorf("scrape =\n%s", got)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram("test_wait_seconds", "Test histogram", []float64{0.1, 1}, "pool")
+	histogram.Observe(0.05, "p1")
+	histogram.Observe(0.5, "p1")
+	histogram.Observe(5, "p1")
+
+	want := `# HELP claude_middleware_test_wait_seconds Test histogram
+# TYPE claude_middleware_test_wait_seconds histogram
+claude_middleware_test_wait_seconds_bucket{pool="p1",le="0.1"} 1
+claude_middleware_test_wait_seconds_bucket{pool="p1",le="1"} 2
+claude_middleware_test_wait_seconds_bucket{pool="p1",le="+Inf"} 3
+claude_middleware_test_wait_seconds_sum{pool="p1"} 5.55
+claude_middleware_test_wait_seconds_count{pool="p1"} 3`
+	if got := scrape(t, "test_wait_seconds"); got != want {
+		t.Errorf("scrape =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestLabelMismatchDropsUpdate 标签数量错误时丢弃更新，不能让请求处理panic
+func TestLabelMismatchDropsUpdate(t *testing.T) {
+	counter := NewCounter("test_mismatch_total", "Test mismatch", "account")
+	gauge := NewGauge("test_mismatch_gauge", "Test mismatch", "account")
+	histogram := NewHistogram("test_mismatch_seconds", "Test mismatch", DefaultBuckets, "account")
+
+	counter.Inc()
+	counter.Add(1, "acc1", "extra")
+	gauge.Set(1)
+	histogram.Observe(1, "acc1", "extra")
+
+	for _, name := range []string{"test_mismatch_total", "test_mismatch_gauge", "test_mismatch_seconds"} {
+		if got := scrape(t, name); strings.Count(got, "\n") != 1 {
+			t.Errorf("%s has series after mismatched updates:\n%s", name, got)
+		}
+	}
+}
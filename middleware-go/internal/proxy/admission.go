@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
+)
+
+var (
+	admissionQueueDepth = metrics.NewGauge("admission_queue_depth",
+		"Number of requests waiting in the admission queue for an available account")
+	admissionWaitSeconds = metrics.NewHistogram("admission_wait_seconds",
+		"Time requests spent in the admission queue, by outcome (admitted, timeout, cancelled)", metrics.DefaultBuckets, "outcome")
+	admissionRejections = metrics.NewCounter("admission_rejections_total",
+		"Number of requests rejected by the admission queue, by reason (queue_full, timeout)", "reason")
+)
+
+var (
+	// errNoReadyAccount 所有候选账户都在冷却中
+	errNoReadyAccount = errors.New("all accounts are cooling down")
+	// errQueueFull 排队请求数已达上限
+	errQueueFull = errors.New("admission queue is full")
+	// errQueueTimeout 排队超时仍没有可用账户
+	errQueueTimeout = errors.New("timed out waiting for an available account")
+	// errQueueCancelled 客户端在排队时断开
+	errQueueCancelled = errors.New("client disconnected while queued")
+)
+
+// admissionWaiter 排队等待账户的请求
+type admissionWaiter struct {
+	try       func() (string, error) // 尝试选择完全可用的账户
+	done      chan struct{}          // 分配结果后关闭
+	accountID string
+	err       error
+
+	// 以下字段由队列的锁保护
+	dispatching bool // 调度正在（不持有锁）为该请求选择账户
+	abandoned   bool // 选择期间请求已超时或客户端断开，选择结束后由调度移出队列
+}
+
+// admissionQueue 没有可用账户时的准入队列
+//
+// 每个客户端一个FIFO队列，分配账户时按客户端轮转，每轮每个客户端最多放行一个请求，
+// 避免单个客户端的大量请求占满刚结束冷却的账户。
+type admissionQueue struct {
+	mu      sync.Mutex
+	waiters map[string][]*admissionWaiter // 客户端ID -> 排队的请求
+	clients []string                      // 有排队请求的客户端，按轮转顺序
+	depth   int
+	wake    chan struct{}
+}
+
+func newAdmissionQueue() *admissionQueue {
+	return &admissionQueue{
+		waiters: make(map[string][]*admissionWaiter),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// notify 唤醒调度，在账户可能变为可用时调用
+func (q *admissionQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queued 是否有请求在排队
+func (q *admissionQueue) queued() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth > 0
+}
+
+// wait 加入客户端的队列，直到分配到账户、超时或客户端断开
+func (q *admissionQueue) wait(ctx context.Context, cfg config.QueueConfig, clientID string, try func() (string, error)) (string, error) {
+	w := &admissionWaiter{try: try, done: make(chan struct{})}
+
+	q.mu.Lock()
+	if q.depth >= cfg.MaxDepth || len(q.waiters[clientID]) >= cfg.MaxPerClient {
+		q.mu.Unlock()
+		admissionRejections.Inc("queue_full")
+		return "", errQueueFull
+	}
+	if len(q.waiters[clientID]) == 0 {
+		q.clients = append(q.clients, clientID)
+	}
+	q.waiters[clientID] = append(q.waiters[clientID], w)
+	q.depth++
+	admissionQueueDepth.Set(float64(q.depth))
+	q.mu.Unlock()
+
+	q.notify()
+	queuedAt := time.Now()
+	timer := time.NewTimer(cfg.MaxWait.Duration)
+	defer timer.Stop()
+
+	outcome, err := "timeout", errQueueTimeout
+	select {
+	case <-w.done:
+		admissionWaitSeconds.Observe(time.Since(queuedAt).Seconds(), "admitted")
+		return w.accountID, w.err
+	case <-timer.C:
+	case <-ctx.Done():
+		outcome, err = "cancelled", errQueueCancelled
+	}
+
+	q.mu.Lock()
+	removed := false
+	if w.dispatching {
+		w.abandoned = true
+	} else {
+		removed = q.remove(clientID, w)
+	}
+	q.mu.Unlock()
+	if !removed {
+		// 超时的同时已被分配账户或正在选择账户，等待选择结果
+		<-w.done
+		if w.err != errNoReadyAccount {
+			admissionWaitSeconds.Observe(time.Since(queuedAt).Seconds(), "admitted")
+			return w.accountID, w.err
+		}
+	}
+
+	admissionWaitSeconds.Observe(time.Since(queuedAt).Seconds(), outcome)
+	if outcome == "timeout" {
+		admissionRejections.Inc("timeout")
+	}
+	return "", err
+}
+
+// dispatch 按客户端轮转为排队的请求分配账户，直到没有请求能再分配
+// 选择账户时不持有队列的锁，避免选择期间阻塞新请求入队和超时的请求离开队列
+func (q *admissionQueue) dispatch() {
+	for progress := true; progress; {
+		progress = false
+
+		q.mu.Lock()
+		clients := append([]string(nil), q.clients...)
+		q.mu.Unlock()
+
+		for _, clientID := range clients {
+			q.mu.Lock()
+			waiters := q.waiters[clientID]
+			if len(waiters) == 0 || waiters[0].dispatching {
+				q.mu.Unlock()
+				continue
+			}
+			w := waiters[0]
+			w.dispatching = true
+			q.mu.Unlock()
+
+			accountID, err := w.try()
+
+			q.mu.Lock()
+			w.dispatching = false
+			if err == errNoReadyAccount && !w.abandoned {
+				q.mu.Unlock()
+				continue
+			}
+			// 分配到账户、出现排队无法解决的错误，或请求已放弃（err为errNoReadyAccount）
+			w.accountID, w.err = accountID, err
+			close(w.done)
+			q.remove(clientID, w)
+			if len(q.waiters[clientID]) > 0 {
+				q.moveToBack(clientID)
+			}
+			q.mu.Unlock()
+			progress = progress || err != errNoReadyAccount
+		}
+	}
+}
+
+// remove 将请求移出队列，返回false表示请求已不在队列中，调用方需持有锁
+func (q *admissionQueue) remove(clientID string, w *admissionWaiter) bool {
+	waiters := q.waiters[clientID]
+	for i, waiter := range waiters {
+		if waiter != w {
+			continue
+		}
+		waiters = append(waiters[:i], waiters[i+1:]...)
+		if len(waiters) > 0 {
+			q.waiters[clientID] = waiters
+		} else {
+			delete(q.waiters, clientID)
+			q.removeClient(clientID)
+		}
+		q.depth--
+		admissionQueueDepth.Set(float64(q.depth))
+		return true
+	}
+	return false
+}
+
+// moveToBack 将客户端移到轮转顺序的末尾，调用方需持有锁
+func (q *admissionQueue) moveToBack(clientID string) {
+	q.removeClient(clientID)
+	q.clients = append(q.clients, clientID)
+}
+
+func (q *admissionQueue) removeClient(clientID string) {
+	for i, id := range q.clients {
+		if id == clientID {
+			q.clients = append(q.clients[:i], q.clients[i+1:]...)
+			return
+		}
+	}
+}
+
+// acquireAccount 为请求选择账户
+//
+// 启用排队时只使用完全可用的账户：所有账户都在冷却时（或已有请求在排队时）进入准入队列等待，
+// 返回排队的时间。未启用时保持原有行为，没有可用账户时使用限流或有问题的账户。
+func (s *Service) acquireAccount(ctx context.Context, apiKey string, client clientIdentity) (string, time.Duration, error) {
+	cfg := s.cfg().Queue
+	if !cfg.Enabled {
+		accountID, err := s.selectAvailableAccount(apiKey)
+		return accountID, 0, err
+	}
+
+	// 已有请求在排队时不插队，由调度按客户端轮流分配
+	if !s.admission.queued() {
+		accountID, err := s.selectReadyAccount(apiKey)
+		if err != errNoReadyAccount {
+			return accountID, 0, err
+		}
+	}
+
+	log.Printf("⏳ No available account for client %s, queueing (max wait %v)", client, cfg.MaxWait.Duration)
+	queuedAt := time.Now()
+	accountID, err := s.admission.wait(ctx, cfg, client.ID, func() (string, error) {
+		return s.selectReadyAccount(apiKey)
+	})
+	return accountID, time.Since(queuedAt), err
+}
+
+// admissionWorker 定期检查排队的请求能否分配到账户（账户冷却结束），有新请求或账户刷新时立即检查
+func (s *Service) admissionWorker() {
+	for {
+		select {
+		case <-s.admission.wake:
+		case <-time.After(s.cfg().Queue.PollInterval.Duration):
+		}
+		s.admission.dispatch()
+	}
+}
+
+// retryAfter 建议客户端重试的秒数：请求可以使用的账户中最早结束冷却的剩余时间，没有冷却中的账户时使用最长排队时间
+func (s *Service) retryAfter(apiKey string) int {
+	now := time.Now()
+	rateLimitCooldown := s.cfg().Cooldown.RateLimit.Duration
+	candidates := s.candidateAccounts(apiKey)
+
+	var earliest time.Duration
+	consider := func(accountID string, until time.Time) {
+		if candidates != nil && !candidates[accountID] {
+			return
+		}
+		if remaining := until.Sub(now); remaining > 0 && (earliest == 0 || remaining < earliest) {
+			earliest = remaining
+		}
+	}
+	s.rateLimitMutex.RLock()
+	for accountID, rateLimitedAt := range s.rateLimitedCache {
+		consider(accountID, rateLimitedAt.Add(rateLimitCooldown))
+	}
+	for accountID, disabledUntil := range s.problematicCache {
+		consider(accountID, disabledUntil)
+	}
+	s.rateLimitMutex.RUnlock()
+
+	if earliest == 0 {
+		earliest = s.cfg().Queue.MaxWait.Duration
+	}
+	return int(math.Max(1, math.Ceil(earliest.Seconds())))
+}
+
+// candidateAccounts 请求可以使用的账户（专属账户和共享池中的账户），返回nil表示不限制
+// 无法查询API Key的关联信息时不限制，只影响建议的重试时间
+func (s *Service) candidateAccounts(apiKey string) map[string]bool {
+	boundIDs, err := s.boundAccountIDs(apiKey)
+	if err != nil {
+		return nil
+	}
+	candidates := make(map[string]bool)
+	for _, id := range boundIDs {
+		candidates[id] = true
+	}
+	if len(boundIDs) > 0 && s.cfg().Binding.FallbackPolicy == bindingFallbackReject {
+		return candidates
+	}
+
+	pools, err := s.resolvePools(apiKey)
+	if err != nil || pools == nil {
+		return nil
+	}
+	for _, pool := range pools {
+		for _, id := range pool.AccountIDs {
+			candidates[id] = true
+		}
+	}
+	return candidates
+}
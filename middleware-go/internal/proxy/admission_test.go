@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/redis"
+)
+
+func queueConfig(maxWait time.Duration) config.QueueConfig {
+	return config.QueueConfig{Enabled: true, MaxWait: config.Duration{Duration: maxWait}, MaxDepth: 10, MaxPerClient: 10}
+}
+
+type waitResult struct {
+	accountID string
+	err       error
+}
+
+// enqueue 在后台加入队列，返回结果通道，等到请求进入队列后返回
+func enqueue(t *testing.T, q *admissionQueue, cfg config.QueueConfig, clientID string, try func() (string, error)) <-chan waitResult {
+	t.Helper()
+	q.mu.Lock()
+	depth := q.depth
+	q.mu.Unlock()
+
+	result := make(chan waitResult, 1)
+	go func() {
+		accountID, err := q.wait(context.Background(), cfg, clientID, try)
+		result <- waitResult{accountID, err}
+	}()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		q.mu.Lock()
+		queued := q.depth > depth
+		q.mu.Unlock()
+		if queued {
+			return result
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("request was not queued")
+		}
+	}
+}
+
+func TestAdmissionDispatchRoundRobin(t *testing.T) {
+	q := newAdmissionQueue()
+	cfg := queueConfig(time.Second)
+	ready := false
+	var order []string
+	try := func(clientID string) func() (string, error) {
+		return func() (string, error) {
+			if !ready {
+				return "", errNoReadyAccount
+			}
+			order = append(order, clientID)
+			return "acc-" + clientID, nil
+		}
+	}
+
+	results := []<-chan waitResult{
+		enqueue(t, q, cfg, "a", try("a")),
+		enqueue(t, q, cfg, "a", try("a")),
+		enqueue(t, q, cfg, "b", try("b")),
+	}
+
+	q.dispatch()
+	if q.depth != 3 {
+		t.Fatalf("depth = %d after dispatch without ready accounts, want 3", q.depth)
+	}
+
+	ready = true
+	q.dispatch()
+	for _, result := range results {
+		if r := <-result; r.err != nil || r.accountID == "" {
+			t.Errorf("wait() = %q, %v", r.accountID, r.err)
+		}
+	}
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "a" {
+		t.Errorf("dispatch order = %v, want a,b,a", order)
+	}
+}
+
+// TestAdmissionDispatchUnlocked 选择账户时不持有队列的锁
+func TestAdmissionDispatchUnlocked(t *testing.T) {
+	q := newAdmissionQueue()
+	result := enqueue(t, q, queueConfig(time.Second), "a", func() (string, error) {
+		// 持有锁时调用会死锁
+		q.queued()
+		return "acc1", nil
+	})
+
+	dispatched := make(chan struct{})
+	go func() {
+		q.dispatch()
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch holds the queue lock while selecting an account")
+	}
+	if r := <-result; r.accountID != "acc1" || r.err != nil {
+		t.Errorf("wait() = %q, %v, want acc1", r.accountID, r.err)
+	}
+}
+
+// TestAdmissionTimeoutWhileDispatching 选择账户期间超时的请求在选择失败后返回超时
+func TestAdmissionTimeoutWhileDispatching(t *testing.T) {
+	q := newAdmissionQueue()
+	selecting := make(chan struct{})
+	release := make(chan struct{})
+	result := enqueue(t, q, queueConfig(20*time.Millisecond), "a", func() (string, error) {
+		close(selecting)
+		<-release
+		return "", errNoReadyAccount
+	})
+
+	go q.dispatch()
+	<-selecting
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case r := <-result:
+		if r.err != errQueueTimeout {
+			t.Errorf("wait() error = %v, want %v", r.err, errQueueTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out request was never released")
+	}
+	if q.queued() {
+		t.Error("timed out request is still queued")
+	}
+}
+
+func TestRetryAfterUsesCallerAccounts(t *testing.T) {
+	t.Setenv("SHARED_POOL_ENABLED", "true")
+	t.Setenv("ACCOUNT_BINDINGS", "bound-key:acc3")
+	t.Setenv("BOUND_ACCOUNT_FALLBACK", "reject")
+	t.Setenv("COOLDOWN_RATE_LIMIT", "60s")
+	t.Setenv("QUEUE_MAX_WAIT", "30s")
+	s := newConfigService(t)
+	s.sharedPools = []redis.SharedPool{
+		{ID: "p1", IsActive: true, AccountIDs: []string{"acc1"}},
+		{ID: "p2", IsActive: true, AccountIDs: []string{"acc2"}},
+	}
+	fresh := time.Now().Add(time.Minute)
+	s.keyInfoCache = map[string]keyInfoEntry{
+		"pool1-key":   {keyID: "k1", poolIDs: []string{"p1"}, expiresAt: fresh},
+		"pool2-key":   {keyID: "k2", poolIDs: []string{"p2"}, expiresAt: fresh},
+		"default-key": {keyID: "k3", expiresAt: fresh},
+	}
+	now := time.Now()
+	s.rateLimitedCache = map[string]time.Time{"acc1": now.Add(-50 * time.Second)}
+	s.problematicCache = map[string]time.Time{"acc2": now.Add(40 * time.Second), "acc3": now.Add(20 * time.Second)}
+
+	tests := []struct {
+		apiKey string
+		want   int
+	}{
+		{"pool1-key", 10},
+		{"pool2-key", 40},
+		{"bound-key", 20},
+		// 没有默认共享池时可以使用所有共享池
+		{"default-key", 10},
+		// 无法查询关联信息时不限制账户范围
+		{"uncached", 10},
+	}
+	for _, tt := range tests {
+		if got := s.retryAfter(tt.apiKey); got != tt.want {
+			t.Errorf("retryAfter(%s) = %d, want %d", tt.apiKey, got, tt.want)
+		}
+	}
+
+	// 账户都没有冷却时使用最长排队时间
+	s.rateLimitedCache = map[string]time.Time{}
+	if got := s.retryAfter("pool2-key"); got != 40 {
+		t.Errorf("retryAfter(pool2-key) = %d, want 40", got)
+	}
+	s.problematicCache = map[string]time.Time{}
+	if got := s.retryAfter("pool2-key"); got != 30 {
+		t.Errorf("retryAfter(pool2-key) = %d, want 30", got)
+	}
+}
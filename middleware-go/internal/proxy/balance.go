@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"claude-middleware/internal/metrics"
+	"claude-middleware/internal/redis"
+	"claude-middleware/internal/tokens"
+)
+
+var accountTokenRate = metrics.NewGauge("account_estimated_tokens_per_minute",
+	"Estimated input tokens sent to each account, averaged per minute over the selection token window", "account")
+
+// tokenEvent 一次发往账户的请求的估算输入Token数
+type tokenEvent struct {
+	at     time.Time
+	tokens int
+}
+
+// tokenMeter 每个账户在最近的时间窗口内发送的估算输入Token数（仅内存）
+type tokenMeter struct {
+	mu     sync.Mutex
+	events map[string][]tokenEvent
+}
+
+// add 记录发往账户的请求，并清理窗口外的记录
+func (m *tokenMeter) add(accountID string, estimated int, window time.Duration) {
+	now := time.Now()
+
+	m.mu.Lock()
+	if m.events == nil {
+		m.events = make(map[string][]tokenEvent)
+	}
+	events := append(prune(m.events[accountID], now.Add(-window)), tokenEvent{at: now, tokens: estimated})
+	m.events[accountID] = events
+	total := sumTokens(events)
+	m.mu.Unlock()
+
+	accountTokenRate.Set(float64(total)*float64(time.Minute)/float64(window), accountID)
+}
+
+// total 账户在窗口内的估算输入Token总数
+func (m *tokenMeter) total(accountID string, window time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := prune(m.events[accountID], time.Now().Add(-window))
+	if len(events) == 0 {
+		delete(m.events, accountID)
+		return 0
+	}
+	m.events[accountID] = events
+	return sumTokens(events)
+}
+
+// prune 去掉since之前的记录（记录按时间顺序追加）
+func prune(events []tokenEvent, since time.Time) []tokenEvent {
+	i := 0
+	for i < len(events) && events[i].at.Before(since) {
+		i++
+	}
+	return events[i:]
+}
+
+func sumTokens(events []tokenEvent) int {
+	total := 0
+	for _, event := range events {
+		total += event.tokens
+	}
+	return total
+}
+
+// estimateInputTokens 使用least_tokens策略时估算请求体的输入Token数，其余策略不需要估算，返回0
+func (s *Service) estimateInputTokens(body *requestBody) int {
+	if s.cfg().Selection.Strategy != strategyLeastTokens || body.Len() == 0 {
+		return 0
+	}
+	reader, err := body.Reader()
+	if err != nil {
+		return 0
+	}
+	defer reader.Close()
+
+	estimated, err := tokens.EstimateReader(reader)
+	if err != nil {
+		log.Printf("⚠️  Failed to estimate input tokens: %v", err)
+		return 0
+	}
+	return estimated
+}
+
+// chargeTokens 记录发往账户的估算输入Token数
+func (s *Service) chargeTokens(accountID string, estimated int) {
+	if estimated > 0 {
+		s.tokenMeter.add(accountID, estimated, s.cfg().Selection.TokenWindow.Duration)
+	}
+}
+
+// sortByEstimatedTokens 按窗口内的估算输入Token数排序，最少的在前，相同时最久未使用的在前
+func (s *Service) sortByEstimatedTokens(accounts []redis.ClaudeAccount) {
+	window := s.cfg().Selection.TokenWindow.Duration
+	totals := make(map[string]int, len(accounts))
+	for _, account := range accounts {
+		totals[account.ID] = s.tokenMeter.total(account.ID, window)
+	}
+
+	sortByLastUsed(accounts)
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return totals[accounts[i].ID] < totals[accounts[j].ID]
+	})
+}
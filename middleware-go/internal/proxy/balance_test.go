@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/redis"
+)
+
+// newConfigService 使用默认配置（及t.Setenv设置的环境变量）创建不连接Redis和上游的Service
+func newConfigService(t *testing.T) *Service {
+	t.Helper()
+	configs, err := config.NewManager("")
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return &Service{configs: configs, roundRobinIndex: make(map[string]uint64)}
+}
+
+func accountIDs(accounts []redis.ClaudeAccount) string {
+	ids := make([]string, len(accounts))
+	for i, account := range accounts {
+		ids[i] = account.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestTokenMeter(t *testing.T) {
+	var meter tokenMeter
+	meter.add("acc1", 100, time.Minute)
+	meter.add("acc1", 50, time.Minute)
+	meter.add("acc2", 10, time.Minute)
+
+	if got := meter.total("acc1", time.Minute); got != 150 {
+		t.Errorf("total(acc1) = %d, want 150", got)
+	}
+	if got := meter.total("acc2", time.Minute); got != 10 {
+		t.Errorf("total(acc2) = %d, want 10", got)
+	}
+	if got := meter.total("acc3", time.Minute); got != 0 {
+		t.Errorf("total(acc3) = %d, want 0", got)
+	}
+}
+
+func TestTokenMeterPrunesOutsideWindow(t *testing.T) {
+	var meter tokenMeter
+	window := 50 * time.Millisecond
+	meter.add("acc1", 100, window)
+	time.Sleep(2 * window)
+	meter.add("acc1", 20, window)
+
+	if got := meter.total("acc1", window); got != 20 {
+		t.Errorf("total(acc1) = %d, want 20 after the first request left the window", got)
+	}
+	time.Sleep(2 * window)
+	if got := meter.total("acc1", window); got != 0 {
+		t.Errorf("total(acc1) = %d, want 0", got)
+	}
+	if _, ok := meter.events["acc1"]; ok {
+		t.Error("empty account not removed from the meter")
+	}
+}
+
+func TestSortByEstimatedTokens(t *testing.T) {
+	s := newConfigService(t)
+	s.chargeTokens("busy", 5000)
+	s.chargeTokens("light", 100)
+
+	accounts := []redis.ClaudeAccount{
+		{ID: "busy", LastUsedAt: "2024-01-01T00:00:00Z"},
+		{ID: "light", LastUsedAt: "2024-01-01T00:00:00Z"},
+		{ID: "idle-recent", LastUsedAt: "2024-01-03T00:00:00Z"},
+		{ID: "idle-old", LastUsedAt: "2024-01-02T00:00:00Z"},
+	}
+	s.sortByEstimatedTokens(accounts)
+
+	if got, want := accountIDs(accounts), "idle-old,idle-recent,light,busy"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestChargeTokensIgnoresZero(t *testing.T) {
+	s := newConfigService(t)
+	s.chargeTokens("acc1", 0)
+	if len(s.tokenMeter.events) != 0 {
+		t.Errorf("events = %v, want none", s.tokenMeter.events)
+	}
+}
+
+func TestEstimateInputTokens(t *testing.T) {
+	payload := `{"system":"` + strings.Repeat("a", 400) + `","messages":[]}`
+
+	tests := []struct {
+		strategy string
+		body     string
+		want     int
+	}{
+		{strategyLeastTokens, payload, 100},
+		{strategyLeastTokens, "", 0},
+		{strategyLeastUsed, payload, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Setenv("SELECTION_STRATEGY", tt.strategy)
+			s := newConfigService(t)
+			body, err := readRequestBody(strings.NewReader(tt.body), 1<<20, "")
+			if err != nil {
+				t.Fatalf("readRequestBody: %v", err)
+			}
+			defer body.Close()
+
+			if got := s.estimateInputTokens(body); got != tt.want {
+				t.Errorf("estimateInputTokens() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickByStrategyLeastTokens(t *testing.T) {
+	accounts := func() []redis.ClaudeAccount {
+		return []redis.ClaudeAccount{
+			{ID: "acc1", LastUsedAt: "2024-01-01T00:00:00Z"},
+			{ID: "acc2", LastUsedAt: "2024-01-02T00:00:00Z"},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		global       string
+		poolStrategy string
+		want         string
+	}{
+		{"pool strategy", strategyLeastUsed, strategyLeastTokens, "acc2"},
+		{"global strategy", strategyLeastTokens, "", "acc2"},
+		{"least used ignores tokens", strategyLeastUsed, "", "acc1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SELECTION_STRATEGY", tt.global)
+			s := newConfigService(t)
+			s.chargeTokens("acc1", 1000)
+
+			pool := redis.SharedPool{ID: "pool1", AccountSelectionStrategy: tt.poolStrategy}
+			if got := s.pickByStrategy(pool, accounts()); got.ID != tt.want {
+				t.Errorf("picked %s, want %s", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeastTokensSpreadsRequests(t *testing.T) {
+	t.Setenv("SELECTION_STRATEGY", strategyLeastTokens)
+	s := newConfigService(t)
+	pool := redis.SharedPool{ID: "pool1"}
+	available := []redis.ClaudeAccount{{ID: "acc1"}, {ID: "acc2"}, {ID: "acc3"}}
+
+	// 大请求之后的小请求应避开已承担大请求的账户
+	sizes := []int{8000, 100, 100, 100, 100}
+	picks := make(map[string]int)
+	for _, size := range sizes {
+		picked := s.pickByStrategy(pool, append([]redis.ClaudeAccount(nil), available...))
+		s.chargeTokens(picked.ID, size)
+		picks[picked.ID] += size
+	}
+	for id, total := range picks {
+		if total > 8000 {
+			t.Errorf("%s received %d tokens, want large request isolated", id, total)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+
+	"claude-middleware/internal/redis"
+)
+
+// 专属账户不可用时的处理策略
+const (
+	bindingFallbackShared = "shared"
+	bindingFallbackReject = "reject"
+)
+
+// errBoundAccountUnavailable 专属账户不可用且策略为拒绝
+var errBoundAccountUnavailable = errors.New("bound account is unavailable")
+
+// boundAccountIDs 获取API Key绑定的专属账户（中间层配置优先，其次是Node.js的绑定）
+// 无法查询绑定关系时返回errKeyInfoUnavailable，由调用方按专属账户不可用处理
+func (s *Service) boundAccountIDs(apiKey string) ([]string, error) {
+	if apiKey == "" {
+		return nil, nil
+	}
+
+	binding := s.cfg().Binding
+	bindings := binding.Bindings
+	if accountIDs, ok := bindings[apiKey]; ok {
+		return accountIDs, nil
+	}
+
+	if len(bindings) == 0 && !binding.UseNodeBindings {
+		return nil, nil
+	}
+
+	info, err := s.lookupKeyInfo(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if accountIDs, ok := bindings[info.keyID]; ok && info.keyID != "" {
+		return accountIDs, nil
+	}
+	if info.boundAccountID != "" {
+		return []string{info.boundAccountID}, nil
+	}
+	return nil, nil
+}
+
+// selectBoundAccount 从专属账户中选择可用账户
+// 返回空字符串表示应回退到共享账户
+func (s *Service) selectBoundAccount(accounts []redis.ClaudeAccount, boundIDs []string, excludedAccounts map[string]bool) (string, error) {
+	bound := make(map[string]bool, len(boundIDs))
+	for _, id := range boundIDs {
+		bound[id] = true
+	}
+
+	var members []redis.ClaudeAccount
+	for _, account := range accounts {
+		if bound[account.ID] {
+			members = append(members, account)
+		}
+	}
+
+	available, _, _, _ := s.classifyAccounts(members, excludedAccounts)
+	if len(available) > 0 {
+		sortByLastUsed(available)
+		log.Printf("🎯 Using bound account %s (%s)", available[0].ID, available[0].Name)
+		return available[0].ID, nil
+	}
+
+	if s.cfg().Binding.FallbackPolicy == bindingFallbackReject {
+		log.Printf("⚠️  Bound accounts %v are unavailable, rejecting request", boundIDs)
+		return "", errBoundAccountUnavailable
+	}
+
+	log.Printf("⚠️  Bound accounts %v are unavailable, falling back to shared accounts", boundIDs)
+	return "", nil
+}
+
+// sharedAccounts 过滤掉专属账户，专属账户不参与共享调度
+func sharedAccounts(accounts []redis.ClaudeAccount) []redis.ClaudeAccount {
+	var result []redis.ClaudeAccount
+	for _, account := range accounts {
+		if account.AccountType != "dedicated" {
+			result = append(result, account)
+		}
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-middleware/internal/redis"
+)
+
+func TestBoundAccountIDs(t *testing.T) {
+	t.Setenv("ACCOUNT_BINDINGS", "config-key:acc1|acc2,k2:acc3")
+	t.Setenv("ACCOUNT_BINDINGS_FROM_NODE", "true")
+	s := newConfigService(t)
+	fresh := time.Now().Add(time.Minute)
+	s.keyInfoCache = map[string]keyInfoEntry{
+		"by-id":   {keyID: "k2", expiresAt: fresh},
+		"node":    {keyID: "k3", boundAccountID: "acc4", expiresAt: fresh},
+		"unbound": {keyID: "k4", expiresAt: fresh},
+		"unknown": {expiresAt: fresh},
+	}
+
+	tests := []struct {
+		apiKey  string
+		want    string
+		wantErr error
+	}{
+		{"", "", nil},
+		{"config-key", "acc1,acc2", nil},
+		{"by-id", "acc3", nil},
+		{"node", "acc4", nil},
+		{"unbound", "", nil},
+		{"unknown", "", nil},
+		// 查询失败与未绑定区分开
+		{"uncached", "", errKeyInfoUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.apiKey, func(t *testing.T) {
+			ids, err := s.boundAccountIDs(tt.apiKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("boundAccountIDs() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("boundAccountIDs() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickAccountRejectsUnresolvedBinding(t *testing.T) {
+	t.Setenv("ACCOUNT_BINDINGS_FROM_NODE", "true")
+	t.Setenv("BOUND_ACCOUNT_FALLBACK", "reject")
+	s := newConfigService(t)
+	s.activeAccounts = []redis.ClaudeAccount{{ID: "acc1"}}
+
+	if _, err := s.pickAccount("uncached", nil, true); !errors.Is(err, errKeyInfoUnavailable) {
+		t.Errorf("pickAccount() error = %v, want %v", err, errKeyInfoUnavailable)
+	}
+}
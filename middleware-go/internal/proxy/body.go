@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"claude-middleware/internal/metrics"
+)
+
+var spilledBodies = metrics.NewCounter("request_bodies_spilled_total",
+	"Number of request bodies buffered to a temporary file instead of memory")
+
+// requestBody 缓存的请求体，重试时可以重复读取
+// 较小的请求体保存在内存中，超过内存上限的写入临时文件
+type requestBody struct {
+	data []byte
+	path string
+	size int64
+}
+
+// readRequestBody 读取请求体，超过memoryLimit字节的部分写入spillDir下的临时文件
+func readRequestBody(r io.Reader, memoryLimit int64, spillDir string) (*requestBody, error) {
+	if memoryLimit <= 0 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return &requestBody{data: data, size: int64(len(data))}, nil
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, memoryLimit+1)
+	if err == io.EOF {
+		return &requestBody{data: buf.Bytes(), size: n}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp(spillDir, "claude-middleware-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create body spill file: %w", err)
+	}
+	body := &requestBody{path: file.Name()}
+
+	body.size, err = io.Copy(file, io.MultiReader(&buf, r))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+
+	spilledBodies.Inc()
+	return body, nil
+}
+
+// jsonBody 使用编码后的JSON创建内存中的请求体
+func jsonBody(v interface{}) (*requestBody, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &requestBody{data: data, size: int64(len(data))}, nil
+}
+
+// Len 请求体字节数
+func (b *requestBody) Len() int64 {
+	return b.size
+}
+
+// Reader 返回从头读取请求体的新Reader
+func (b *requestBody) Reader() (io.ReadCloser, error) {
+	if b.path == "" {
+		return io.NopCloser(bytes.NewReader(b.data)), nil
+	}
+	return os.Open(b.path)
+}
+
+// requestMetadata 请求体中与路由和统计相关的字段
+type requestMetadata struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+// Metadata 解析请求体中的model和stream，非JSON请求体返回零值
+// 逐个读取顶层字段并跳过其他值，避免把整个请求体（包括写入临时文件的请求体）解码到内存
+func (b *requestBody) Metadata() requestMetadata {
+	var metadata requestMetadata
+	if b.Len() == 0 {
+		return metadata
+	}
+	reader, err := b.Reader()
+	if err != nil {
+		return metadata
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return metadata
+	}
+	var hasModel, hasStream bool
+	for decoder.More() && !(hasModel && hasStream) {
+		key, err := decoder.Token()
+		if err != nil {
+			return metadata
+		}
+		value, err := decoder.Token()
+		if err != nil {
+			return metadata
+		}
+		switch v := value.(type) {
+		case json.Delim:
+			if err := skipJSONValue(decoder); err != nil {
+				return metadata
+			}
+		case string:
+			if key == "model" {
+				metadata.Model, hasModel = v, true
+			}
+		case bool:
+			if key == "stream" {
+				metadata.Stream, hasStream = v, true
+			}
+		}
+	}
+	return metadata
+}
+
+// skipJSONValue 跳过已读取起始分隔符的对象或数组
+func skipJSONValue(decoder *json.Decoder) error {
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// Close 删除临时文件
+func (b *requestBody) Close() error {
+	if b.path == "" {
+		return nil
+	}
+	return os.Remove(b.path)
+}
+
+// newBodyRequest 使用缓存的请求体创建上游请求
+func newBodyRequest(method, url string, body *requestBody) (*http.Request, error) {
+	if body.Len() == 0 {
+		return http.NewRequest(method, url, http.NoBody)
+	}
+
+	reader, err := body.Reader()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	req.ContentLength = body.Len()
+	req.GetBody = body.Reader
+	return req, nil
+}
+
+// isBodyTooLarge 判断读取错误是否由请求体超过上限引起
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
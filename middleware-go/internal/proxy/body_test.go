@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRequestBodyMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want requestMetadata
+	}{
+		{"empty", ``, requestMetadata{}},
+		{"not JSON", `model=claude`, requestMetadata{}},
+		{"array", `[{"model":"claude-sonnet-4"}]`, requestMetadata{}},
+		{"model and stream", `{"model":"claude-sonnet-4","stream":true}`, requestMetadata{Model: "claude-sonnet-4", Stream: true}},
+		{"after nested values", `{"messages":[{"role":"user","content":[{"type":"text","text":"{\"model\":\"x\"}"}]}],"metadata":{"model":"x","stream":true},"stream":true,"model":"claude-opus-4"}`,
+			requestMetadata{Model: "claude-opus-4", Stream: true}},
+		{"wrong types", `{"model":42,"stream":"yes","max_tokens":100}`, requestMetadata{}},
+		{"truncated", `{"model":"claude-sonnet-4","messages":[{"role":`, requestMetadata{Model: "claude-sonnet-4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := readRequestBody(strings.NewReader(tt.body), 1<<20, "")
+			if err != nil {
+				t.Fatalf("readRequestBody: %v", err)
+			}
+			if got := body.Metadata(); got != tt.want {
+				t.Errorf("Metadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestBodyMetadataSpilled(t *testing.T) {
+	payload := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"` + strings.Repeat("x", 4096) + `"}],"stream":true}`
+	body, err := readRequestBody(strings.NewReader(payload), 64, t.TempDir())
+	if err != nil {
+		t.Fatalf("readRequestBody: %v", err)
+	}
+	defer body.Close()
+	if body.path == "" {
+		t.Fatal("body was not spilled to a file")
+	}
+
+	if got := body.Metadata(); got != (requestMetadata{Model: "claude-sonnet-4", Stream: true}) {
+		t.Errorf("Metadata() = %+v", got)
+	}
+	reader, _ := body.Reader()
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != payload {
+		t.Error("spilled body changed after reading metadata")
+	}
+}
@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-middleware/internal/accesslog"
+	"claude-middleware/internal/cache"
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	cacheRequests = metrics.NewCounter("response_cache_requests_total",
+		"Number of cacheable requests by cache result (hit, miss, bypass)", "result")
+	cacheStores = metrics.NewCounter("response_cache_stores_total",
+		"Number of responses considered for the response cache, by outcome (stored, too_large, incomplete, not_ok)", "outcome")
+)
+
+// cacheLookup 未命中缓存的请求，响应成功后写入缓存
+type cacheLookup struct {
+	key      string
+	recorder *responseRecorder
+}
+
+// cacheControl 客户端请求的Cache-Control指令
+type cacheControl struct {
+	noCache bool          // 不使用缓存的响应，但缓存本次的响应
+	noStore bool          // 既不使用也不写入缓存
+	maxAge  time.Duration // 只接受缓存时间不超过maxAge的响应，-1表示不限制
+}
+
+func parseCacheControl(header string) cacheControl {
+	cc := cacheControl{maxAge: -1}
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			cc.noCache = true
+		case "no-store":
+			cc.noStore = true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				cc.maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return cc
+}
+
+// routeListed POST请求的路径是否匹配列表中的前缀
+func routeListed(routes []string, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	for _, prefix := range routes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientListed 客户端的API Key、Key ID或名称是否在列表中
+func clientListed(list []string, apiKey string, client clientIdentity) bool {
+	for _, allowed := range list {
+		if allowed == apiKey || allowed == client.ID || (client.Name != "" && allowed == client.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupCache 查找请求的缓存响应，命中时直接返回给客户端（served为true）
+// 未命中且响应可以缓存时返回lookup，请求不使用缓存时返回nil
+func (s *Service) lookupCache(c *gin.Context, body *requestBody, apiKey string, client clientIdentity, record *accesslog.Record) (lookup *cacheLookup, served bool) {
+	if s.responseCache == nil {
+		return nil, false
+	}
+	cfg := s.cfg().Cache
+	if !routeListed(cfg.Routes, c.Request) || (len(cfg.Clients) > 0 && !clientListed(cfg.Clients, apiKey, client)) {
+		return nil, false
+	}
+	key, deterministic, ok := s.requestKey(c.Request, body, client, cfg.Shared)
+	if !ok || (cfg.DeterministicOnly && !deterministic) {
+		return nil, false
+	}
+
+	cc := parseCacheControl(c.GetHeader("Cache-Control"))
+	if !cc.noCache && !cc.noStore {
+		if entry, ok := s.responseCache.Get(key); ok && (cc.maxAge < 0 || entry.Age() <= cc.maxAge) {
+			s.serveCached(c, cfg, entry)
+			record.Cache = "hit"
+			if entry.Model != "" && entry.Model != record.Model {
+				record.ServedModel = entry.Model
+			}
+			cacheRequests.Inc("hit")
+			return nil, true
+		}
+	}
+
+	result := "miss"
+	if cc.noCache || cc.noStore {
+		result = "bypass"
+	}
+	record.Cache = result
+	cacheRequests.Inc(result)
+	c.Header(cfg.StatusHeader, strings.ToUpper(result))
+	if cc.noStore {
+		return nil, false
+	}
+	return &cacheLookup{key: key}, false
+}
+
+// requestKey 请求内容的规范化哈希（见 cache.Key），shared为false时不同客户端的相同请求得到不同的键
+// 请求体不是JSON对象或已写入临时文件时返回false
+func (s *Service) requestKey(r *http.Request, body *requestBody, client clientIdentity, shared bool) (key string, deterministic bool, ok bool) {
+	if limit := s.cfg().Proxy.BodyMemoryLimit; limit > 0 && body.Len() > int64(limit) {
+		return "", false, false
+	}
+	reader, err := body.Reader()
+	if err != nil {
+		return "", false, false
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return "", false, false
+	}
+
+	request := cache.Request{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.RawQuery,
+		Version: r.Header.Get("anthropic-version"),
+		Betas:   r.Header.Values("anthropic-beta"),
+		Body:    data,
+	}
+	if !shared {
+		request.Scope = client.ID
+	}
+	key, deterministic, err = cache.Key(request)
+	return key, deterministic, err == nil
+}
+
+// serveCached 返回缓存的响应，SSE响应按事件逐个写入并刷新
+func (s *Service) serveCached(c *gin.Context, cfg config.CacheConfig, entry *cache.Entry) {
+	log.Printf("🗄️  Serving %s from response cache (age %v)", c.Request.URL.Path, entry.Age().Round(time.Second))
+	c.Header("Content-Type", entry.ContentType)
+	c.Header("Age", strconv.Itoa(int(entry.Age().Seconds())))
+	c.Header(cfg.StatusHeader, "HIT")
+	// 与未命中时相同，告知客户端实际应答的模型
+	if fallbackCfg := s.cfg().Fallback; fallbackCfg.Enabled && entry.Model != "" {
+		c.Header(fallbackCfg.ModelHeader, entry.Model)
+	}
+	c.Status(entry.Status)
+
+	if !strings.HasPrefix(entry.ContentType, "text/event-stream") {
+		c.Writer.Write(entry.Body)
+		return
+	}
+	events := entry.Body
+	for len(events) > 0 {
+		n := bytes.Index(events, []byte("\n\n"))
+		if n < 0 {
+			n = len(events)
+		} else {
+			n += 2
+		}
+		if _, err := c.Writer.Write(events[:n]); err != nil {
+			return
+		}
+		c.Writer.Flush()
+		events = events[n:]
+	}
+}
+
+// record 在响应写给客户端的同时记录响应体
+func (l *cacheLookup) record(c *gin.Context, maxBodySize int) {
+	l.recorder = recordResponse(c, maxBodySize)
+}
+
+// storeCache 缓存完整返回的200响应，model为实际应答的模型
+func (s *Service) storeCache(c *gin.Context, lookup *cacheLookup, model string) {
+	recorder := lookup.recorder
+	outcome := "stored"
+	switch {
+	case recorder.Status() != http.StatusOK:
+		outcome = "not_ok"
+	case recorder.overflow:
+		outcome = "too_large"
+	case !recorder.complete(c):
+		outcome = "incomplete"
+	}
+	cacheStores.Inc(outcome)
+	if outcome != "stored" {
+		return
+	}
+
+	s.responseCache.Set(lookup.key, &cache.Entry{
+		Status:      http.StatusOK,
+		ContentType: recorder.Header().Get("Content-Type"),
+		Body:        recorder.body.Bytes(),
+		Model:       model,
+		StoredAt:    time.Now(),
+	})
+}
+
+// responseRecorder 记录写给客户端的响应体，超过limit后停止记录
+type responseRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+	failed   bool // 写给客户端时出错
+}
+
+// recordResponse 替换c.Writer，之后写给客户端的响应体同时被记录
+func recordResponse(c *gin.Context, limit int) *responseRecorder {
+	recorder := &responseRecorder{ResponseWriter: c.Writer, limit: limit}
+	c.Writer = recorder
+	return recorder
+}
+
+// complete 响应体是否完整写给了客户端并全部记录：没有超过limit，上游和客户端连接都没有中断
+func (r *responseRecorder) complete(c *gin.Context) bool {
+	return !r.overflow && !r.failed && len(c.Errors) == 0
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.capture(p)
+	n, err := r.ResponseWriter.Write(p)
+	if err != nil {
+		r.failed = true
+	}
+	return n, err
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+func (r *responseRecorder) capture(p []byte) {
+	if r.overflow {
+		return
+	}
+	if r.body.Len()+len(p) > r.limit {
+		r.overflow = true
+		r.body = bytes.Buffer{}
+		return
+	}
+	r.body.Write(p)
+}
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-middleware/internal/accesslog"
+	"claude-middleware/internal/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCacheHitRestoresServedModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CACHE_ENABLED", "true")
+	t.Setenv("FALLBACK_ENABLED", "true")
+	t.Setenv("FALLBACK_CHAINS", "claude-opus-4:claude-sonnet-4")
+	s := newConfigService(t)
+	s.responseCache = cache.New(s.cfg().Cache, nil)
+	modelHeader := s.cfg().Fallback.ModelHeader
+	statusHeader := s.cfg().Cache.StatusHeader
+	client := clientIdentity{ID: "key_1", Name: "ci"}
+	payload := `{"model":"claude-opus-4","temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+
+	send := func(handle func(c *gin.Context, lookup *cacheLookup)) (*httptest.ResponseRecorder, *accesslog.Record, bool) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(payload))
+		body, err := readRequestBody(strings.NewReader(payload), 1<<20, "")
+		if err != nil {
+			t.Fatalf("readRequestBody: %v", err)
+		}
+		defer body.Close()
+
+		record := &accesslog.Record{Model: "claude-opus-4"}
+		lookup, served := s.lookupCache(c, body, "sk-client", client, record)
+		if !served {
+			handle(c, lookup)
+		}
+		return w, record, served
+	}
+
+	// 第一次请求未命中，账户池耗尽后由降级模型应答
+	w, _, served := send(func(c *gin.Context, lookup *cacheLookup) {
+		if lookup == nil {
+			t.Fatal("lookupCache() = nil, want cacheable request")
+		}
+		lookup.record(c, s.cfg().Cache.MaxBodySize)
+		c.Header(modelHeader, "claude-sonnet-4")
+		c.Data(http.StatusOK, "application/json", []byte(`{"type":"message"}`))
+		s.storeCache(c, lookup, "claude-sonnet-4")
+	})
+	if served || w.Header().Get(statusHeader) != "MISS" {
+		t.Fatalf("first request served=%v %s=%q, want MISS", served, statusHeader, w.Header().Get(statusHeader))
+	}
+
+	w, record, served := send(func(c *gin.Context, lookup *cacheLookup) {
+		t.Fatal("second request reached the upstream")
+	})
+	if !served || w.Header().Get(statusHeader) != "HIT" {
+		t.Fatalf("second request served=%v %s=%q, want HIT", served, statusHeader, w.Header().Get(statusHeader))
+	}
+	if got := w.Header().Get(modelHeader); got != "claude-sonnet-4" {
+		t.Errorf("%s = %q on cache hit, want claude-sonnet-4", modelHeader, got)
+	}
+	if record.ServedModel != "claude-sonnet-4" {
+		t.Errorf("record.ServedModel = %q, want claude-sonnet-4", record.ServedModel)
+	}
+	if got := w.Body.String(); got != `{"type":"message"}` {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestCacheHitWithoutFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CACHE_ENABLED", "true")
+	s := newConfigService(t)
+	s.responseCache = cache.New(s.cfg().Cache, nil)
+	s.responseCache.Set("key", &cache.Entry{Status: http.StatusOK, ContentType: "application/json", Body: []byte(`{}`), Model: "claude-opus-4"})
+	entry, ok := s.responseCache.Get("key")
+	if !ok {
+		t.Fatal("entry not cached")
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	s.serveCached(c, s.cfg().Cache, entry)
+
+	if got := w.Header().Get(s.cfg().Fallback.ModelHeader); got != "" {
+		t.Errorf("%s = %q with fallback disabled, want unset", s.cfg().Fallback.ModelHeader, got)
+	}
+}
+
+// flushRecorder 记录每次刷新时已写入的响应体
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushed = append(r.flushed, r.Body.String())
+	r.ResponseRecorder.Flush()
+}
+
+func TestCacheHitReplaysEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CACHE_ENABLED", "true")
+	s := newConfigService(t)
+	events := []string{
+		"event: message_start\ndata: {\"type\":\"message_start\"}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\"}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	}
+	entry := &cache.Entry{Status: http.StatusOK, ContentType: "text/event-stream; charset=utf-8", Body: []byte(strings.Join(events, ""))}
+
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	s.serveCached(c, s.cfg().Cache, entry)
+
+	if len(w.flushed) != len(events) {
+		t.Fatalf("flushed %d times, want %d", len(w.flushed), len(events))
+	}
+	for i := range events {
+		if want := strings.Join(events[:i+1], ""); w.flushed[i] != want {
+			t.Errorf("flush %d wrote %q, want %q", i, w.flushed[i], want)
+		}
+	}
+	if got := w.Header().Get("Content-Type"); got != entry.ContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestRequestKeyIncludesAnthropicHeaders(t *testing.T) {
+	s := newConfigService(t)
+	payload := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`
+	key := func(headers map[string][]string) string {
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		for name, values := range headers {
+			for _, value := range values {
+				r.Header.Add(name, value)
+			}
+		}
+		body, err := readRequestBody(strings.NewReader(payload), 1<<20, "")
+		if err != nil {
+			t.Fatalf("readRequestBody: %v", err)
+		}
+		defer body.Close()
+		key, _, ok := s.requestKey(r, body, clientIdentity{ID: "key_1"}, false)
+		if !ok {
+			t.Fatal("requestKey() not ok")
+		}
+		return key
+	}
+
+	base := key(map[string][]string{"anthropic-version": {"2023-06-01"}, "anthropic-beta": {"a,b"}})
+	if got := key(map[string][]string{"anthropic-version": {"2023-06-01"}, "anthropic-beta": {"b", "a"}}); got != base {
+		t.Error("key changed with beta header order")
+	}
+	if got := key(map[string][]string{"anthropic-version": {"2023-06-01"}, "anthropic-beta": {"a"}}); got == base {
+		t.Error("key ignores anthropic-beta")
+	}
+	if got := key(map[string][]string{"anthropic-version": {"2024-01-01"}, "anthropic-beta": {"a,b"}}); got == base {
+		t.Error("key ignores anthropic-version")
+	}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"claude-middleware/internal/accesslog"
+	"claude-middleware/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	coalescedRequests = metrics.NewCounter("coalesced_requests_total",
+		"Number of coalescable requests by role (leader, shared, retried when the leader's response could not be shared)", "role")
+	coalescedWaiters = metrics.NewGauge("coalesced_waiters",
+		"Number of requests currently waiting for an identical in-flight request")
+)
+
+// flightResult 请求上游的请求（leader）返回给客户端的完整响应
+type flightResult struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// flight 一组相同的进行中请求，done关闭后result为nil表示响应不能共享
+type flight struct {
+	done   chan struct{}
+	result *flightResult
+}
+
+// flightGroup 按请求键合并进行中的请求（仅内存）
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// join 加入键对应的请求组，没有进行中的请求时创建并成为leader
+func (g *flightGroup) join(key string) (f *flight, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f = &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// finish leader结束请求，之后到达的相同请求重新请求上游
+func (g *flightGroup) finish(key string, f *flight, result *flightResult) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+
+	f.result = result
+	close(f.done)
+}
+
+// coalescedLeader 请求上游的请求，结束时把响应分享给等待的请求
+type coalescedLeader struct {
+	group    *flightGroup
+	key      string
+	flight   *flight
+	recorder *responseRecorder
+}
+
+// coalesce 合并同一客户端相同的进行中非流式请求
+//
+// 第一个请求（leader）正常请求上游，返回lead并记录写给客户端的响应；之后到达的相同请求等待leader结束，
+// 直接返回相同的响应（served为true）。leader的响应不是2xx、不完整、过大或leader的客户端已断开时，
+// 等待的请求各自继续请求上游。
+func (s *Service) coalesce(c *gin.Context, body *requestBody, client clientIdentity, stream bool, record *accesslog.Record) (lead *coalescedLeader, served bool) {
+	cfg := s.cfg().Coalesce
+	if !cfg.Enabled || stream || !routeListed(cfg.Routes, c.Request) {
+		return nil, false
+	}
+	key, deterministic, ok := s.requestKey(c.Request, body, client, false)
+	if !ok || (cfg.DeterministicOnly && !deterministic) {
+		return nil, false
+	}
+
+	f, leader := s.flights.join(key)
+	if leader {
+		coalescedRequests.Inc("leader")
+		return &coalescedLeader{group: &s.flights, key: key, flight: f, recorder: recordResponse(c, cfg.MaxResponseSize)}, false
+	}
+
+	log.Printf("🔗 Waiting for identical in-flight request %s (client %s)", c.Request.URL.Path, client)
+	coalescedWaiters.Add(1)
+	defer coalescedWaiters.Add(-1)
+	select {
+	case <-f.done:
+	case <-c.Request.Context().Done():
+		record.Error = "client_disconnected"
+		return nil, true
+	}
+
+	if f.result == nil {
+		coalescedRequests.Inc("retried")
+		return nil, false
+	}
+	coalescedRequests.Inc("shared")
+	record.Coalesced = true
+	for name, values := range f.result.header {
+		c.Writer.Header()[name] = append([]string(nil), values...)
+	}
+	c.Status(f.result.status)
+	c.Writer.Write(f.result.body)
+	return nil, true
+}
+
+// finish 把leader的成功响应分享给等待的请求
+// 429、503等错误响应只说明leader选中的账户或当时的上游不可用，等待的请求各自重新选择账户
+func (l *coalescedLeader) finish(c *gin.Context) {
+	var result *flightResult
+	status := l.recorder.Status()
+	if status >= 200 && status < 300 && l.recorder.complete(c) && c.Request.Context().Err() == nil {
+		result = &flightResult{
+			status: status,
+			header: l.recorder.Header().Clone(),
+			body:   l.recorder.body.Bytes(),
+		}
+	}
+	l.group.finish(l.key, l.flight, result)
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-middleware/internal/accesslog"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsStreamRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		stream bool
+		want   bool
+	}{
+		{"anthropic stream field", "/v1/messages", true, true},
+		{"anthropic without stream", "/v1/messages", false, false},
+		{"gemini generateContent", "/gemini/v1beta/models/gemini-2.5-pro:generateContent", false, false},
+		{"gemini streamGenerateContent", "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent", false, true},
+		{"gemini sse", "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", false, true},
+		{"alt=sse on other paths", "/gemini/v1/models/gemini-2.5-pro:generateContent?alt=sse", false, true},
+		{"other alt", "/gemini/v1beta/models/gemini-2.5-pro:generateContent?alt=json", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if got := isStreamRequest(r, tt.stream); got != tt.want {
+				t.Errorf("isStreamRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoalesceSkipsGeminiStreaming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("COALESCE_ENABLED", "true")
+	t.Setenv("COALESCE_DETERMINISTIC_ONLY", "false")
+	s := newConfigService(t)
+	client := clientIdentity{ID: "key_1", Name: "ci"}
+	payload := `{"contents":[{"role":"user","parts":[{"text":"hello"}]}]}`
+
+	tests := []struct {
+		name       string
+		target     string
+		wantLeader bool
+	}{
+		{"generateContent", "/gemini/v1beta/models/gemini-2.5-pro:generateContent", true},
+		{"streamGenerateContent", "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent", false},
+		{"streamGenerateContent sse", "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(payload))
+			body, err := readRequestBody(strings.NewReader(payload), 1<<20, "")
+			if err != nil {
+				t.Fatalf("readRequestBody: %v", err)
+			}
+			defer body.Close()
+
+			stream := isStreamRequest(c.Request, body.Metadata().Stream)
+			lead, served := s.coalesce(c, body, client, stream, &accesslog.Record{})
+			if served {
+				t.Fatal("coalesce() served the request")
+			}
+			if (lead != nil) != tt.wantLeader {
+				t.Errorf("leader = %v, want %v", lead != nil, tt.wantLeader)
+			}
+			if lead != nil {
+				lead.finish(c)
+			}
+		})
+	}
+}
+
+// TestCoalesceSharesOnlySuccess 只把leader的2xx响应分享给等待的请求，其他状态码由等待的请求各自重试
+func TestCoalesceSharesOnlySuccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("COALESCE_ENABLED", "true")
+	s := newConfigService(t)
+	client := clientIdentity{ID: "key_1", Name: "ci"}
+	payload := `{"model":"claude-sonnet-4","temperature":0,"messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		status    int
+		wantShare bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+		{http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(payload))
+			body, err := readRequestBody(strings.NewReader(payload), 1<<20, "")
+			if err != nil {
+				t.Fatalf("readRequestBody: %v", err)
+			}
+			defer body.Close()
+
+			lead, served := s.coalesce(c, body, client, false, &accesslog.Record{})
+			if lead == nil || served {
+				t.Fatalf("coalesce() = %v, %v, want leader", lead, served)
+			}
+			c.Data(tt.status, "application/json", []byte(`{"type":"message"}`))
+			lead.finish(c)
+
+			select {
+			case <-lead.flight.done:
+			default:
+				t.Fatal("finish() did not release waiters")
+			}
+			result := lead.flight.result
+			if (result != nil) != tt.wantShare {
+				t.Fatalf("shared = %v, want %v", result != nil, tt.wantShare)
+			}
+			if result != nil && (result.status != tt.status || string(result.body) != `{"type":"message"}`) {
+				t.Errorf("result = %d %q", result.status, result.body)
+			}
+		})
+	}
+}
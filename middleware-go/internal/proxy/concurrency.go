@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"claude-middleware/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	accountInFlight = metrics.NewGauge("account_in_flight_requests",
+		"Number of requests currently being served by each account", "account")
+	accountMaxConcurrency = metrics.NewGauge("account_max_concurrency",
+		"Configured max concurrent requests per account (0 means unlimited)", "account")
+)
+
+// inFlightTracker 每个账户正在处理的请求数（仅内存）
+type inFlightTracker struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// tryAcquire 账户未达到并发上限时占用一个名额，limit为0表示不限制
+func (t *inFlightTracker) tryAcquire(accountID string, limit int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.counts == nil {
+		t.counts = make(map[string]int)
+	}
+	if limit > 0 && t.counts[accountID] >= limit {
+		return false
+	}
+	t.counts[accountID]++
+	accountInFlight.Set(float64(t.counts[accountID]), accountID)
+	return true
+}
+
+// release 释放账户的一个并发名额
+func (t *inFlightTracker) release(accountID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.counts[accountID] > 0 {
+		t.counts[accountID]--
+	}
+	accountInFlight.Set(float64(t.counts[accountID]), accountID)
+}
+
+// count 账户正在处理的请求数
+func (t *inFlightTracker) count(accountID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.counts[accountID]
+}
+
+// accountConcurrencyLimit 账户的最大并发数，单独配置优先，0表示不限制
+func (s *Service) accountConcurrencyLimit(accountID string) int {
+	selection := s.cfg().Selection
+	if limit, ok := selection.AccountConcurrency[accountID]; ok {
+		return limit
+	}
+	return selection.MaxConcurrency
+}
+
+// releaseAccount 释放账户的并发名额，并唤醒等待账户的排队请求
+func (s *Service) releaseAccount(accountID string) {
+	s.inFlight.release(accountID)
+	s.admission.notify()
+}
+
+// accountLeases 一个请求占用的账户并发名额，请求结束时全部释放
+// 同一请求可能多次占用同一账户（如降级到其他模型后重新选择）
+type accountLeases struct {
+	s    *Service
+	held []string
+}
+
+// add 记录选择账户时占用的名额
+func (l *accountLeases) add(accountID string) {
+	l.held = append(l.held, accountID)
+}
+
+// release 提前释放一个名额（换账户重试、对冲请求落败时）
+func (l *accountLeases) release(accountID string) {
+	for i, id := range l.held {
+		if id == accountID {
+			l.held = append(l.held[:i], l.held[i+1:]...)
+			l.s.releaseAccount(accountID)
+			return
+		}
+	}
+}
+
+// releaseAll 释放请求占用的所有名额
+func (l *accountLeases) releaseAll() {
+	for _, accountID := range l.held {
+		l.s.releaseAccount(accountID)
+	}
+	l.held = nil
+}
+
+// updateConcurrencyMetrics 更新每个账户的并发上限指标
+func (s *Service) updateConcurrencyMetrics() {
+	s.accountsMutex.RLock()
+	accounts := s.activeAccounts
+	s.accountsMutex.RUnlock()
+
+	accountMaxConcurrency.Reset()
+	for _, account := range accounts {
+		accountMaxConcurrency.Set(float64(s.accountConcurrencyLimit(account.ID)), account.ID)
+	}
+}
+
+// accountState 管理API返回的账户实时状态
+type accountState struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	AccountType    string     `json:"account_type,omitempty"`
+	InFlight       int        `json:"in_flight"`
+	MaxConcurrency int        `json:"max_concurrency"` // 0表示不限制
+	RateLimited    bool       `json:"rate_limited"`
+	Problematic    bool       `json:"problematic"`
+	DisabledUntil  *time.Time `json:"disabled_until,omitempty"` // 有问题的账户恢复时间
+}
+
+// AccountsHandler 查询账户的实时并发与冷却状态
+// GET /admin/accounts
+func (s *Service) AccountsHandler(c *gin.Context) {
+	s.accountsMutex.RLock()
+	accounts := s.activeAccounts
+	s.accountsMutex.RUnlock()
+
+	states := make([]accountState, 0, len(accounts))
+	totalInFlight := 0
+	for _, account := range accounts {
+		state := accountState{
+			ID:             account.ID,
+			Name:           account.Name,
+			AccountType:    account.AccountType,
+			InFlight:       s.inFlight.count(account.ID),
+			MaxConcurrency: s.accountConcurrencyLimit(account.ID),
+			RateLimited:    s.isAccountRateLimited(account.ID),
+			Problematic:    s.isAccountProblematic(account.ID),
+		}
+		if state.Problematic {
+			s.rateLimitMutex.RLock()
+			disabledUntil := s.problematicCache[account.ID]
+			s.rateLimitMutex.RUnlock()
+			state.DisabledUntil = &disabledUntil
+		}
+		totalInFlight += state.InFlight
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":     len(states),
+		"in_flight": totalInFlight,
+		"accounts":  states,
+	})
+}
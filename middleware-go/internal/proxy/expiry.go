@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"time"
+
+	"claude-middleware/internal/metrics"
+	"claude-middleware/internal/redis"
+)
+
+// OAuth Token过期状态
+const (
+	expiryValid    = "valid"    // 距离过期超过窗口
+	expiryExpiring = "expiring" // 即将过期，等待Node.js刷新
+	expiryExpired  = "expired"  // 已过期
+	expiryUnknown  = "unknown"  // 未记录过期时间（如Setup Token账户）
+)
+
+var accountsByTokenExpiry = metrics.NewGauge("accounts_token_expiry",
+	"Number of active accounts in each OAuth token expiry bucket", "bucket")
+
+// tokenExpiryState 根据expiresAt（毫秒时间戳）判断账户Token的过期状态
+func (s *Service) tokenExpiryState(account redis.ClaudeAccount, now time.Time) string {
+	if account.ExpiresAt <= 0 {
+		return expiryUnknown
+	}
+
+	expiresAt := time.UnixMilli(account.ExpiresAt)
+	window := s.cfg().Selection.TokenExpiryWindow.Duration
+
+	switch {
+	case !now.Before(expiresAt):
+		return expiryExpired
+	case expiresAt.Sub(now) <= window:
+		return expiryExpiring
+	default:
+		return expiryValid
+	}
+}
+
+// updateTokenExpiryMetrics 统计各过期状态的账户数量
+func (s *Service) updateTokenExpiryMetrics(accounts []redis.ClaudeAccount) {
+	counts := map[string]int{
+		expiryValid:    0,
+		expiryExpiring: 0,
+		expiryExpired:  0,
+		expiryUnknown:  0,
+	}
+
+	now := time.Now()
+	for _, account := range accounts {
+		counts[s.tokenExpiryState(account, now)]++
+	}
+
+	for bucket, count := range counts {
+		accountsByTokenExpiry.Set(float64(count), bucket)
+	}
+}
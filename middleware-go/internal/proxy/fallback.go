@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
+)
+
+var modelFallbacks = metrics.NewCounter("model_fallbacks_total",
+	"Number of requests switched to a fallback model after the account pool was exhausted", "from", "to")
+
+// upstreamTarget 一次上游调用使用的模型、请求体和格式转换
+type upstreamTarget struct {
+	model string
+	body  *requestBody // 发往上游的请求体
+	tr    *translation // 需要转换格式时不为nil
+	url   url.URL
+
+	inputTokens int // 估算的输入Token数，用于按Token均衡账户
+}
+
+// newUpstreamTarget 根据客户端请求和请求体（可能已改写模型）确定上游请求
+func (s *Service) newUpstreamTarget(cfg config.TranslateConfig, r *http.Request, body *requestBody, model string) (*upstreamTarget, error) {
+	tr, err := translateRequest(cfg, r, body)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &upstreamTarget{model: model, body: body, tr: tr, url: *s.targetURL}
+	target.url.Path = r.URL.Path
+	target.url.RawQuery = r.URL.RawQuery
+	if tr != nil {
+		target.body = tr.body
+		target.url.Path = tr.path
+		target.url.RawQuery = tr.rawQuery
+	}
+	return target, nil
+}
+
+// fallbackChain 返回模型的降级链，未启用或未配置时返回nil
+func (s *Service) fallbackChain(model string) []string {
+	cfg := s.cfg().Fallback
+	if !cfg.Enabled || model == "" {
+		return nil
+	}
+	return cfg.Chains[model]
+}
+
+// fallbackTarget 将客户端请求改写为使用降级模型，跨提供方（Gemini）时同时转换格式
+// 只支持请求体中带model字段的Anthropic Messages和OpenAI Chat Completions请求
+func (s *Service) fallbackTarget(r *http.Request, clientBody *requestBody, model string) (*upstreamTarget, error) {
+	cfg := s.cfg().Translate
+	path := r.URL.Path
+
+	gemini := isGeminiModel(cfg, model)
+	switch {
+	case anthropicMessagesPaths[path]:
+		// 降级到Gemini模型时无论是否开启Gemini转换都需要转换格式
+		cfg.Gemini = gemini
+	case path == openAIChatPath && cfg.OpenAI:
+		if gemini {
+			return nil, fmt.Errorf("OpenAI-format requests cannot fall back to Gemini model %s", model)
+		}
+	default:
+		return nil, fmt.Errorf("fallback is not supported for %s", path)
+	}
+
+	body, err := rewriteModel(clientBody, model)
+	if err != nil {
+		return nil, err
+	}
+	return s.newUpstreamTarget(cfg, r, body, model)
+}
+
+// rewriteModel 返回将model字段替换后的请求体，其余字段保持不变
+func rewriteModel(body *requestBody, model string) (*requestBody, error) {
+	data, err := readAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("request body is not a JSON object: %w", err)
+	}
+	fields["model"], _ = json.Marshal(model)
+	return jsonBody(fields)
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"claude-middleware/internal/config"
+)
+
+// hopByHopHeaders 只在单跳连接上有意义的头，代理时不能转发（RFC 7230 6.1）
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHopHeaders 删除hop-by-hop头，包括Connection头中列出的头
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// setForwardedHeaders 注入X-Forwarded-For/Proto/Host
+func setForwardedHeaders(header http.Header, clientReq *http.Request) {
+	if clientIP, _, err := net.SplitHostPort(clientReq.RemoteAddr); err == nil {
+		if prior := header.Values("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		header.Set("X-Forwarded-For", clientIP)
+	}
+
+	proto := "http"
+	if clientReq.TLS != nil {
+		proto = "https"
+	}
+	header.Set("X-Forwarded-Proto", proto)
+	header.Set("X-Forwarded-Host", clientReq.Host)
+}
+
+// headerRewrite 编译后的正则改写
+type headerRewrite struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// headerActions 编译后的头处理动作
+type headerActions struct {
+	remove   []string
+	rewrites []headerRewrite
+	set      map[string]string
+	add      map[string]string
+}
+
+// headerRule 编译后的按路由头处理规则
+type headerRule struct {
+	pathPrefix string
+	request    headerActions
+	response   headerActions
+}
+
+// headerRules 按配置顺序排列的头处理规则
+type headerRules []headerRule
+
+// compileHeaderRules 编译配置中的头处理规则
+func compileHeaderRules(cfg config.HeadersConfig) (headerRules, error) {
+	rules := make(headerRules, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		request, err := compileHeaderActions(rule.Request)
+		if err != nil {
+			return nil, err
+		}
+		response, err := compileHeaderActions(rule.Response)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, headerRule{
+			pathPrefix: rule.PathPrefix,
+			request:    request,
+			response:   response,
+		})
+	}
+	return rules, nil
+}
+
+func compileHeaderActions(cfg config.HeaderActions) (headerActions, error) {
+	actions := headerActions{
+		remove: cfg.Remove,
+		set:    cfg.Set,
+		add:    cfg.Add,
+	}
+	for _, rewrite := range cfg.Rewrite {
+		pattern, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			return headerActions{}, err
+		}
+		actions.rewrites = append(actions.rewrites, headerRewrite{
+			name:        rewrite.Name,
+			pattern:     pattern,
+			replacement: rewrite.Replacement,
+		})
+	}
+	return actions, nil
+}
+
+// applyRequest 对发往上游的请求头执行匹配路由的规则
+func (rules headerRules) applyRequest(path string, header http.Header) {
+	for _, rule := range rules {
+		if strings.HasPrefix(path, rule.pathPrefix) {
+			rule.request.apply(header)
+		}
+	}
+}
+
+// applyResponse 对返回客户端的响应头执行匹配路由的规则
+func (rules headerRules) applyResponse(path string, header http.Header) {
+	for _, rule := range rules {
+		if strings.HasPrefix(path, rule.pathPrefix) {
+			rule.response.apply(header)
+		}
+	}
+}
+
+func (a headerActions) apply(header http.Header) {
+	for _, name := range a.remove {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			prefix = http.CanonicalHeaderKey(prefix)
+			for key := range header {
+				if strings.HasPrefix(key, prefix) {
+					delete(header, key)
+				}
+			}
+			continue
+		}
+		header.Del(name)
+	}
+
+	for _, rewrite := range a.rewrites {
+		values := header.Values(rewrite.name)
+		if len(values) == 0 {
+			continue
+		}
+		header.Del(rewrite.name)
+		for _, value := range values {
+			header.Add(rewrite.name, rewrite.pattern.ReplaceAllString(value, rewrite.replacement))
+		}
+	}
+
+	for name, value := range a.set {
+		header.Set(name, value)
+	}
+	for name, value := range a.add {
+		header.Add(name, value)
+	}
+}
+
+// loadHeaderRules 编译并替换当前的头处理规则，失败时保留旧规则
+func (s *Service) loadHeaderRules(cfg *config.Config) {
+	rules, err := compileHeaderRules(cfg.Headers)
+	if err != nil {
+		log.Printf("❌ Invalid header rules, keeping previous rules: %v", err)
+		return
+	}
+	s.headerRules.Store(&rules)
+}
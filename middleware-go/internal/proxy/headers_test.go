@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"claude-middleware/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestService 使用默认配置（及t.Setenv设置的环境变量）创建指向upstream的Service
+func newTestService(t *testing.T, upstream *httptest.Server) *Service {
+	t.Helper()
+	t.Setenv("TARGET_URL", upstream.URL)
+	configs, err := config.NewManager("")
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	targetURL, _ := url.Parse(upstream.URL)
+	s := &Service{configs: configs, targetURL: targetURL, httpClient: upstream.Client()}
+	s.loadHeaderRules(configs.Current())
+	return s
+}
+
+func TestSendProxyRequestHostileConnectionHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("UPSTREAM_SIGNING_SECRET", "secret")
+
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer upstream.Close()
+	s := newTestService(t, upstream)
+	client := clientIdentity{ID: "key_1", Name: "ci"}
+
+	tests := []struct {
+		name       string
+		connection string
+	}{
+		{"middleware headers", "x-api-key, X-Middleware-Client, X-Middleware-Signature"},
+		{"forwarded headers", "X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host"},
+		{"mixed case with spaces", " X-API-KEY ,x-middleware-client,  x-middleware-signature "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+			req.Header.Set("Connection", tt.connection)
+			req.Header.Set("x-api-key", "client-secret-key")
+			req.Header.Set("Authorization", "Bearer client-secret-key")
+			req.Header.Set("X-Middleware-Signature", "t=1,v1=forged")
+			req.Header.Set("X-Custom", "kept")
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+
+			body, err := readRequestBody(strings.NewReader(`{}`), 1<<20, "")
+			if err != nil {
+				t.Fatalf("readRequestBody: %v", err)
+			}
+			defer body.Close()
+
+			resp, err := s.sendProxyRequest(context.Background(), c, upstream.URL+"/v1/messages", body, "acc1", client, nil)
+			if err != nil {
+				t.Fatalf("sendProxyRequest: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := received.Get("x-api-key"); got != "acc1" {
+				t.Errorf("x-api-key = %q, want account ID acc1", got)
+			}
+			if got := received.Get("Authorization"); got != "" {
+				t.Errorf("client Authorization forwarded: %q", got)
+			}
+			if got := received.Get("X-Middleware-Client"); got != client.headerValue() {
+				t.Errorf("X-Middleware-Client = %q, want %q", got, client.headerValue())
+			}
+			if got := received.Get("X-Middleware-Signature"); !strings.HasPrefix(got, "t=") || strings.Contains(got, "forged") {
+				t.Errorf("X-Middleware-Signature = %q, want middleware signature", got)
+			}
+			for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host"} {
+				if received.Get(name) == "" {
+					t.Errorf("%s missing", name)
+				}
+			}
+			if got := received.Get("X-Custom"); got != "kept" {
+				t.Errorf("X-Custom = %q, want kept", got)
+			}
+		})
+	}
+}
+
+func TestHeaderRulesCannotRemoveUpstreamHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("UPSTREAM_SIGNING_SECRET", "secret")
+	t.Setenv("REQUEST_HEADERS_REMOVE", "X-Middleware-*,X-Debug")
+
+	var received http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer upstream.Close()
+	s := newTestService(t, upstream)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+	req.Header.Set("X-Debug", "1")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+	body, err := readRequestBody(strings.NewReader(`{}`), 1<<20, "")
+	if err != nil {
+		t.Fatalf("readRequestBody: %v", err)
+	}
+	defer body.Close()
+
+	resp, err := s.sendProxyRequest(context.Background(), c, upstream.URL+"/v1/messages", body, "acc1", clientIdentity{ID: "key_1"}, nil)
+	if err != nil {
+		t.Fatalf("sendProxyRequest: %v", err)
+	}
+	resp.Body.Close()
+
+	if received.Get("X-Debug") != "" {
+		t.Error("X-Debug was not removed by the header rule")
+	}
+	if received.Get("x-api-key") != "acc1" || received.Get("X-Middleware-Client") == "" ||
+		!strings.HasPrefix(received.Get("X-Middleware-Signature"), "t=") {
+		t.Errorf("upstream headers removed by header rule: %v", received)
+	}
+}
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Connection", "keep-alive, X-Hop")
+	header.Set("Keep-Alive", "timeout=5")
+	header.Set("X-Hop", "1")
+	header.Set("Te", "trailers")
+	header.Set("X-End", "1")
+
+	removeHopByHopHeaders(header)
+
+	for _, name := range []string{"Connection", "Keep-Alive", "X-Hop", "Te"} {
+		if header.Get(name) != "" {
+			t.Errorf("%s not removed", name)
+		}
+	}
+	if header.Get("X-End") != "1" {
+		t.Error("end-to-end header X-End removed")
+	}
+}
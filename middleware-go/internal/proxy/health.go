@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"claude-middleware/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 账户数据来源
+const (
+	dataSourceNone     = "none"
+	dataSourceRedis    = "redis"
+	dataSourceSnapshot = "snapshot"
+)
+
+var (
+	redisUpGauge = metrics.NewGauge("redis_up",
+		"Whether the last Redis account refresh succeeded (1) or failed (0)")
+	degradedGauge = metrics.NewGauge("degraded",
+		"Whether the middleware is serving stale account data because Redis is unavailable")
+	lastRefreshGauge = metrics.NewGauge("account_data_last_refresh_timestamp_seconds",
+		"Unix time when the account data in use was loaded from Redis")
+	refreshFailures = metrics.NewCounter("account_refresh_failures_total",
+		"Number of failed account refreshes from Redis")
+)
+
+// errAccountDataStale 账户数据超过允许的最大陈旧时间
+var errAccountDataStale = errors.New("account data is too stale")
+
+// markRefreshSucceeded 记录一次成功的Redis刷新
+func (s *Service) markRefreshSucceeded(refreshedAt time.Time) {
+	s.accountsMutex.Lock()
+	wasDown := !s.redisUp && s.dataSource != dataSourceNone
+	s.redisUp = true
+	s.lastRefreshError = ""
+	s.dataSource = dataSourceRedis
+	s.accountsMutex.Unlock()
+
+	if wasDown {
+		log.Printf("✅ Redis is reachable again, leaving degraded mode")
+	}
+
+	redisUpGauge.Set(1)
+	degradedGauge.Set(0)
+	lastRefreshGauge.Set(float64(refreshedAt.Unix()))
+}
+
+// markRefreshFailed 记录一次失败的Redis刷新，继续使用旧数据
+func (s *Service) markRefreshFailed(err error) {
+	s.accountsMutex.Lock()
+	wasUp := s.redisUp
+	s.redisUp = false
+	s.lastRefreshError = err.Error()
+	s.accountsMutex.Unlock()
+
+	if wasUp {
+		log.Printf("⚠️  Redis is unavailable, entering degraded mode with last-known-good account data")
+	}
+
+	refreshFailures.Inc()
+	redisUpGauge.Set(0)
+	degradedGauge.Set(1)
+}
+
+// isRedisUp 最近一次刷新是否成功
+func (s *Service) isRedisUp() bool {
+	s.accountsMutex.RLock()
+	defer s.accountsMutex.RUnlock()
+	return s.redisUp
+}
+
+// accountDataAge 当前使用的账户数据距离从Redis加载的时间
+func (s *Service) accountDataAge() time.Duration {
+	s.accountsMutex.RLock()
+	defer s.accountsMutex.RUnlock()
+
+	if s.lastRefresh.IsZero() {
+		return 0
+	}
+	return time.Since(s.lastRefresh)
+}
+
+// isAccountDataTooStale Redis不可用且数据超过最大陈旧时间时拒绝使用
+func (s *Service) isAccountDataTooStale() bool {
+	maxStaleness := s.cfg().Accounts.MaxStaleness.Duration
+	if maxStaleness <= 0 || s.isRedisUp() {
+		return false
+	}
+	return s.accountDataAge() > maxStaleness
+}
+
+// HealthHandler 健康检查，Redis不可用时报告degraded
+func (s *Service) HealthHandler(c *gin.Context) {
+	s.accountsMutex.RLock()
+	redisUp := s.redisUp
+	source := s.dataSource
+	accountCount := len(s.activeAccounts)
+	lastRefresh := s.lastRefresh
+	lastError := s.lastRefreshError
+	s.accountsMutex.RUnlock()
+
+	status := "ok"
+	httpStatus := http.StatusOK
+	switch {
+	case s.isAccountDataTooStale() || source == dataSourceNone:
+		status = "unavailable"
+		httpStatus = http.StatusServiceUnavailable
+	case !redisUp:
+		status = "degraded"
+	}
+
+	body := gin.H{
+		"status":   status,
+		"service":  "claude-middleware",
+		"redis":    map[bool]string{true: "up", false: "down"}[redisUp],
+		"accounts": accountCount,
+		"source":   source,
+	}
+	if !lastRefresh.IsZero() {
+		body["lastRefresh"] = lastRefresh.Format(time.RFC3339)
+		body["stalenessSeconds"] = int(time.Since(lastRefresh).Seconds())
+	}
+	if lastError != "" {
+		body["error"] = lastError
+	}
+
+	c.JSON(httpStatus, body)
+}
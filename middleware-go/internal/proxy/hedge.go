@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	hedgedRequests = metrics.NewCounter("hedged_requests_total",
+		"Number of requests that sent a hedge call, by which call answered (primary, hedge or none when both failed)", "winner")
+	hedgeWastedCalls = metrics.NewCounter("hedge_wasted_calls_total",
+		"Number of hedged upstream calls discarded because the other call answered first", "call")
+	hedgeDelaySeconds = metrics.NewGauge("hedge_delay_seconds",
+		"Current hedge delay by model", "model")
+)
+
+// headerLatencies 每个模型最近的上游响应头耗时（环形缓冲），用于计算对冲延迟
+type headerLatencies struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+// observe 记录一次响应头耗时，每个模型最多保留window个样本
+func (l *headerLatencies) observe(model string, latency time.Duration, window int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.samples == nil {
+		l.samples = make(map[string][]time.Duration)
+		l.next = make(map[string]int)
+	}
+	samples := l.samples[model]
+	if len(samples) > window {
+		// 窗口在热加载后变小
+		samples = samples[len(samples)-window:]
+		l.next[model] = 0
+	}
+	if len(samples) < window {
+		l.samples[model] = append(samples, latency)
+		return
+	}
+	i := l.next[model] % window
+	samples[i] = latency
+	l.samples[model] = samples
+	l.next[model] = i + 1
+}
+
+// percentile 返回模型响应头耗时的百分位数，样本不足minSamples时返回false
+func (l *headerLatencies) percentile(model string, p float64, minSamples int) (time.Duration, bool) {
+	l.mu.Lock()
+	samples := append([]time.Duration(nil), l.samples[model]...)
+	l.mu.Unlock()
+
+	if len(samples) < minSamples || len(samples) == 0 {
+		return 0, false
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return samples[int(p*float64(len(samples)-1))], true
+}
+
+// hedgeDelay 对冲延迟：模型响应头耗时的百分位数，限制在 [min_delay, max_delay] 内，样本不足时使用max_delay
+func (s *Service) hedgeDelay(cfg config.HedgeConfig, model string) time.Duration {
+	delay, ok := s.headerLatencies.percentile(model, cfg.Percentile, cfg.MinSamples)
+	switch {
+	case !ok || delay > cfg.MaxDelay.Duration:
+		delay = cfg.MaxDelay.Duration
+	case delay < cfg.MinDelay.Duration:
+		delay = cfg.MinDelay.Duration
+	}
+	hedgeDelaySeconds.Set(delay.Seconds(), model)
+	return delay
+}
+
+// shouldHedge 判断请求是否启用对冲：只对冲不超过大小上限的非流式请求，并且客户端在启用列表中
+func shouldHedge(cfg config.HedgeConfig, apiKey string, client clientIdentity, body *requestBody, stream bool) bool {
+	if !cfg.Enabled || stream {
+		return false
+	}
+	if cfg.MaxBodySize > 0 && body.Len() > int64(cfg.MaxBodySize) {
+		return false
+	}
+	return len(cfg.Clients) == 0 || clientListed(cfg.Clients, apiKey, client)
+}
+
+// hedgeCall 对冲中一次上游调用的结果
+type hedgeCall struct {
+	accountID string
+	hedge     bool // 是否为对冲请求
+	resp      *http.Response
+	err       error
+	latency   time.Duration // 从发出请求到收到响应头的耗时
+	cancel    context.CancelFunc
+}
+
+// ok 调用是否成功返回了2xx响应
+func (call hedgeCall) ok() bool {
+	return call.err == nil && call.resp.StatusCode >= 200 && call.resp.StatusCode < 300
+}
+
+// cancelOnClose 关闭响应体时取消对应请求的context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// sendHedged 使用accountID发送请求，在delay内没有收到响应头时用另一个可用账户发送同一请求
+//
+// 返回先成功的调用并取消另一个调用；先失败的调用会等待另一个调用的结果，
+// 两个都失败时返回后结束的调用。发出过对冲请求的账户都会加入triedAccounts，
+// 对冲账户的并发名额记录在leases中，未被返回的调用的名额立即释放。
+// winner为 primary、hedge 或 none（都失败），未发出对冲请求时为空
+func (s *Service) sendHedged(c *gin.Context, target *upstreamTarget, accountID, apiKey string, client clientIdentity, triedAccounts map[string]bool, leases *accountLeases, delay time.Duration) (result hedgeCall, winner string) {
+	calls := make(chan hedgeCall, 2)
+	var cancels []context.CancelFunc
+	send := func(accountID string, hedge bool) {
+		// 不跟随客户端请求的context，与普通请求一样由上游超时控制
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels = append(cancels, cancel)
+		s.chargeTokens(accountID, target.inputTokens)
+		go func() {
+			sentAt := time.Now()
+			resp, err := s.sendProxyRequest(ctx, c, target.url.String(), target.body, accountID, client, target.tr)
+			calls <- hedgeCall{accountID: accountID, hedge: hedge, resp: resp, err: err, latency: time.Since(sentAt), cancel: cancel}
+		}()
+	}
+
+	send(accountID, false)
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	timeout := timer.C
+
+	for {
+		select {
+		case <-timeout:
+			timeout = nil
+			hedgeAccountID, err := s.selectAvailableAccountExcluding(apiKey, triedAccounts)
+			if err == nil && (s.isAccountRateLimited(hedgeAccountID) || s.isAccountProblematic(hedgeAccountID)) {
+				s.releaseAccount(hedgeAccountID)
+				err = errNoReadyAccount
+			}
+			if err != nil {
+				log.Printf("⏱️  No spare account to hedge %s after %v", c.Request.URL.Path, delay)
+				continue
+			}
+			log.Printf("⏱️  Account %s has not answered %s within %v, hedging with account %s",
+				accountID, c.Request.URL.Path, delay, hedgeAccountID)
+			triedAccounts[hedgeAccountID] = true
+			leases.add(hedgeAccountID)
+			send(hedgeAccountID, true)
+			pending++
+			winner = "none"
+
+		case call := <-calls:
+			pending--
+			if !call.ok() && pending > 0 {
+				// 另一个调用仍在进行，等待它的结果
+				s.discardHedgeCall(call, c.Request.URL.Path)
+				leases.release(call.accountID)
+				continue
+			}
+
+			if pending > 0 {
+				// 取消仍在进行的调用，等待其返回，避免请求结束后继续使用gin.Context
+				for i, cancel := range cancels {
+					if i != callIndex(call.hedge) {
+						cancel()
+					}
+				}
+				for ; pending > 0; pending-- {
+					loser := <-calls
+					if loser.resp != nil {
+						loser.resp.Body.Close()
+					}
+					leases.release(loser.accountID)
+					hedgeWastedCalls.Inc(callName(loser.hedge))
+				}
+			}
+
+			if call.ok() && winner != "" {
+				winner = callName(call.hedge)
+			}
+			if winner != "" {
+				hedgedRequests.Inc(winner)
+				log.Printf("🏁 Hedged request %s answered by %s call (account %s)", c.Request.URL.Path, winner, call.accountID)
+			}
+			if call.resp != nil {
+				call.resp.Body = cancelOnClose{call.resp.Body, call.cancel}
+			} else {
+				call.cancel()
+			}
+			return call, winner
+		}
+	}
+}
+
+// discardHedgeCall 丢弃先失败的对冲调用，并像普通请求一样标记账户状态
+func (s *Service) discardHedgeCall(call hedgeCall, requestPath string) {
+	defer call.cancel()
+	if call.err != nil {
+		log.Printf("Hedged %s call failed for account %s on %s: %v", callName(call.hedge), call.accountID, requestPath, call.err)
+		s.markAccountAsProblematic(call.accountID, "network_error")
+		return
+	}
+	defer call.resp.Body.Close()
+	log.Printf("Hedged %s call returned status %d for account %s on %s", callName(call.hedge), call.resp.StatusCode, call.accountID, requestPath)
+	if s.shouldMarkAccountAsProblematic(call.resp.StatusCode) {
+		s.markAccountAsProblematic(call.accountID, fmt.Sprintf("http_error_%d", call.resp.StatusCode))
+	}
+}
+
+// callIndex 调用在发送顺序中的位置
+func callIndex(hedge bool) int {
+	if hedge {
+		return 1
+	}
+	return 0
+}
+
+// callName 指标和日志中的调用名称
+func callName(hedge bool) string {
+	if hedge {
+		return "hedge"
+	}
+	return "primary"
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-middleware/internal/config"
+)
+
+func TestShouldHedge(t *testing.T) {
+	cfg := config.HedgeConfig{Enabled: true, MaxBodySize: 1024}
+	client := clientIdentity{ID: "key_1", Name: "ci"}
+	small := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`
+
+	tests := []struct {
+		name    string
+		cfg     func(cfg config.HedgeConfig) config.HedgeConfig
+		target  string
+		payload string
+		want    bool
+	}{
+		{"non-streaming", nil, "/v1/messages", small, true},
+		{"disabled", func(cfg config.HedgeConfig) config.HedgeConfig { cfg.Enabled = false; return cfg }, "/v1/messages", small, false},
+		{"stream field", nil, "/v1/messages", `{"model":"claude-sonnet-4","stream":true}`, false},
+		{"gemini generateContent", nil, "/gemini/v1beta/models/gemini-2.5-pro:generateContent", `{"contents":[]}`, true},
+		{"gemini streamGenerateContent", nil, "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent", `{"contents":[]}`, false},
+		{"gemini sse", nil, "/gemini/v1beta/models/gemini-2.5-pro:streamGenerateContent?alt=sse", `{"contents":[]}`, false},
+		{"body too large", nil, "/v1/messages", `{"system":"` + strings.Repeat("a", 2048) + `"}`, false},
+		{"client listed", func(cfg config.HedgeConfig) config.HedgeConfig { cfg.Clients = []string{"ci"}; return cfg }, "/v1/messages", small, true},
+		{"client not listed", func(cfg config.HedgeConfig) config.HedgeConfig { cfg.Clients = []string{"batch"}; return cfg }, "/v1/messages", small, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hedgeCfg := cfg
+			if tt.cfg != nil {
+				hedgeCfg = tt.cfg(cfg)
+			}
+			body, err := readRequestBody(strings.NewReader(tt.payload), 1<<20, "")
+			if err != nil {
+				t.Fatalf("readRequestBody: %v", err)
+			}
+			defer body.Close()
+
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			stream := isStreamRequest(r, body.Metadata().Stream)
+			if got := shouldHedge(hedgeCfg, "sk-client", client, body, stream); got != tt.want {
+				t.Errorf("shouldHedge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+
+	"claude-middleware/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var clientRequests = metrics.NewCounter("client_requests_total",
+	"Number of proxied requests by client identity and response status", "client", "team", "status")
+
+// anonymousClientID 未携带API Key的请求
+const anonymousClientID = "anonymous"
+
+// clientIdentity 发起请求的客户端，用于上游归属统计、日志与指标
+type clientIdentity struct {
+	ID   string // Node.js API Key ID、证书身份或API Key指纹，不包含密钥本身
+	Name string
+	Team string
+}
+
+// resolveClientIdentity 根据认证结果确定客户端身份
+func (s *Service) resolveClientIdentity(c *gin.Context, apiKey string) clientIdentity {
+	if apiKey == "" {
+		return clientIdentity{ID: anonymousClientID}
+	}
+
+	var identity clientIdentity
+	if c.GetString("auth_method") == "client_cert" {
+		// 证书映射出的身份本身不是密钥，可以直接使用
+		identity.ID = apiKey
+	} else if info, _ := s.lookupKeyInfo(apiKey); info.keyID != "" {
+		identity.ID = info.keyID
+		identity.Name = info.keyName
+	} else {
+		identity.ID = keyFingerprint(apiKey)
+	}
+
+	// 配置中的名称和团队可以用API Key本身或其ID指定
+	auth := s.cfg().Auth
+	for _, key := range []string{apiKey, identity.ID} {
+		if name, ok := auth.ClientNames[key]; ok {
+			identity.Name = name
+		}
+		if team, ok := auth.ClientTeams[key]; ok {
+			identity.Team = team
+		}
+	}
+	return identity
+}
+
+// keyFingerprint 不可逆的API Key标识，避免在日志和上游暴露密钥
+func keyFingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// headerValue 身份请求头的值，形如 "id=...&name=...&team=..."
+func (id clientIdentity) headerValue() string {
+	values := url.Values{}
+	values.Set("id", id.ID)
+	if id.Name != "" {
+		values.Set("name", id.Name)
+	}
+	if id.Team != "" {
+		values.Set("team", id.Team)
+	}
+	return values.Encode()
+}
+
+// String 日志中使用的客户端描述
+func (id clientIdentity) String() string {
+	if id.Name != "" {
+		return id.ID + " (" + id.Name + ")"
+	}
+	return id.ID
+}
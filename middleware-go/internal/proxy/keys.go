@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// errKeyInfoUnavailable Redis不可用或查询失败，无法确定API Key的共享池和专属账户
+var errKeyInfoUnavailable = errors.New("api key info is unavailable")
+
+// keyInfoEntry 客户端API Key在Node.js服务中的关联信息缓存项
+type keyInfoEntry struct {
+	keyID          string   // Node.js服务中的API Key ID
+	keyName        string   // Node.js服务中的API Key名称
+	poolIDs        []string // 关联的共享池
+	boundAccountID string   // 绑定的专属账户
+	restricted     []string // Node.js服务中禁止使用的模型
+	expiresAt      time.Time
+}
+
+// lookupKeyInfo 查询API Key在Redis中的关联信息（带缓存）
+// 无法确定共享池或专属账户时返回errKeyInfoUnavailable，调用方不能把这种情况当作未限制处理
+func (s *Service) lookupKeyInfo(apiKey string) (keyInfoEntry, error) {
+	if apiKey == "" {
+		return keyInfoEntry{}, nil
+	}
+
+	s.keyInfoMutex.RLock()
+	entry, exists := s.keyInfoCache[apiKey]
+	s.keyInfoMutex.RUnlock()
+
+	if exists && time.Now().Before(entry.expiresAt) {
+		return entry, nil
+	}
+
+	// Redis不可用时继续使用已缓存的信息，避免每个请求都等待连接超时
+	if !s.isRedisUp() {
+		if exists {
+			return entry, nil
+		}
+		return keyInfoEntry{}, fmt.Errorf("%w: redis is down", errKeyInfoUnavailable)
+	}
+
+	cfg := s.cfg()
+	entry = keyInfoEntry{
+		expiresAt: time.Now().Add(cfg.SharedPool.CacheTTL.Duration),
+	}
+
+	keyID, err := s.redisClient.FindAPIKeyID(apiKey, cfg.SharedPool.EncryptionKey)
+	if err != nil {
+		log.Printf("⚠️  Failed to resolve api key: %v", err)
+		return keyInfoEntry{}, fmt.Errorf("%w: %v", errKeyInfoUnavailable, err)
+	}
+	entry.keyID = keyID
+
+	if keyID != "" {
+		if name, err := s.redisClient.GetAPIKeyName(keyID); err != nil {
+			log.Printf("⚠️  %v", err)
+		} else {
+			entry.keyName = name
+		}
+
+		if cfg.Models.Enabled && cfg.Models.UseNodeLimits {
+			if models, err := s.redisClient.GetAPIKeyRestrictedModels(keyID); err != nil {
+				log.Printf("⚠️  %v", err)
+			} else {
+				entry.restricted = models
+			}
+		}
+
+		if cfg.SharedPool.Enabled {
+			poolIDs, err := s.redisClient.GetAPIKeyPoolIDs(keyID)
+			if err != nil {
+				log.Printf("⚠️  Failed to get shared pools for api key %s: %v", keyID, err)
+				return keyInfoEntry{keyID: keyID, keyName: entry.keyName, restricted: entry.restricted},
+					fmt.Errorf("%w: %v", errKeyInfoUnavailable, err)
+			}
+			entry.poolIDs = poolIDs
+		}
+
+		if cfg.Binding.UseNodeBindings {
+			accountID, err := s.redisClient.GetAPIKeyBoundAccountID(keyID)
+			if err != nil {
+				log.Printf("⚠️  %v", err)
+				return keyInfoEntry{keyID: keyID, keyName: entry.keyName, poolIDs: entry.poolIDs, restricted: entry.restricted},
+					fmt.Errorf("%w: %v", errKeyInfoUnavailable, err)
+			}
+			entry.boundAccountID = accountID
+		}
+	}
+
+	s.keyInfoMutex.Lock()
+	s.keyInfoCache[apiKey] = entry
+	s.keyInfoMutex.Unlock()
+
+	return entry, nil
+}
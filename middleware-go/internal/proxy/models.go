@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"claude-middleware/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelsPathPrefixes 由中间层直接返回模型列表的路径
+var modelsPathPrefixes = []string{
+	"/v1/models",
+	"/api/v1/models",
+	"/claude/v1/models",
+	"/openai/claude/v1/models",
+}
+
+// serveModels 处理模型列表和模型详情请求，返回false表示请求不是模型列表请求
+// 带有anthropic-version头的请求返回Anthropic格式，其余返回OpenAI格式（/openai/路径始终为OpenAI格式）
+func (s *Service) serveModels(c *gin.Context, apiKey string) bool {
+	cfg := s.cfg().Models
+	if !cfg.Enabled || c.Request.Method != http.MethodGet {
+		return false
+	}
+
+	path := strings.TrimSuffix(c.Request.URL.Path, "/")
+	var modelID string
+	matched := false
+	for _, prefix := range modelsPathPrefixes {
+		if path == prefix {
+			matched = true
+			break
+		}
+		if id, ok := strings.CutPrefix(path, prefix+"/"); ok && id != "" && !strings.Contains(id, "/") {
+			matched, modelID = true, id
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+
+	anthropic := c.GetHeader("anthropic-version") != "" && !strings.HasPrefix(path, "/openai/")
+	models := s.allowedModels(cfg, apiKey)
+
+	if modelID == "" {
+		if anthropic {
+			c.JSON(http.StatusOK, anthropicModelList(models))
+		} else {
+			c.JSON(http.StatusOK, openAIModelList(models))
+		}
+		return true
+	}
+
+	for _, model := range models {
+		if model.ID != modelID {
+			continue
+		}
+		if anthropic {
+			c.JSON(http.StatusOK, anthropicModel(model))
+		} else {
+			c.JSON(http.StatusOK, openAIModel(model))
+		}
+		return true
+	}
+
+	message := "Model '" + modelID + "' not found"
+	if anthropic {
+		c.JSON(http.StatusNotFound, gin.H{
+			"type":  "error",
+			"error": gin.H{"type": "not_found_error", "message": message},
+		})
+	} else {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{"message": message, "type": "invalid_request_error", "code": "model_not_found"},
+		})
+	}
+	return true
+}
+
+// allowedModels 返回API Key可见的模型
+// 中间层配置的允许列表（按API Key或Key ID）优先，再排除Node.js服务中禁止使用的模型
+func (s *Service) allowedModels(cfg config.ModelsConfig, apiKey string) []config.ModelInfo {
+	var info keyInfoEntry
+	if apiKey != "" && (cfg.UseNodeLimits || len(cfg.Allowed) > 0) {
+		// 查询失败时按已知信息过滤，模型列表只用于展示
+		info, _ = s.lookupKeyInfo(apiKey)
+	}
+
+	allowed, limited := cfg.Allowed[apiKey]
+	if !limited && info.keyID != "" {
+		allowed, limited = cfg.Allowed[info.keyID]
+	}
+
+	excluded := make(map[string]bool, len(info.restricted))
+	for _, id := range info.restricted {
+		excluded[id] = true
+	}
+	permitted := make(map[string]bool, len(allowed))
+	for _, id := range allowed {
+		permitted[id] = true
+	}
+
+	models := make([]config.ModelInfo, 0, len(cfg.Registry))
+	for _, model := range cfg.Registry {
+		if excluded[model.ID] || (limited && !permitted[model.ID]) {
+			continue
+		}
+		models = append(models, model)
+	}
+	return models
+}
+
+// modelCreated 模型发布日期，未配置时为Unix纪元
+func modelCreated(model config.ModelInfo) time.Time {
+	created, err := time.Parse(time.DateOnly, model.Created)
+	if err != nil {
+		return time.Unix(0, 0).UTC()
+	}
+	return created
+}
+
+func openAIModel(model config.ModelInfo) gin.H {
+	return gin.H{
+		"id":       model.ID,
+		"object":   "model",
+		"created":  modelCreated(model).Unix(),
+		"owned_by": model.OwnedBy,
+	}
+}
+
+func openAIModelList(models []config.ModelInfo) gin.H {
+	data := make([]gin.H, 0, len(models))
+	for _, model := range models {
+		data = append(data, openAIModel(model))
+	}
+	return gin.H{"object": "list", "data": data}
+}
+
+func anthropicModel(model config.ModelInfo) gin.H {
+	displayName := model.DisplayName
+	if displayName == "" {
+		displayName = model.ID
+	}
+	return gin.H{
+		"type":         "model",
+		"id":           model.ID,
+		"display_name": displayName,
+		"created_at":   modelCreated(model).Format(time.RFC3339),
+	}
+}
+
+func anthropicModelList(models []config.ModelInfo) gin.H {
+	data := make([]gin.H, 0, len(models))
+	for _, model := range models {
+		data = append(data, anthropicModel(model))
+	}
+	list := gin.H{"data": data, "has_more": false, "first_id": nil, "last_id": nil}
+	if len(models) > 0 {
+		list["first_id"] = models[0].ID
+		list["last_id"] = models[len(models)-1].ID
+	}
+	return list
+}
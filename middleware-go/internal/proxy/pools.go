@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"claude-middleware/internal/redis"
+)
+
+// 共享池账户选择策略（与Node.js服务保持一致）
+const (
+	strategyLeastUsed  = "least_used"
+	strategyRoundRobin = "round_robin"
+	strategyRandom     = "random"
+
+	// strategyLeastTokens 按最近估算输入Token数均衡（仅中间层支持）
+	// 全局策略为least_tokens时，使用least_used策略的共享池同样按Token均衡
+	strategyLeastTokens = "least_tokens"
+)
+
+// errAssignedPoolsInactive API Key关联的共享池都已停用或不存在
+var errAssignedPoolsInactive = errors.New("shared pools assigned to api key are inactive")
+
+// resolvePools 解析API Key可以使用的共享池，返回nil表示不限制账户范围
+// 无法查询API Key关联的共享池时返回错误，避免受限的API Key使用其他共享池的账户
+func (s *Service) resolvePools(apiKey string) ([]redis.SharedPool, error) {
+	if !s.cfg().SharedPool.Enabled {
+		return nil, nil
+	}
+
+	s.accountsMutex.RLock()
+	allPools := s.sharedPools
+	s.accountsMutex.RUnlock()
+
+	// Redis中没有配置任何共享池时保持原有行为
+	if len(allPools) == 0 {
+		return nil, nil
+	}
+
+	poolsByID := make(map[string]redis.SharedPool, len(allPools))
+	for _, pool := range allPools {
+		poolsByID[pool.ID] = pool
+	}
+
+	info, err := s.lookupKeyInfo(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. API Key显式关联的共享池，全部停用时不扩大到其他共享池
+	if len(info.poolIDs) > 0 {
+		pools := []redis.SharedPool{}
+		for _, poolID := range info.poolIDs {
+			if pool, ok := poolsByID[poolID]; ok && pool.IsActive {
+				pools = append(pools, pool)
+			}
+		}
+		if len(pools) == 0 {
+			return nil, fmt.Errorf("%w: %v", errAssignedPoolsInactive, info.poolIDs)
+		}
+		sort.SliceStable(pools, func(i, j int) bool {
+			return pools[i].Priority > pools[j].Priority
+		})
+		return pools, nil
+	}
+
+	// 2. 默认共享池
+	if pool, ok := poolsByID[redis.DefaultSharedPoolID]; ok && pool.IsActive {
+		return []redis.SharedPool{pool}, nil
+	}
+
+	// 3. 所有激活的共享池（allPools已按优先级排序）
+	var pools []redis.SharedPool
+	for _, pool := range allPools {
+		if pool.IsActive {
+			pools = append(pools, pool)
+		}
+	}
+	return pools, nil
+}
+
+// accountsInPool 返回属于指定共享池的账户
+func accountsInPool(accounts []redis.ClaudeAccount, pool redis.SharedPool) []redis.ClaudeAccount {
+	members := make(map[string]bool, len(pool.AccountIDs))
+	for _, id := range pool.AccountIDs {
+		members[id] = true
+	}
+
+	var result []redis.ClaudeAccount
+	for _, account := range accounts {
+		if members[account.ID] {
+			result = append(result, account)
+		}
+	}
+	return result
+}
+
+// pickByStrategy 按共享池策略从可用账户中选择一个
+func (s *Service) pickByStrategy(pool redis.SharedPool, available []redis.ClaudeAccount) redis.ClaudeAccount {
+	switch pool.AccountSelectionStrategy {
+	case strategyRoundRobin:
+		// 按ID排序保证轮询顺序稳定
+		sort.Slice(available, func(i, j int) bool {
+			return available[i].ID < available[j].ID
+		})
+
+		s.roundRobinMutex.Lock()
+		index := s.roundRobinIndex[pool.ID]
+		s.roundRobinIndex[pool.ID] = index + 1
+		s.roundRobinMutex.Unlock()
+
+		return available[index%uint64(len(available))]
+	case strategyRandom:
+		return available[rand.Intn(len(available))]
+	case strategyLeastTokens:
+		s.sortByEstimatedTokens(available)
+		return available[0]
+	default:
+		if s.cfg().Selection.Strategy == strategyLeastTokens {
+			s.sortByEstimatedTokens(available)
+		} else {
+			sortByLastUsed(available)
+		}
+		return available[0]
+	}
+}
+
+// sortByLastUsed 按最后使用时间排序，最久未使用的在前
+func sortByLastUsed(accounts []redis.ClaudeAccount) {
+	sort.Slice(accounts, func(i, j int) bool {
+		timeI, _ := time.Parse(time.RFC3339, accounts[i].LastUsedAt)
+		timeJ, _ := time.Parse(time.RFC3339, accounts[j].LastUsedAt)
+		return timeI.Before(timeJ)
+	})
+}
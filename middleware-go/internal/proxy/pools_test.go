@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"claude-middleware/internal/redis"
+)
+
+func TestResolvePools(t *testing.T) {
+	t.Setenv("SHARED_POOL_ENABLED", "true")
+	s := newConfigService(t)
+	s.sharedPools = []redis.SharedPool{
+		{ID: "high", IsActive: true, Priority: 10},
+		{ID: redis.DefaultSharedPoolID, IsActive: true},
+		{ID: "low", IsActive: true, Priority: 1},
+		{ID: "off", IsActive: false},
+	}
+	fresh := time.Now().Add(time.Minute)
+	s.keyInfoCache = map[string]keyInfoEntry{
+		"assigned":     {keyID: "k1", poolIDs: []string{"low", "high"}, expiresAt: fresh},
+		"inactive":     {keyID: "k2", poolIDs: []string{"off", "deleted"}, expiresAt: fresh},
+		"unassigned":   {keyID: "k3", expiresAt: fresh},
+		"stale":        {keyID: "k4", poolIDs: []string{"low"}, expiresAt: time.Now().Add(-time.Minute)},
+		"unknown-node": {expiresAt: fresh},
+	}
+
+	tests := []struct {
+		apiKey  string
+		want    string
+		wantErr error
+	}{
+		{"assigned", "high,low", nil},
+		{"inactive", "", errAssignedPoolsInactive},
+		{"unassigned", redis.DefaultSharedPoolID, nil},
+		{"unknown-node", redis.DefaultSharedPoolID, nil},
+		// Redis不可用时使用过期的缓存，没有缓存时拒绝
+		{"stale", "low", nil},
+		{"uncached", "", errKeyInfoUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.apiKey, func(t *testing.T) {
+			pools, err := s.resolvePools(tt.apiKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("resolvePools() error = %v, want %v", err, tt.wantErr)
+			}
+			ids := make([]string, len(pools))
+			for i, pool := range pools {
+				ids[i] = pool.ID
+			}
+			if got := strings.Join(ids, ","); got != tt.want {
+				t.Errorf("resolvePools() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePoolsFallsBackToActivePools(t *testing.T) {
+	t.Setenv("SHARED_POOL_ENABLED", "true")
+	s := newConfigService(t)
+	s.sharedPools = []redis.SharedPool{
+		{ID: "a", IsActive: true, Priority: 5},
+		{ID: "off", IsActive: false},
+		{ID: "b", IsActive: true},
+	}
+	s.keyInfoCache = map[string]keyInfoEntry{"key": {keyID: "k1", expiresAt: time.Now().Add(time.Minute)}}
+
+	pools, err := s.resolvePools("key")
+	if err != nil || len(pools) != 2 || pools[0].ID != "a" || pools[1].ID != "b" {
+		t.Errorf("resolvePools() = %+v, %v, want active pools a,b", pools, err)
+	}
+}
@@ -1,218 +1,435 @@
 package proxy
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"claude-middleware/internal/accesslog"
+	"claude-middleware/internal/auth"
+	"claude-middleware/internal/cache"
+	"claude-middleware/internal/capture"
 	"claude-middleware/internal/config"
 	"claude-middleware/internal/redis"
 )
 
 type Service struct {
 	redisClient *redis.Client
-	config      *config.Config
+	configs     *config.Manager
 	targetURL   *url.URL
 	httpClient  *http.Client
+	headerRules atomic.Pointer[headerRules]
+	capture     *capture.Recorder
+	accessLog   *accesslog.Logger
+	responseCache *cache.Cache
 	
 	// 负载均衡状态
 	accountsMutex     sync.RWMutex
 	activeAccounts    []redis.ClaudeAccount
+	sharedPools       []redis.SharedPool
 	lastRefresh       time.Time
 	
+	// Redis可用性（Redis不可用时使用最近一次成功加载的数据）
+	redisUp           bool
+	dataSource        string
+	lastRefreshError  string
+	
+	// 共享池与专属账户状态
+	keyInfoCache      map[string]keyInfoEntry // API Key -> 关联的共享池、专属账户
+	keyInfoMutex      sync.RWMutex
+	roundRobinIndex   map[string]uint64        // poolID -> 轮询位置
+	roundRobinMutex   sync.Mutex
+	
 	// 账户状态标记（仅内存，不写入Redis）
-	rateLimitedCache  map[string]time.Time  // accountID -> 限流结束时间
+	rateLimitedCache  map[string]time.Time  // accountID -> 限流开始时间
 	problematicCache  map[string]time.Time  // accountID -> 问题恢复时间
 	rateLimitMutex    sync.RWMutex
+	
+	// 非流式请求的上游响应头耗时，用于计算对冲延迟
+	headerLatencies   headerLatencies
+	
+	// 没有可用账户时的准入队列
+	admission         *admissionQueue
+	
+	// 每个账户正在处理的请求数
+	inFlight          inFlightTracker
+	
+	// 每个账户最近的估算输入Token数（least_tokens策略）
+	tokenMeter        tokenMeter
+	
+	// 进行中的可合并请求
+	flights           flightGroup
 }
 
-func NewService(redisClient *redis.Client, cfg *config.Config) *Service {
+func NewService(redisClient *redis.Client, configs *config.Manager) *Service {
+	cfg := configs.Current()
 	targetURL, err := url.Parse(cfg.Proxy.TargetURL)
 	if err != nil {
 		log.Fatalf("Invalid target URL: %v", err)
 	}
 	
+	httpClient, err := newHTTPClient(cfg.Proxy)
+	if err != nil {
+		log.Fatalf("Invalid upstream transport config: %v", err)
+	}
+	
 	service := &Service{
 		redisClient:      redisClient,
-		config:          cfg,
-		targetURL:       targetURL,
+		configs:          configs,
+		targetURL:        targetURL,
 		rateLimitedCache: make(map[string]time.Time),
 		problematicCache: make(map[string]time.Time),
-		httpClient: &http.Client{
-			Timeout: time.Duration(cfg.Proxy.Timeout) * time.Second,
-		},
+		keyInfoCache:     make(map[string]keyInfoEntry),
+		roundRobinIndex:  make(map[string]uint64),
+		dataSource:       dataSourceNone,
+		httpClient:       httpClient,
+		admission:        newAdmissionQueue(),
 	}
 	
-	// 初始加载账户
-	service.refreshAccounts()
+	// 请求头/响应头规则，配置热加载后重新编译
+	service.loadHeaderRules(cfg)
+	configs.OnReload(service.loadHeaderRules)
+	
+	service.accessLog, err = accesslog.New(cfg.AccessLog)
+	if err != nil {
+		log.Fatalf("Invalid access log config: %v", err)
+	}
+	
+	// 确定性请求的响应缓存
+	service.responseCache = cache.New(cfg.Cache, redisClient)
+	
+	// 调试抓取，支持热加载开启/关闭
+	service.capture = capture.NewRecorder(cfg.Capture)
+	configs.OnReload(func(newConfig *config.Config) {
+		service.capture.Configure(newConfig.Capture)
+		service.updateConcurrencyMetrics()
+		service.admission.notify()
+	})
+	
+	// 初始加载账户，Redis不可用时从本地快照启动
+	if err := service.refreshAccounts(); err != nil {
+		service.loadAccountSnapshot()
+	}
 	
 	// 启动定期刷新协程
 	go service.accountRefreshWorker()
 	
+	// 准入队列调度协程
+	go service.admissionWorker()
+	
 	return service
 }
 
+// cfg 返回当前生效的配置（支持热加载）
+func (s *Service) cfg() *config.Config {
+	return s.configs.Current()
+}
+
 // ProxyHandler 处理所有代理请求
 func (s *Service) ProxyHandler(c *gin.Context) {
 	// 记录请求路径
 	requestPath := c.Request.URL.Path
 	log.Printf("Processing request: %s %s", c.Request.Method, requestPath)
 	
-	// 选择可用的Claude账户ID
-	accountID, err := s.selectAvailableAccount()
-	if err != nil {
-		log.Printf("Failed to select account for %s: %v", requestPath, err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "No available Claude accounts"})
-		return
+	// 客户端API Key，用于确定可使用的共享池
+	apiKey := clientAPIKey(c)
+	client := s.resolveClientIdentity(c, apiKey)
+	
+	// 访问日志记录，请求结束时写入
+	record := &accesslog.Record{
+		Time:       time.Now(),
+		Method:     c.Request.Method,
+		Path:       requestPath,
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		ClientTeam: client.Team,
 	}
+	defer func() {
+		record.Status = c.Writer.Status()
+		record.DurationMs = time.Since(record.Time).Milliseconds()
+		if size := c.Writer.Size(); size > 0 {
+			record.ResponseBytes = int64(size)
+		}
+		s.accessLog.Write(record)
+		clientRequests.Inc(client.ID, client.Team, strconv.Itoa(record.Status))
+	}()
 	
-	log.Printf("Selected account %s for %s", accountID, requestPath)
+	// 模型列表由中间层根据配置直接返回，不转发到上游
+	if s.serveModels(c, apiKey) {
+		return
+	}
 	
-	// 读取请求体
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	// 读取请求体，重试时需要重新发送
+	proxyCfg := s.cfg().Proxy
+	if proxyCfg.MaxBodySize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(proxyCfg.MaxBodySize))
+	}
+	body, err := readRequestBody(c.Request.Body, int64(proxyCfg.BodyMemoryLimit), proxyCfg.BodySpillDir)
 	if err != nil {
+		if isBodyTooLarge(err) {
+			log.Printf("Request body too large for %s (limit %d bytes)", requestPath, proxyCfg.MaxBodySize)
+			record.Error = "request_body_too_large"
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Request body too large",
+				"message": fmt.Sprintf("Request body must not exceed %d bytes", proxyCfg.MaxBodySize),
+			})
+			return
+		}
+		log.Printf("Failed to read request body for %s: %v", requestPath, err)
+		record.Error = "request_body_unreadable"
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Failed to read request body"})
 		return
 	}
+	defer body.Close()
+	metadata := body.Metadata()
+	record.RequestBytes = body.Len()
+	record.Model = metadata.Model
+	record.Stream = metadata.Stream
 	
-	// 重新设置请求体，以便后续使用
-	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-	
-	// 创建目标URL
-	targetURL := *s.targetURL
-	targetURL.Path = c.Request.URL.Path
-	targetURL.RawQuery = c.Request.URL.RawQuery
+	// 按采样率抓取请求/响应，用于排查问题
+	exchange := s.capture.Sample(c.Request, client.ID, client.Name)
+	if exchange != nil {
+		if reader, err := body.Reader(); err == nil {
+			exchange.SetRequestBody(reader, s.capture.MaxBodySize())
+			reader.Close()
+		}
+		defer func() {
+			s.capture.Record(exchange, c.Writer.Status())
+		}()
+	}
 	
-	// 创建新的请求
-	proxyReq, err := http.NewRequest(c.Request.Method, targetURL.String(), bytes.NewReader(bodyBytes))
+	// 需要在中间件内转换格式的请求（OpenAI/Gemini ↔ Anthropic Messages）
+	target, err := s.newUpstreamTarget(s.cfg().Translate, c.Request, body, metadata.Model)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create proxy request"})
+		log.Printf("Failed to translate request for %s: %v", requestPath, err)
+		record.Error = "request_translation_failed"
+		status, errorBody := translationFailure(err)
+		c.Data(status, "application/json", errorBody)
+		return
+	}
+	if target.tr != nil && record.Model == "" {
+		// Gemini格式的模型和流式标记在路径中，从转换后的请求体获取
+		metadata := target.tr.body.Metadata()
+		record.Model = metadata.Model
+		record.Stream = metadata.Stream
+		target.model = metadata.Model
+	}
+	// 相同的确定性请求直接返回缓存的响应
+	cached, served := s.lookupCache(c, body, apiKey, client, record)
+	if served {
 		return
 	}
 	
-	// 复制原始请求头，并设置x-api-key为账户ID
-	for key, values := range c.Request.Header {
-		if strings.ToLower(key) == "x-api-key" {
-			// 替换x-api-key为账户ID
-			proxyReq.Header.Set("x-api-key", accountID)
-		} else if strings.ToLower(key) != "host" {
-			// 复制其他请求头（除了host）
-			for _, value := range values {
-				proxyReq.Header.Add(key, value)
+	// 未转换格式的Gemini请求的流式标记在路径和查询参数中，合并和对冲请求都不处理流式请求
+	stream := isStreamRequest(c.Request, record.Stream)
+	
+	// 相同的进行中非流式请求只请求一次上游
+	lead, served := s.coalesce(c, body, client, stream, record)
+	if served {
+		return
+	}
+	if lead != nil {
+		defer lead.finish(c)
+	}
+	
+	target.inputTokens = s.estimateInputTokens(body)
+	record.EstimatedInputTokens = target.inputTokens
+	
+	// 账户池耗尽时依次尝试降级链中的模型
+	fallbacks := s.fallbackChain(target.model)
+	fallback := func() bool {
+		for len(fallbacks) > 0 {
+			next := fallbacks[0]
+			fallbacks = fallbacks[1:]
+			nextTarget, err := s.fallbackTarget(c.Request, body, next)
+			if err != nil {
+				log.Printf("⚠️  Skipping fallback model %s for %s: %v", next, requestPath, err)
+				continue
 			}
+			log.Printf("↪️  Account pool exhausted for %s, falling back from %s to %s", requestPath, target.model, next)
+			modelFallbacks.Inc(target.model, next)
+			nextTarget.inputTokens = target.inputTokens
+			target = nextTarget
+			record.ServedModel = next
+			return true
 		}
+		return false
 	}
 	
-	// 如果原始请求没有x-api-key，添加一个
-	if proxyReq.Header.Get("x-api-key") == "" {
-		proxyReq.Header.Set("x-api-key", accountID)
-	}
+	retry := s.cfg().Retry
 	
-	// 设置正确的Host
-	proxyReq.Host = s.targetURL.Host
+	// 请求占用的账户并发名额，请求结束时释放
+	leases := &accountLeases{s: s}
+	defer leases.releaseAll()
 	
-	// 发送请求
-	resp, err := s.httpClient.Do(proxyReq)
-	if err != nil {
-		log.Printf("Proxy request failed for account %s on %s: %v", accountID, requestPath, err)
-		
-		// 标记账户为有问题的账户
-		s.markAccountAsProblematic(accountID, "network_error")
-		
-		// 如果请求失败，可能是账户问题，尝试其他账户
-		if retryAccountID, retryErr := s.selectAvailableAccountExcluding(accountID); retryErr == nil {
-			log.Printf("Retrying %s with different account: %s", requestPath, retryAccountID)
-			
-			// 重新创建请求
-			retryReq, _ := http.NewRequest(c.Request.Method, targetURL.String(), bytes.NewReader(bodyBytes))
-			for key, values := range c.Request.Header {
-				if strings.ToLower(key) == "x-api-key" {
-					retryReq.Header.Set("x-api-key", retryAccountID)
-				} else if strings.ToLower(key) != "host" {
-					for _, value := range values {
-						retryReq.Header.Add(key, value)
-					}
-				}
+models:
+	for {
+		// 选择可用的Claude账户ID，启用排队时等待账户结束冷却
+		accountID, queueWait, err := s.acquireAccount(c.Request.Context(), apiKey, client)
+		record.QueueWaitMs += queueWait.Milliseconds()
+		switch err {
+		case errQueueFull:
+			log.Printf("Admission queue full for %s (client %s)", requestPath, client)
+			if fallback() {
+				continue models
 			}
-			if retryReq.Header.Get("x-api-key") == "" {
-				retryReq.Header.Set("x-api-key", retryAccountID)
+			record.Error = "admission_queue_full"
+			c.Header("Retry-After", strconv.Itoa(s.retryAfter(apiKey)))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Too many queued requests",
+				"message": "All accounts are busy and the wait queue is full, please try again later",
+			})
+			return
+		case errQueueTimeout, errQueueCancelled:
+			log.Printf("Admission rejected for %s (client %s) after %v: %v", requestPath, client, queueWait, err)
+			// 客户端已断开时不再尝试降级模型
+			if err == errQueueTimeout && fallback() {
+				continue models
 			}
-			retryReq.Host = s.targetURL.Host
-			
-			// 重试请求
-			if retryResp, retryErr := s.httpClient.Do(retryReq); retryErr == nil {
-				// 检查重试响应是否成功
-				if s.isSuccessResponse(retryResp.StatusCode) {
-					s.handleResponse(c, retryResp, retryAccountID, requestPath)
-					return
-				} else {
-					// 重试也失败，标记第二个账户也有问题
-					log.Printf("Retry also failed with status %d for account %s on %s", retryResp.StatusCode, retryAccountID, requestPath)
-					s.markAccountAsProblematic(retryAccountID, fmt.Sprintf("http_error_%d", retryResp.StatusCode))
-					s.handleResponse(c, retryResp, retryAccountID, requestPath)
-					return
-				}
+			record.Error = "admission_timeout"
+			if err == errQueueCancelled {
+				record.Error = "client_disconnected"
 			}
+			c.Header("Retry-After", strconv.Itoa(s.retryAfter(apiKey)))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "All accounts are busy",
+				"message": "No Claude account became available in time, please try again later",
+			})
+			return
+		}
+		if errors.Is(err, errKeyInfoUnavailable) || errors.Is(err, errAssignedPoolsInactive) {
+			log.Printf("Cannot determine accounts allowed for %s: %v", requestPath, err)
+			record.Error = "api_key_lookup_failed"
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "API key configuration unavailable",
+				"message": "The accounts assigned to this API key are unavailable, please try again later",
+			})
+			return
+		}
+		if err == errBoundAccountUnavailable {
+			log.Printf("Bound account unavailable for %s", requestPath)
+			record.Error = "bound_account_unavailable"
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Bound Claude account unavailable",
+				"message": "The account dedicated to this API key is cooling down, please try again later",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to select account for %s: %v", requestPath, err)
+			if fallback() {
+				continue models
+			}
+			record.Error = "no_available_accounts"
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "No available Claude accounts"})
+			return
 		}
 		
-		c.JSON(http.StatusBadGateway, gin.H{
-			"error": "Proxy request failed"})
-		return
-	}
-	
-	// 检查响应状态码是否表示成功
-	if !s.isSuccessResponse(resp.StatusCode) {
-		log.Printf("Account %s returned error status %d on %s", accountID, resp.StatusCode, requestPath)
+		log.Printf("Selected account %s for %s (client %s)", accountID, requestPath, client)
+		leases.add(accountID)
 		
-		// 对于某些错误状态码，标记账户为有问题
-		if s.shouldMarkAccountAsProblematic(resp.StatusCode) {
-			s.markAccountAsProblematic(accountID, fmt.Sprintf("http_error_%d", resp.StatusCode))
+		triedAccounts := make(map[string]bool)
+		
+		for attempt := 1; ; attempt++ {
+			triedAccounts[accountID] = true
+			exchange.SetAttempt(accountID, attempt)
+			record.AccountID = accountID
+			record.Attempts++
+			canRetry := attempt < retry.MaxAttempts
 			
-			// 尝试使用其他账户重试
-			if retryAccountID, retryErr := s.selectAvailableAccountExcluding(accountID); retryErr == nil {
-				log.Printf("Retrying %s with different account due to status %d: %s", requestPath, resp.StatusCode, retryAccountID)
+			// 发送请求，启用对冲时首次尝试超过对冲延迟后同时使用另一个账户
+			var resp *http.Response
+			hedgeCfg := s.cfg().Hedge
+			if attempt == 1 && shouldHedge(hedgeCfg, apiKey, client, body, stream) {
+				call, winner := s.sendHedged(c, target, accountID, apiKey, client, triedAccounts, leases, s.hedgeDelay(hedgeCfg, target.model))
+				if winner != "" {
+					record.Attempts++
+					record.Hedge = winner
+				}
+				accountID = call.accountID
+				record.AccountID = accountID
+				record.UpstreamLatencyMs = call.latency.Milliseconds()
+				resp, err = call.resp, call.err
+			} else {
+				s.chargeTokens(accountID, target.inputTokens)
+				sentAt := time.Now()
+				resp, err = s.sendProxyRequest(context.Background(), c, target.url.String(), target.body, accountID, client, target.tr)
+				record.UpstreamLatencyMs = time.Since(sentAt).Milliseconds()
+			}
+			if err != nil {
+				log.Printf("Proxy request failed for account %s on %s: %v", accountID, requestPath, err)
 				
-				// 重新创建请求
-				retryReq, _ := http.NewRequest(c.Request.Method, targetURL.String(), bytes.NewReader(bodyBytes))
-				for key, values := range c.Request.Header {
-					if strings.ToLower(key) == "x-api-key" {
-						retryReq.Header.Set("x-api-key", retryAccountID)
-					} else if strings.ToLower(key) != "host" {
-						for _, value := range values {
-							retryReq.Header.Add(key, value)
-						}
+				// 标记账户为有问题的账户
+				s.markAccountAsProblematic(accountID, "network_error")
+				
+				// 如果请求失败，可能是账户问题，尝试其他账户
+				if canRetry {
+					if retryAccountID, retryErr := s.selectAvailableAccountExcluding(apiKey, triedAccounts); retryErr == nil {
+						log.Printf("Retrying %s with different account: %s (attempt %d/%d)", requestPath, retryAccountID, attempt+1, retry.MaxAttempts)
+						leases.release(accountID)
+						leases.add(retryAccountID)
+						accountID = retryAccountID
+						continue
 					}
 				}
-				if retryReq.Header.Get("x-api-key") == "" {
-					retryReq.Header.Set("x-api-key", retryAccountID)
+				
+				record.Error = "upstream_unreachable"
+				c.JSON(http.StatusBadGateway, gin.H{
+					"error": "Proxy request failed"})
+				return
+			}
+			
+			// 检查响应状态码是否表示成功
+			if s.isSuccessResponse(resp.StatusCode) && hedgeCfg.Enabled && !stream {
+				s.headerLatencies.observe(target.model, time.Duration(record.UpstreamLatencyMs)*time.Millisecond, hedgeCfg.Window)
+			}
+			if !s.isSuccessResponse(resp.StatusCode) {
+				log.Printf("Account %s returned error status %d on %s", accountID, resp.StatusCode, requestPath)
+				
+				// 对于某些错误状态码，标记账户为有问题
+				if s.shouldMarkAccountAsProblematic(resp.StatusCode) {
+					s.markAccountAsProblematic(accountID, fmt.Sprintf("http_error_%d", resp.StatusCode))
 				}
-				retryReq.Host = s.targetURL.Host
 				
-				// 重试请求
-				retryResp, retryErr2 := s.httpClient.Do(retryReq)
-				if retryErr2 == nil {
-					s.handleResponse(c, retryResp, retryAccountID, requestPath)
-					return
-				} else {
-					// 重试请求也失败了
-					log.Printf("❌ Retry request also failed: %v", retryErr2)
+				// 尝试使用其他账户重试
+				if canRetry && s.shouldRetryStatus(resp.StatusCode) {
+					if retryAccountID, retryErr := s.selectAvailableAccountExcluding(apiKey, triedAccounts); retryErr == nil {
+						log.Printf("Retrying %s with different account due to status %d: %s (attempt %d/%d)", requestPath, resp.StatusCode, retryAccountID, attempt+1, retry.MaxAttempts)
+						resp.Body.Close()
+						leases.release(accountID)
+						leases.add(retryAccountID)
+						accountID = retryAccountID
+						continue
+					} else {
+						// 无法找到可用账户重试
+						log.Printf("⚠️  No available accounts for retry: %v", retryErr)
+					}
 				}
-			} else {
-				// 无法找到可用账户重试
-				log.Printf("⚠️  No available accounts for retry: %v", retryErr)
-				// 如果是429错误且无法重试，返回503服务不可用
-				if resp.StatusCode == 429 {
+				
+				// 限流且无法再换账户重试时，切换到降级模型
+				if resp.StatusCode == 429 && fallback() {
+					resp.Body.Close()
+					leases.release(accountID)
+					continue models
+				}
+				
+				// 如果是429错误且找不到可用账户重试，返回503服务不可用
+				if resp.StatusCode == 429 && canRetry && s.shouldRetryStatus(resp.StatusCode) {
+					resp.Body.Close()
+					record.Error = "all_accounts_rate_limited"
 					c.JSON(http.StatusServiceUnavailable, gin.H{
 						"error": "All accounts are rate limited",
 						"message": "Service temporarily unavailable, please try again later",
@@ -220,14 +437,66 @@ func (s *Service) ProxyHandler(c *gin.Context) {
 					return
 				}
 			}
+			
+			// 告知客户端实际响应的模型
+			if fallbackCfg := s.cfg().Fallback; fallbackCfg.Enabled && target.model != "" {
+				c.Header(fallbackCfg.ModelHeader, target.model)
+			}
+			
+			if cached != nil {
+				cached.record(c, s.cfg().Cache.MaxBodySize)
+			}
+			record.Usage = s.handleResponse(c, resp, accountID, requestPath, exchange, target.tr)
+			if cached != nil {
+				s.storeCache(c, cached, target.model)
+			}
+			return
 		}
 	}
+}
+
+// sendProxyRequest 使用指定账户向目标服务发送请求
+// tr不为nil时body和targetURL已经是转换后的请求，ctx用于取消对冲中落败的请求
+func (s *Service) sendProxyRequest(ctx context.Context, c *gin.Context, targetURL string, body *requestBody, accountID string, client clientIdentity, tr *translation) (*http.Response, error) {
+	proxyReq, err := newBodyRequest(c.Request.Method, targetURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create proxy request: %w", err)
+	}
+	proxyReq = proxyReq.WithContext(ctx)
 	
-	s.handleResponse(c, resp, accountID, requestPath)
+	// 复制原始请求头（除了host），先去掉hop-by-hop头和客户端凭证，再设置账户ID和客户端身份，
+	// 避免客户端通过Connection头删除中间层设置的头
+	for key, values := range c.Request.Header {
+		if strings.ToLower(key) != "host" {
+			for _, value := range values {
+				proxyReq.Header.Add(key, value)
+			}
+		}
+	}
+	removeHopByHopHeaders(proxyReq.Header)
+	removeCredentialHeaders(proxyReq.Header)
+	
+	if s.cfg().Headers.Forwarded {
+		setForwardedHeaders(proxyReq.Header, c.Request)
+	}
+	s.headerRules.Load().applyRequest(c.Request.URL.Path, proxyReq.Header)
+	// 账户、身份和签名头最后设置，头处理规则不能修改
+	proxyCfg := s.cfg().Proxy
+	setUpstreamHeaders(proxyReq.Header, proxyCfg, proxyReq.Method, proxyReq.URL.Path, accountID, client)
+	if tr != nil {
+		tr.prepareRequest(proxyReq.Header)
+	}
+	
+	// 设置正确的Host
+	proxyReq.Host = s.targetURL.Host
+	
+	return s.httpClient.Do(proxyReq)
 }
 
 // handleResponse 处理响应
-func (s *Service) handleResponse(c *gin.Context, resp *http.Response, accountID string, requestPath string) {
+// tr不为nil时将响应转换回客户端请求的格式
+// 返回从响应体中解析出的Token用量
+func (s *Service) handleResponse(c *gin.Context, resp *http.Response, accountID string, requestPath string, exchange *capture.Exchange, tr *translation) accesslog.Usage {
 	defer resp.Body.Close()
 	
 	// 检查是否是限流响应
@@ -242,7 +511,32 @@ func (s *Service) handleResponse(c *gin.Context, resp *http.Response, accountID
 		log.Printf("Response %d for %s with account %s", resp.StatusCode, requestPath, accountID)
 	}
 	
-	// 复制响应头
+	// Token用量按上游格式解析
+	usage := newUsageTracker(resp.Header.Get("Content-Type"))
+	streaming := usage.sse
+	
+	// 非流式的转换响应需要先读取完整响应体
+	status := resp.StatusCode
+	var converted []byte
+	if tr != nil {
+		resp.Header.Del("Content-Length")
+		if streaming {
+			resp.Header.Set("Content-Type", tr.streamContentType)
+		} else {
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				log.Printf("Failed to read response body for %s: %v", requestPath, err)
+				c.Error(err)
+			}
+			usage.Write(data)
+			status, converted = tr.convertResponse(resp.StatusCode, data)
+			resp.Header.Set("Content-Type", "application/json")
+		}
+	}
+	
+	// 复制响应头，去掉hop-by-hop头并执行响应头规则
+	removeHopByHopHeaders(resp.Header)
+	s.headerRules.Load().applyResponse(requestPath, resp.Header)
 	for key, values := range resp.Header {
 		for _, value := range values {
 			c.Header(key, value)
@@ -250,12 +544,49 @@ func (s *Service) handleResponse(c *gin.Context, resp *http.Response, accountID
 	}
 	
 	// 设置状态码
-	c.Status(resp.StatusCode)
+	c.Status(status)
 	
-	// 复制响应体
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-		log.Printf("Failed to copy response body for %s: %v", requestPath, err)
+	// 复制响应体（同时解析Token用量，抓取时同时记录），SSE每次写入后立即刷新
+	var client io.Writer = c.Writer
+	if streaming {
+		client = flushWriter{c.Writer}
+	}
+	client = exchange.ResponseWriter(client, status, resp.Header)
+	
+	switch {
+	case converted != nil:
+		if _, err := client.Write(converted); err != nil {
+			log.Printf("Failed to write response body for %s: %v", requestPath, err)
+			c.Error(err)
+		}
+	case tr != nil:
+		stream := tr.convertStream(client)
+		if _, err := io.Copy(io.MultiWriter(stream, usage), resp.Body); err != nil {
+			log.Printf("Failed to copy response body for %s: %v", requestPath, err)
+			c.Error(err)
+		}
+		if err := stream.Close(); err != nil {
+			log.Printf("Failed to finish translated stream for %s: %v", requestPath, err)
+			c.Error(err)
+		}
+	default:
+		if _, err := io.Copy(io.MultiWriter(client, usage), resp.Body); err != nil {
+			log.Printf("Failed to copy response body for %s: %v", requestPath, err)
+			c.Error(err)
+		}
 	}
+	return usage.Usage()
+}
+
+// flushWriter 每次写入后立即刷新，保证SSE事件及时送达客户端
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
 }
 
 // isSuccessResponse 判断响应状态码是否表示成功
@@ -279,26 +610,37 @@ func (s *Service) shouldMarkAccountAsProblematic(statusCode int) bool {
 	}
 }
 
+// shouldRetryStatus 判断此状态码是否应该换账户重试
+func (s *Service) shouldRetryStatus(statusCode int) bool {
+	for _, status := range s.cfg().Retry.Statuses {
+		if status == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
 // markAccountAsProblematic 标记账户为有问题的账户（仅内存）
 func (s *Service) markAccountAsProblematic(accountID string, reason string) {
 	now := time.Now()
+	cooldown := s.cfg().Cooldown
 	
 	// 根据错误类型决定禁用时长
 	var disableDuration time.Duration
 	switch {
 	case strings.Contains(reason, "401") || strings.Contains(reason, "403"):
 		// 认证/权限错误，禁用较长时间
-		disableDuration = 30 * time.Minute
+		disableDuration = cooldown.AuthError.Duration
 	case strings.Contains(reason, "429"):
-		// 限流，禁用1小时
-		disableDuration = time.Hour
+		// 限流
+		disableDuration = cooldown.RateLimit.Duration
 		s.markAccountRateLimited(accountID) // 同时标记为限流
 	case strings.Contains(reason, "5"):
 		// 服务器错误，禁用较短时间
-		disableDuration = 10 * time.Minute
+		disableDuration = cooldown.ServerError.Duration
 	default:
 		// 网络错误等，禁用短时间
-		disableDuration = 5 * time.Minute
+		disableDuration = cooldown.NetworkError.Duration
 	}
 	
 	s.rateLimitMutex.Lock()
@@ -328,63 +670,130 @@ func (s *Service) isAccountProblematic(accountID string) bool {
 	
 	return true
 }
-func (s *Service) selectAvailableAccount() (string, error) {
-	return s.selectAvailableAccountExcluding("")
+// selectAvailableAccount 为客户端API Key选择可用的账户
+func (s *Service) selectAvailableAccount(apiKey string) (string, error) {
+	return s.selectAvailableAccountExcluding(apiKey, nil)
 }
 
 // selectAvailableAccountExcluding 选择可用的账户，排除指定账户
-func (s *Service) selectAvailableAccountExcluding(excludeAccountID string) (string, error) {
+func (s *Service) selectAvailableAccountExcluding(apiKey string, excludedAccounts map[string]bool) (string, error) {
+	return s.selectAccount(apiKey, excludedAccounts, true)
+}
+
+// selectReadyAccount 只选择完全可用的账户，所有账户都在冷却时返回errNoReadyAccount
+func (s *Service) selectReadyAccount(apiKey string) (string, error) {
+	return s.selectAccount(apiKey, nil, false)
+}
+
+// selectAccount 选择账户并占用一个并发名额，调用方用完后需要通过releaseAccount释放
+// allowCoolingDown为true时没有可用账户也会使用限流或有问题的账户
+func (s *Service) selectAccount(apiKey string, excludedAccounts map[string]bool, allowCoolingDown bool) (string, error) {
+	for {
+		accountID, err := s.pickAccount(apiKey, excludedAccounts, allowCoolingDown)
+		if err != nil || s.inFlight.tryAcquire(accountID, s.accountConcurrencyLimit(accountID)) {
+			return accountID, err
+		}
+		
+		// 选中后并发名额已被其他请求占满，排除该账户重新选择
+		log.Printf("🔒 Account %s reached max concurrency while selecting, retrying selection", accountID)
+		excluded := map[string]bool{accountID: true}
+		for id := range excludedAccounts {
+			excluded[id] = true
+		}
+		excludedAccounts = excluded
+	}
+}
+
+// pickAccount 按专属账户、共享池和账户状态挑选账户
+func (s *Service) pickAccount(apiKey string, excludedAccounts map[string]bool, allowCoolingDown bool) (string, error) {
 	s.accountsMutex.RLock()
 	accounts := make([]redis.ClaudeAccount, len(s.activeAccounts))
 	copy(accounts, s.activeAccounts)
 	s.accountsMutex.RUnlock()
 	
+	if s.isAccountDataTooStale() {
+		return "", errAccountDataStale
+	}
+	
 	if len(accounts) == 0 {
 		return "", fmt.Errorf("no active accounts available")
 	}
 	
-	log.Printf("🔍 Searching for alternative account (excluding %s), total accounts: %d", excludeAccountID, len(accounts))
+	// 绑定了专属账户的API Key优先使用专属账户
+	boundIDs, err := s.boundAccountIDs(apiKey)
+	if err != nil {
+		// 无法确定是否绑定时按专属账户不可用处理
+		if s.cfg().Binding.FallbackPolicy == bindingFallbackReject {
+			log.Printf("⚠️  Cannot resolve bound accounts, rejecting request: %v", err)
+			return "", err
+		}
+		log.Printf("⚠️  Cannot resolve bound accounts, falling back to shared accounts: %v", err)
+	}
+	if len(boundIDs) > 0 {
+		accountID, err := s.selectBoundAccount(accounts, boundIDs, excludedAccounts)
+		if err != nil || accountID != "" {
+			return accountID, err
+		}
+	}
 	
-	// 过滤掉被排除的账户、限流账户和有问题的账户
-	var availableAccounts []redis.ClaudeAccount
-	var rateLimitedAccounts []redis.ClaudeAccount
-	var problematicAccounts []redis.ClaudeAccount
+	// 专属账户不参与共享调度
+	accounts = sharedAccounts(accounts)
+	if len(accounts) == 0 {
+		return "", fmt.Errorf("no shared accounts available")
+	}
 	
-	for _, account := range accounts {
-		if account.ID == excludeAccountID {
-			log.Printf("   ⏭️  Skipping excluded account: %s", account.ID)
-			continue
-		}
+	// 按共享池限制账户范围，并按池优先级依次尝试
+	pools, err := s.resolvePools(apiKey)
+	if err != nil {
+		return "", err
+	}
+	if pools != nil {
+		var poolAccounts []redis.ClaudeAccount
+		seen := make(map[string]bool)
 		
-		isRateLimited := s.isAccountRateLimited(account.ID)
-		isProblematic := s.isAccountProblematic(account.ID)
+		for _, pool := range pools {
+			members := accountsInPool(accounts, pool)
+			available, _, _, _ := s.classifyAccounts(members, excludedAccounts)
+			if len(available) > 0 {
+				selected := s.pickByStrategy(pool, available)
+				log.Printf("✅ Selected account %s (%s) from pool %s (%s, strategy: %s)",
+					selected.ID, selected.Name, pool.Name, pool.ID, pool.AccountSelectionStrategy)
+				return selected.ID, nil
+			}
+			
+			for _, account := range members {
+				if !seen[account.ID] {
+					seen[account.ID] = true
+					poolAccounts = append(poolAccounts, account)
+				}
+			}
+		}
 		
-		if isProblematic {
-			problematicAccounts = append(problematicAccounts, account)
-			log.Printf("   ❌ Account %s is problematic", account.ID)
-		} else if isRateLimited {
-			rateLimitedAccounts = append(rateLimitedAccounts, account)
-			log.Printf("   ⏱️  Account %s is rate limited", account.ID)
-		} else {
-			availableAccounts = append(availableAccounts, account)
-			log.Printf("   ✅ Account %s is available", account.ID)
+		if len(poolAccounts) == 0 {
+			return "", fmt.Errorf("no accounts available in shared pools")
 		}
+		
+		log.Printf("⚠️  No fully available account in %d shared pools, falling back", len(pools))
+		accounts = poolAccounts
 	}
 	
-	log.Printf("📊 Account status: %d available, %d rate-limited, %d problematic", 
-		len(availableAccounts), len(rateLimitedAccounts), len(problematicAccounts))
+	log.Printf("🔍 Searching for alternative account (excluding %d), total accounts: %d", len(excludedAccounts), len(accounts))
+	
+	availableAccounts, rateLimitedAccounts, problematicAccounts, busyAccounts := s.classifyAccounts(accounts, excludedAccounts)
 	
-	// 优先使用完全可用的账户
+	log.Printf("📊 Account status: %d available, %d rate-limited, %d problematic, %d at max concurrency", 
+		len(availableAccounts), len(rateLimitedAccounts), len(problematicAccounts), len(busyAccounts))
+	
+	// 优先使用完全可用的账户（默认按最后使用时间选择最久未使用的）
 	if len(availableAccounts) > 0 {
-		// 按最后使用时间排序，选择最久未使用的
-		sort.Slice(availableAccounts, func(i, j int) bool {
-			timeI, _ := time.Parse(time.RFC3339, availableAccounts[i].LastUsedAt)
-			timeJ, _ := time.Parse(time.RFC3339, availableAccounts[j].LastUsedAt)
-			return timeI.Before(timeJ)
-		})
+		selected := s.pickByStrategy(redis.SharedPool{AccountSelectionStrategy: s.cfg().Selection.Strategy}, availableAccounts)
 		
-		log.Printf("✅ Selected available account: %s (%s)", availableAccounts[0].ID, availableAccounts[0].Name)
-		return availableAccounts[0].ID, nil
+		log.Printf("✅ Selected available account: %s (%s)", selected.ID, selected.Name)
+		return selected.ID, nil
+	}
+	
+	if !allowCoolingDown && len(rateLimitedAccounts)+len(problematicAccounts)+len(busyAccounts) > 0 {
+		return "", errNoReadyAccount
 	}
 	
 	// 其次使用限流账户（比有问题的账户好）
@@ -407,9 +816,61 @@ func (s *Service) selectAvailableAccountExcluding(excludeAccountID string) (stri
 		return problematicAccounts[0].ID, nil
 	}
 	
+	if len(busyAccounts) > 0 {
+		return "", fmt.Errorf("all %d accounts are at max concurrency", len(busyAccounts))
+	}
 	return "", fmt.Errorf("no accounts available")
 }
 
+// classifyAccounts 将账户分为可用、限流、有问题和并发已满四类，并过滤掉被排除的账户
+// Token已过期的账户直接排除，即将过期的账户仅在没有其他可用账户时使用
+// 并发已满的账户不会被选中
+func (s *Service) classifyAccounts(accounts []redis.ClaudeAccount, excludedAccounts map[string]bool) (available, rateLimited, problematic, busy []redis.ClaudeAccount) {
+	var expiring []redis.ClaudeAccount
+	now := time.Now()
+	
+	for _, account := range accounts {
+		if excludedAccounts[account.ID] {
+			log.Printf("   ⏭️  Skipping excluded account: %s", account.ID)
+			continue
+		}
+		
+		expiryState := s.tokenExpiryState(account, now)
+		if expiryState == expiryExpired {
+			log.Printf("   ⌛ Account %s token has expired, skipping", account.ID)
+			continue
+		}
+		
+		if limit := s.accountConcurrencyLimit(account.ID); limit > 0 && s.inFlight.count(account.ID) >= limit {
+			busy = append(busy, account)
+			log.Printf("   🔒 Account %s is at max concurrency (%d)", account.ID, limit)
+			continue
+		}
+		
+		isRateLimited := s.isAccountRateLimited(account.ID)
+		isProblematic := s.isAccountProblematic(account.ID)
+		
+		if isProblematic {
+			problematic = append(problematic, account)
+			log.Printf("   ❌ Account %s is problematic", account.ID)
+		} else if isRateLimited {
+			rateLimited = append(rateLimited, account)
+			log.Printf("   ⏱️  Account %s is rate limited", account.ID)
+		} else if expiryState == expiryExpiring {
+			expiring = append(expiring, account)
+			log.Printf("   ⏳ Account %s token is about to expire", account.ID)
+		} else {
+			available = append(available, account)
+			log.Printf("   ✅ Account %s is available", account.ID)
+		}
+	}
+	
+	if len(available) == 0 {
+		available = expiring
+	}
+	return available, rateLimited, problematic, busy
+}
+
 // isAccountRateLimited 检查账户是否被限流（仅内存）
 func (s *Service) isAccountRateLimited(accountID string) bool {
 	s.rateLimitMutex.RLock()
@@ -420,8 +881,8 @@ func (s *Service) isAccountRateLimited(accountID string) bool {
 		return false
 	}
 	
-	// 限流1小时
-	if time.Since(rateLimitedAt) > time.Hour {
+	// 限流冷却时长可配置（默认1小时）
+	if time.Since(rateLimitedAt) > s.cfg().Cooldown.RateLimit.Duration {
 		// 自动移除过期的限流状态
 		s.rateLimitMutex.Lock()
 		delete(s.rateLimitedCache, accountID)
@@ -445,13 +906,15 @@ func (s *Service) markAccountRateLimited(accountID string) {
 }
 
 // refreshAccounts 刷新账户列表
-func (s *Service) refreshAccounts() {
+// 失败时保留当前数据并进入降级状态
+func (s *Service) refreshAccounts() error {
 	log.Printf("🔄 Starting account refresh...")
 	
 	accounts, err := s.redisClient.GetAllActiveAccounts()
 	if err != nil {
 		log.Printf("❌ Failed to refresh accounts: %v", err)
-		return
+		s.markRefreshFailed(err)
+		return err
 	}
 	
 	// 打印账户详情以便调试
@@ -467,23 +930,113 @@ func (s *Service) refreshAccounts() {
 		}
 	}
 	
+	// 刷新共享池（失败时保留上一次的结果）
+	s.accountsMutex.RLock()
+	pools := s.sharedPools
+	s.accountsMutex.RUnlock()
+	if s.cfg().SharedPool.Enabled {
+		if loaded, err := s.redisClient.GetAllSharedPools(); err != nil {
+			log.Printf("❌ Failed to refresh shared pools: %v", err)
+		} else {
+			pools = loaded
+			log.Printf("🏊 Found %d shared pools in Redis", len(pools))
+		}
+	}
+	
+	s.updateTokenExpiryMetrics(accounts)
+	
+	now := time.Now()
 	s.accountsMutex.Lock()
 	s.activeAccounts = accounts
-	s.lastRefresh = time.Now()
+	s.sharedPools = pools
+	s.lastRefresh = now
 	s.accountsMutex.Unlock()
+	s.updateConcurrencyMetrics()
+	
+	s.markRefreshSucceeded(now)
+	s.admission.notify()
+	
+	// 持久化最近一次成功的数据，供Redis不可用时启动
+	if path := s.cfg().Accounts.SnapshotFile; path != "" {
+		snapshot := accountSnapshot{SavedAt: now, Accounts: accounts, SharedPools: pools}
+		if err := saveSnapshot(path, snapshot); err != nil {
+			log.Printf("⚠️  Failed to save account snapshot: %v", err)
+		}
+	}
 	
 	if len(accounts) > 0 {
 		log.Printf("✅ Successfully refreshed %d active accounts", len(accounts))
 	}
+	return nil
 }
 
-// accountRefreshWorker 定期刷新账户列表
+// loadAccountSnapshot 从本地快照加载账户数据
+func (s *Service) loadAccountSnapshot() {
+	path := s.cfg().Accounts.SnapshotFile
+	if path == "" {
+		log.Printf("⚠️  No account snapshot configured, starting without accounts")
+		return
+	}
+	
+	snapshot, err := loadSnapshot(path)
+	if err != nil {
+		log.Printf("⚠️  Failed to load account snapshot, starting without accounts: %v", err)
+		return
+	}
+	
+	s.updateTokenExpiryMetrics(snapshot.Accounts)
+	
+	s.accountsMutex.Lock()
+	s.activeAccounts = snapshot.Accounts
+	s.sharedPools = snapshot.SharedPools
+	s.lastRefresh = snapshot.SavedAt
+	s.dataSource = dataSourceSnapshot
+	s.accountsMutex.Unlock()
+	s.updateConcurrencyMetrics()
+	
+	lastRefreshGauge.Set(float64(snapshot.SavedAt.Unix()))
+	log.Printf("📦 Loaded %d accounts from snapshot %s (saved at %s)",
+		len(snapshot.Accounts), path, snapshot.SavedAt.Format(time.RFC3339))
+}
+
+// accountRefreshWorker 定期刷新账户列表，Redis不可用时按指数退避重连
 func (s *Service) accountRefreshWorker() {
-	ticker := time.NewTicker(30 * time.Second) // 每30秒刷新一次
-	defer ticker.Stop()
+	log.Printf("🔄 Started account refresh worker (refreshing every %v)", s.cfg().Accounts.RefreshInterval.Duration)
 	
-	log.Printf("🔄 Started account refresh worker (refreshing every 30 seconds)")
-	for range ticker.C {
+	var backoff time.Duration
+	for {
+		accounts := s.cfg().Accounts
+		delay := accounts.RefreshInterval.Duration
+		
+		if !s.isRedisUp() {
+			if backoff == 0 {
+				backoff = accounts.ReconnectMinBackoff.Duration
+			} else {
+				backoff *= 2
+			}
+			if backoff > accounts.ReconnectMaxBackoff.Duration {
+				backoff = accounts.ReconnectMaxBackoff.Duration
+			}
+			delay = backoff
+			log.Printf("🔌 Redis unavailable, retrying in %v", delay)
+		} else {
+			backoff = 0
+		}
+		
+		time.Sleep(delay)
 		s.refreshAccounts()
 	}
-}
\ No newline at end of file
+}
+
+// clientAPIKey 获取客户端使用的API Key（优先使用认证中间件验证过的Key）
+func clientAPIKey(c *gin.Context) string {
+	if apiKey := c.GetString("api_key"); apiKey != "" {
+		return apiKey
+	}
+	return auth.ExtractAPIKey(c)
+}
+
+// Captures 调试抓取记录，供管理API使用
+func (s *Service) Captures() *capture.Recorder {
+	return s.capture
+}
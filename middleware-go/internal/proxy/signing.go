@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-middleware/internal/auth"
+	"claude-middleware/internal/config"
+)
+
+// removeCredentialHeaders 删除客户端凭证，避免客户端API Key泄露到上游
+func removeCredentialHeaders(header http.Header) {
+	for _, name := range auth.CredentialHeaders {
+		header.Del(name)
+	}
+}
+
+// setUpstreamHeaders 设置携带账户ID和客户端身份的请求头，配置了签名密钥时附加HMAC签名
+//
+// 签名头格式为 "t=<unix时间戳>,v1=<hex>"，其中v1是以签名密钥对
+// "<时间戳>\n<方法>\n<路径>\n<账户ID>\n<身份头的值>" 计算的HMAC-SHA256，
+// 未启用身份头时最后一项为空字符串
+func setUpstreamHeaders(header http.Header, cfg config.ProxyConfig, method, path, accountID string, client clientIdentity) {
+	header.Set(cfg.AccountHeader, accountID)
+
+	var identity string
+	if cfg.IdentityHeader != "" {
+		identity = client.headerValue()
+		header.Set(cfg.IdentityHeader, identity)
+	}
+
+	if cfg.SigningSecret == "" {
+		// 不签名时也不能透传客户端伪造的签名头
+		header.Del(cfg.SignatureHeader)
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := signFields(cfg.SigningSecret, timestamp, method, path, accountID, identity)
+	header.Set(cfg.SignatureHeader, fmt.Sprintf("t=%s,v1=%s", timestamp, signature))
+}
+
+// signFields 以换行连接各字段后计算HMAC-SHA256
+func signFields(secret string, fields ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"claude-middleware/internal/redis"
+)
+
+// accountSnapshot 最近一次从Redis成功加载的账户数据，用于Redis不可用时启动和降级服务
+type accountSnapshot struct {
+	SavedAt     time.Time             `json:"savedAt"`
+	Accounts    []redis.ClaudeAccount `json:"accounts"`
+	SharedPools []redis.SharedPool    `json:"sharedPools"`
+}
+
+// saveSnapshot 原子地写入账户快照（先写临时文件再重命名）
+func saveSnapshot(path string, snapshot accountSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// loadSnapshot 读取账户快照
+func loadSnapshot(path string) (accountSnapshot, error) {
+	var snapshot accountSnapshot
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
+	"claude-middleware/internal/translate"
+)
+
+// openAIChatPath 在中间件内转换的OpenAI Chat Completions路径
+const openAIChatPath = "/openai/claude/v1/chat/completions"
+
+// anthropicMessagesPaths 客户端使用Anthropic Messages格式的路径
+var anthropicMessagesPaths = map[string]bool{
+	"/v1/messages":        true,
+	"/api/v1/messages":    true,
+	"/claude/v1/messages": true,
+}
+
+// geminiGeneratePath 客户端使用Gemini格式的路径，分组为模型和方法
+var geminiGeneratePath = regexp.MustCompile(`^/gemini/v1(?:beta|alpha)?/models/([^/:]+):(generateContent|streamGenerateContent)$`)
+
+// isStreamRequest 请求是否为流式响应：请求体中的stream字段，或Gemini格式路径中的
+// streamGenerateContent方法及alt=sse参数（Gemini格式请求体中没有stream字段）
+func isStreamRequest(r *http.Request, stream bool) bool {
+	return stream || strings.HasSuffix(r.URL.Path, ":streamGenerateContent") || r.URL.Query().Get("alt") == "sse"
+}
+
+var translatedRequests = metrics.NewCounter("translated_requests_total",
+	"Number of requests translated between API formats in the middleware", "from", "to")
+
+// translation 在中间件内完成的请求/响应格式转换
+type translation struct {
+	from     string       // 客户端使用的格式
+	to       string       // 上游使用的格式
+	path     string       // 转换后的上游请求路径
+	rawQuery string       // 转换后的上游查询参数
+	body     *requestBody // 转换后的请求体
+
+	// streamContentType 流式响应返回给客户端的Content-Type
+	streamContentType string
+	// convertResponse 转换非流式响应体（包括错误响应），返回客户端状态码和响应体
+	convertResponse func(status int, body []byte) (int, []byte)
+	// convertStream 返回一个Writer，写入上游SSE流，向w输出客户端格式的流式响应
+	convertStream func(w io.Writer) io.WriteCloser
+}
+
+// translationError 请求无法转换，按客户端格式返回错误
+type translationError struct {
+	errorBody func(status int, message string) []byte
+	err       error
+}
+
+func (e *translationError) Error() string { return e.err.Error() }
+func (e *translationError) Unwrap() error { return e.err }
+
+// translationFailure 返回转换失败时给客户端的状态码和错误响应体
+func translationFailure(err error) (int, []byte) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, translate.ErrInvalidRequest) {
+		status = http.StatusBadRequest
+	}
+	var trErr *translationError
+	if errors.As(err, &trErr) {
+		return status, trErr.errorBody(status, err.Error())
+	}
+	return status, translate.AnthropicErrorBody(status, err.Error())
+}
+
+// translateRequest 判断请求是否需要在中间件内转换格式，需要时返回转换后的请求
+// 不需要转换时返回nil，请求体无法转换时返回*translationError
+func translateRequest(cfg config.TranslateConfig, r *http.Request, body *requestBody) (*translation, error) {
+	if r.Method != http.MethodPost {
+		return nil, nil
+	}
+	path := r.URL.Path
+
+	var tr *translation
+	var err error
+	switch {
+	case cfg.OpenAI && path == openAIChatPath:
+		tr, err = openAIToAnthropic(cfg, body)
+		if err != nil {
+			err = &translationError{errorBody: translate.OpenAIError, err: err}
+		}
+
+	case cfg.Gemini && anthropicMessagesPaths[path] && isGeminiModel(cfg, body.Metadata().Model):
+		tr, err = anthropicToGemini(cfg, body)
+		if err != nil {
+			err = &translationError{errorBody: translate.AnthropicErrorBody, err: err}
+		}
+
+	case cfg.Gemini && geminiGeneratePath.MatchString(path):
+		match := geminiGeneratePath.FindStringSubmatch(path)
+		model, method := match[1], match[2]
+		if isGeminiModel(cfg, model) {
+			return nil, nil
+		}
+		sse := r.URL.Query().Get("alt") == "sse"
+		tr, err = geminiToAnthropic(cfg, body, model, method == "streamGenerateContent", sse)
+		if err != nil {
+			err = &translationError{errorBody: translate.GeminiErrorBody, err: err}
+		}
+
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	translatedRequests.Inc(tr.from, tr.to)
+	return tr, nil
+}
+
+// isGeminiModel 判断模型是否由Gemini格式的上游提供
+func isGeminiModel(cfg config.TranslateConfig, model string) bool {
+	if model == "" {
+		return false
+	}
+	for _, prefix := range cfg.GeminiModels {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// openAIToAnthropic OpenAI Chat Completions → Anthropic Messages
+func openAIToAnthropic(cfg config.TranslateConfig, body *requestBody) (*translation, error) {
+	data, err := readAll(body)
+	if err != nil {
+		return nil, err
+	}
+	anthropicReq, openAIReq, err := translate.OpenAIToAnthropic(data, cfg.DefaultMaxTokens)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := jsonBody(anthropicReq)
+	if err != nil {
+		return nil, err
+	}
+
+	includeUsage := openAIReq.StreamOptions != nil && openAIReq.StreamOptions.IncludeUsage
+	return &translation{
+		from:              "openai",
+		to:                "anthropic",
+		path:              cfg.MessagesPath,
+		body:              converted,
+		streamContentType: "text/event-stream",
+		convertResponse: func(status int, body []byte) (int, []byte) {
+			if status < 200 || status >= 300 {
+				return status, translate.AnthropicToOpenAIError(status, body)
+			}
+			converted, err := translate.AnthropicToOpenAIResponse(body)
+			if err != nil {
+				return http.StatusBadGateway, translate.OpenAIError(http.StatusBadGateway, err.Error())
+			}
+			return status, converted
+		},
+		convertStream: func(w io.Writer) io.WriteCloser {
+			return translate.NewOpenAIStream(w, includeUsage)
+		},
+	}, nil
+}
+
+// anthropicToGemini Anthropic Messages → Gemini generateContent
+func anthropicToGemini(cfg config.TranslateConfig, body *requestBody) (*translation, error) {
+	data, err := readAll(body)
+	if err != nil {
+		return nil, err
+	}
+	geminiReq, anthropicReq, err := translate.AnthropicToGemini(data)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := jsonBody(geminiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	method, rawQuery := "generateContent", ""
+	if anthropicReq.Stream {
+		method, rawQuery = "streamGenerateContent", "alt=sse"
+	}
+	model := anthropicReq.Model
+	return &translation{
+		from:              "anthropic",
+		to:                "gemini",
+		path:              geminiUpstreamPath(cfg.GeminiPath, model, method),
+		rawQuery:          rawQuery,
+		body:              converted,
+		streamContentType: "text/event-stream",
+		convertResponse: func(status int, body []byte) (int, []byte) {
+			if status < 200 || status >= 300 {
+				return status, translate.GeminiToAnthropicError(status, body)
+			}
+			converted, err := translate.GeminiToAnthropicResponse(body, model)
+			if err != nil {
+				return http.StatusBadGateway, translate.AnthropicErrorBody(http.StatusBadGateway, err.Error())
+			}
+			return status, converted
+		},
+		convertStream: func(w io.Writer) io.WriteCloser {
+			return translate.NewAnthropicStream(w, model)
+		},
+	}, nil
+}
+
+// geminiToAnthropic Gemini generateContent → Anthropic Messages
+// sse对应客户端请求中的alt=sse，否则流式响应按JSON数组输出
+func geminiToAnthropic(cfg config.TranslateConfig, body *requestBody, model string, stream, sse bool) (*translation, error) {
+	data, err := readAll(body)
+	if err != nil {
+		return nil, err
+	}
+	anthropicReq, err := translate.GeminiToAnthropic(data, model, stream, cfg.DefaultMaxTokens)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := jsonBody(anthropicReq)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "application/json"
+	if sse {
+		contentType = "text/event-stream"
+	}
+	return &translation{
+		from:              "gemini",
+		to:                "anthropic",
+		path:              cfg.MessagesPath,
+		body:              converted,
+		streamContentType: contentType,
+		convertResponse: func(status int, body []byte) (int, []byte) {
+			if status < 200 || status >= 300 {
+				return status, translate.AnthropicToGeminiError(status, body)
+			}
+			converted, err := translate.AnthropicToGeminiResponse(body)
+			if err != nil {
+				return http.StatusBadGateway, translate.GeminiErrorBody(http.StatusBadGateway, err.Error())
+			}
+			return status, converted
+		},
+		convertStream: func(w io.Writer) io.WriteCloser {
+			return translate.NewGeminiStream(w, sse)
+		},
+	}, nil
+}
+
+// geminiUpstreamPath 按模板生成Gemini上游路径，{model}和{method}分别替换为模型和方法
+func geminiUpstreamPath(template, model, method string) string {
+	return strings.NewReplacer("{model}", url.PathEscape(model), "{method}", method).Replace(template)
+}
+
+// prepareRequest 调整转换后上游请求的请求头
+func (t *translation) prepareRequest(header http.Header) {
+	// 去掉Accept-Encoding，由Transport协商压缩并自动解压，转换时需要读取明文
+	header.Del("Accept-Encoding")
+	header.Set("Content-Type", "application/json")
+	if t.to == "anthropic" && header.Get("anthropic-version") == "" {
+		header.Set("anthropic-version", translate.AnthropicVersion)
+	}
+	if t.to != "anthropic" {
+		header.Del("anthropic-version")
+		header.Del("anthropic-beta")
+	}
+}
+
+// readAll 读取完整的请求体
+func readAll(body *requestBody) ([]byte, error) {
+	reader, err := body.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claude-middleware/internal/config"
+)
+
+func translateConfig() config.TranslateConfig {
+	return config.TranslateConfig{
+		OpenAI:           true,
+		MessagesPath:     "/v1/messages",
+		DefaultMaxTokens: 4096,
+		Gemini:           true,
+		GeminiModels:     []string{"gemini-"},
+		GeminiPath:       "/gemini/v1beta/models/{model}:{method}",
+	}
+}
+
+// translateTestRequest 按客户端请求创建转换结果，不需要转换时返回nil
+func translateTestRequest(t *testing.T, cfg config.TranslateConfig, target, payload string) (*translation, error) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(payload))
+	body, err := readRequestBody(strings.NewReader(payload), 1<<20, "")
+	if err != nil {
+		t.Fatalf("readRequestBody: %v", err)
+	}
+	t.Cleanup(func() { body.Close() })
+	return translateRequest(cfg, r, body)
+}
+
+func translatedBody(t *testing.T, tr *translation) map[string]interface{} {
+	t.Helper()
+	data, err := readAll(tr.body)
+	if err != nil {
+		t.Fatalf("readAll: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("translated body is not JSON: %s", data)
+	}
+	return out
+}
+
+func TestTranslateRequestRoutes(t *testing.T) {
+	anthropic := `{"model":"%s","max_tokens":100,"stream":%s,"messages":[{"role":"user","content":"hi"}]}`
+	gemini := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`
+
+	tests := []struct {
+		name          string
+		target        string
+		payload       string
+		wantFrom      string
+		wantPath      string
+		wantQuery     string
+		wantStream    bool
+		wantStreamCT  string
+		wantModelPath bool
+	}{
+		{"anthropic to gemini", "/v1/messages", fmt.Sprintf(anthropic, "gemini-2.5-pro", "false"),
+			"anthropic", "/gemini/v1beta/models/gemini-2.5-pro:generateContent", "", false, "text/event-stream", false},
+		{"anthropic to gemini stream", "/api/v1/messages", fmt.Sprintf(anthropic, "gemini-2.5-flash", "true"),
+			"anthropic", "/gemini/v1beta/models/gemini-2.5-flash:streamGenerateContent", "alt=sse", false, "text/event-stream", false},
+		{"anthropic model escaped", "/claude/v1/messages", fmt.Sprintf(anthropic, "gemini-exp/1?x", "false"),
+			"anthropic", "/gemini/v1beta/models/gemini-exp%2F1%3Fx:generateContent", "", false, "text/event-stream", false},
+		{"gemini to anthropic", "/gemini/v1beta/models/claude-sonnet-4:generateContent", gemini,
+			"gemini", "/v1/messages", "", false, "application/json", true},
+		{"gemini to anthropic stream", "/gemini/v1beta/models/claude-sonnet-4:streamGenerateContent", gemini,
+			"gemini", "/v1/messages", "", true, "application/json", true},
+		{"gemini to anthropic sse", "/gemini/v1/models/claude-sonnet-4:streamGenerateContent?alt=sse", gemini,
+			"gemini", "/v1/messages", "", true, "text/event-stream", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := translateTestRequest(t, translateConfig(), tt.target, tt.payload)
+			if err != nil || tr == nil {
+				t.Fatalf("translateRequest() = %v, %v", tr, err)
+			}
+			if tr.from != tt.wantFrom || tr.path != tt.wantPath || tr.rawQuery != tt.wantQuery || tr.streamContentType != tt.wantStreamCT {
+				t.Errorf("translation = %s %s?%s (%s), want %s %s?%s (%s)",
+					tr.from, tr.path, tr.rawQuery, tr.streamContentType, tt.wantFrom, tt.wantPath, tt.wantQuery, tt.wantStreamCT)
+			}
+			body := translatedBody(t, tr)
+			if tt.wantModelPath {
+				stream, _ := body["stream"].(bool)
+				if body["model"] != "claude-sonnet-4" || stream != tt.wantStream || body["max_tokens"] != float64(4096) {
+					t.Errorf("translated body = %v, want model from path, stream %v", body, tt.wantStream)
+				}
+			} else if _, ok := body["contents"]; !ok {
+				t.Errorf("translated body = %v, want Gemini contents", body)
+			}
+		})
+	}
+}
+
+func TestTranslateRequestPassThrough(t *testing.T) {
+	disabled := translateConfig()
+	disabled.Gemini = false
+
+	tests := []struct {
+		name    string
+		cfg     config.TranslateConfig
+		target  string
+		payload string
+	}{
+		{"claude model on messages path", translateConfig(), "/v1/messages", `{"model":"claude-sonnet-4","messages":[]}`},
+		{"gemini model on gemini path", translateConfig(), "/gemini/v1beta/models/gemini-2.5-pro:generateContent", `{"contents":[]}`},
+		{"gemini translation disabled", disabled, "/v1/messages", `{"model":"gemini-2.5-pro","messages":[]}`},
+		{"other gemini method", translateConfig(), "/gemini/v1beta/models/claude-sonnet-4:countTokens", `{"contents":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := translateTestRequest(t, tt.cfg, tt.target, tt.payload)
+			if tr != nil || err != nil {
+				t.Errorf("translateRequest() = %+v, %v, want pass-through", tr, err)
+			}
+		})
+	}
+}
+
+func TestTranslateRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		payload   string
+		wantError string
+	}{
+		{"anthropic to gemini", "/v1/messages", `{"model":"gemini-2.5-pro","messages":[]}`,
+			`{"type":"error","error":{"type":"invalid_request_error","message":"invalid request: messages must not be empty"}}`},
+		{"gemini to anthropic", "/gemini/v1beta/models/claude-sonnet-4:generateContent", `{"contents":[]}`,
+			`{"error":{"code":400,"message":"invalid request: contents must not be empty","status":"INVALID_ARGUMENT"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := translateTestRequest(t, translateConfig(), tt.target, tt.payload)
+			if err == nil {
+				t.Fatal("translateRequest() error = nil")
+			}
+			status, body := translationFailure(err)
+			if status != http.StatusBadRequest || string(body) != tt.wantError {
+				t.Errorf("translationFailure() = %d %s, want 400 %s", status, body, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestTranslationConvertResponse(t *testing.T) {
+	anthropicToGemini, err := translateTestRequest(t, translateConfig(), "/v1/messages",
+		`{"model":"gemini-2.5-pro","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`)
+	if err != nil {
+		t.Fatalf("translateRequest: %v", err)
+	}
+	geminiToAnthropic, err := translateTestRequest(t, translateConfig(), "/gemini/v1beta/models/claude-sonnet-4:generateContent",
+		`{"contents":[{"parts":[{"text":"hi"}]}]}`)
+	if err != nil {
+		t.Fatalf("translateRequest: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		tr         *translation
+		status     int
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{"gemini success", anthropicToGemini, 200,
+			`{"candidates":[{"content":{"parts":[{"text":"hello"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1},"responseId":"r1"}`,
+			200, `{"id":"msg_r1","type":"message","role":"assistant","model":"gemini-2.5-pro","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":3,"output_tokens":1}}`},
+		{"gemini error", anthropicToGemini, 429, `{"error":{"code":429,"message":"quota","status":"RESOURCE_EXHAUSTED"}}`,
+			429, `{"type":"error","error":{"type":"rate_limit_error","message":"quota"}}`},
+		{"gemini malformed", anthropicToGemini, 200, `not json`,
+			502, `{"type":"error","error":{"type":"api_error","message":"malformed upstream response: invalid character 'o' in literal null (expecting 'u')"}}`},
+		{"anthropic success", geminiToAnthropic, 200,
+			`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"hello"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`,
+			200, `{"candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1,"totalTokenCount":4},"modelVersion":"claude-sonnet-4","responseId":"msg_1"}`},
+		{"anthropic error", geminiToAnthropic, 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			529, `{"error":{"code":529,"message":"Overloaded","status":"UNAVAILABLE"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := tt.tr.convertResponse(tt.status, []byte(tt.body))
+			if status != tt.wantStatus || string(body) != tt.want {
+				t.Errorf("convertResponse() = %d %s, want %d %s", status, body, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslationConvertStream(t *testing.T) {
+	tr, err := translateTestRequest(t, translateConfig(), "/v1/messages",
+		`{"model":"gemini-2.5-pro","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if err != nil {
+		t.Fatalf("translateRequest: %v", err)
+	}
+	var out bytes.Buffer
+	stream := tr.convertStream(&out)
+	io.WriteString(stream, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"hello\"}]},\"finishReason\":\"STOP\"}]}\r\n\r\n")
+	stream.Close()
+	for _, want := range []string{"event: message_start", `"model":"gemini-2.5-pro"`, `"text":"hello"`, "event: message_stop"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("converted stream missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestTranslationPrepareRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		to   string
+		in   map[string]string
+		want map[string]string
+	}{
+		{"to gemini", "gemini",
+			map[string]string{"Accept-Encoding": "gzip", "Anthropic-Version": "2023-06-01", "Anthropic-Beta": "tools", "Content-Type": "text/plain"},
+			map[string]string{"Accept-Encoding": "", "Anthropic-Version": "", "Anthropic-Beta": "", "Content-Type": "application/json"}},
+		{"to anthropic", "anthropic",
+			map[string]string{"Accept-Encoding": "br"},
+			map[string]string{"Accept-Encoding": "", "Anthropic-Version": "2023-06-01", "Content-Type": "application/json"}},
+		{"to anthropic keeps version", "anthropic",
+			map[string]string{"Anthropic-Version": "2024-01-01", "Anthropic-Beta": "tools"},
+			map[string]string{"Anthropic-Version": "2024-01-01", "Anthropic-Beta": "tools"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for name, value := range tt.in {
+				header.Set(name, value)
+			}
+			(&translation{to: tt.to}).prepareRequest(header)
+			for name, want := range tt.want {
+				if got := header.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"claude-middleware/internal/config"
+)
+
+// newHTTPClient 根据配置创建连接上游的HTTP客户端
+func newHTTPClient(cfg config.ProxyConfig) (*http.Client, error) {
+	tlsConfig, err := upstreamTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout.Duration,
+		KeepAlive: cfg.KeepAlive.Duration,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout.Duration,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout.Duration,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout.Duration,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+	}
+
+	// 出口代理，支持 http://、https:// 和 socks5://
+	if cfg.EgressProxy != "" {
+		proxyURL, err := url.Parse(cfg.EgressProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid egress proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if !cfg.HTTP2 {
+		// 非nil的空map会禁用HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(cfg.Timeout) * time.Second,
+	}, nil
+}
+
+// upstreamTLSConfig 构建连接上游的TLS配置
+func upstreamTLSConfig(cfg config.UpstreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upstream CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in upstream CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load upstream client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+
+	"claude-middleware/internal/accesslog"
+)
+
+// maxUsageBodySize 非流式响应中用于解析Token用量的最大响应体
+const maxUsageBodySize = 4 << 20
+
+// usageFields 响应中的usage字段，兼容Anthropic、OpenAI与Gemini格式
+type usageFields struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	PromptTokens             int `json:"prompt_tokens"`
+	CompletionTokens         int `json:"completion_tokens"`
+	PromptTokenCount         int `json:"promptTokenCount"`
+	CandidatesTokenCount     int `json:"candidatesTokenCount"`
+	CachedContentTokenCount  int `json:"cachedContentTokenCount"`
+}
+
+// usagePayload 携带usage的响应体或SSE事件（Anthropic的message_start把usage放在message中）
+type usagePayload struct {
+	Usage         *usageFields `json:"usage"`
+	UsageMetadata *usageFields `json:"usageMetadata"` // Gemini
+	Message       *struct {
+		Usage *usageFields `json:"usage"`
+	} `json:"message"`
+}
+
+// usageTracker 在响应体写给客户端的同时解析Token用量
+type usageTracker struct {
+	sse      bool
+	buf      bytes.Buffer // 非流式响应的响应体，或SSE中尚未完整的行
+	overflow bool
+	usage    accesslog.Usage
+}
+
+func newUsageTracker(contentType string) *usageTracker {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return &usageTracker{sse: mediaType == "text/event-stream"}
+}
+
+func (t *usageTracker) Write(p []byte) (int, error) {
+	if !t.sse {
+		if t.buf.Len()+len(p) > maxUsageBodySize {
+			t.overflow = true
+		} else if !t.overflow {
+			t.buf.Write(p)
+		}
+		return len(p), nil
+	}
+
+	t.buf.Write(p)
+	for {
+		line, err := t.buf.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次写入
+			remaining := append([]byte(nil), line...)
+			t.buf.Reset()
+			t.buf.Write(remaining)
+			break
+		}
+		if data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); ok {
+			t.parse(bytes.TrimSpace(data))
+		}
+	}
+	return len(p), nil
+}
+
+// Usage 返回解析到的Token用量
+func (t *usageTracker) Usage() accesslog.Usage {
+	if !t.sse && !t.overflow {
+		t.parse(t.buf.Bytes())
+		t.buf.Reset()
+	}
+	return t.usage
+}
+
+// parse 合并一个JSON对象中的usage，流式响应中后出现的非零值覆盖之前的值
+func (t *usageTracker) parse(data []byte) {
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	var payload usagePayload
+	if json.Unmarshal(data, &payload) != nil {
+		return
+	}
+	if payload.Message != nil {
+		t.merge(payload.Message.Usage)
+	}
+	t.merge(payload.Usage)
+	t.merge(payload.UsageMetadata)
+}
+
+func (t *usageTracker) merge(u *usageFields) {
+	if u == nil {
+		return
+	}
+	for _, field := range []struct {
+		dst *int
+		src int
+	}{
+		{&t.usage.InputTokens, u.InputTokens},
+		{&t.usage.InputTokens, u.PromptTokens},
+		{&t.usage.InputTokens, u.PromptTokenCount - u.CachedContentTokenCount},
+		{&t.usage.OutputTokens, u.OutputTokens},
+		{&t.usage.OutputTokens, u.CompletionTokens},
+		{&t.usage.OutputTokens, u.CandidatesTokenCount},
+		{&t.usage.CacheCreationInputTokens, u.CacheCreationInputTokens},
+		{&t.usage.CacheReadInputTokens, u.CacheReadInputTokens},
+		{&t.usage.CacheReadInputTokens, u.CachedContentTokenCount},
+	} {
+		if field.src > 0 {
+			*field.dst = field.src
+		}
+	}
+}
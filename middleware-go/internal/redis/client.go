@@ -2,16 +2,23 @@ package redis
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"claude-middleware/internal/config"
 )
 
 type Client struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ctx    context.Context
 }
 
@@ -24,28 +31,41 @@ type ClaudeAccount struct {
 	ExpiresAt    int64  `json:"expiresAt"`
 	RateLimited  bool   `json:"rateLimited"`
 	RateLimitedAt string `json:"rateLimitedAt"`
+	AccountType  string `json:"accountType"` // shared 或 dedicated
 }
 
+// NewClient 创建Redis客户端，支持单机、Sentinel和Cluster模式以及TLS
+// 只校验连接配置，不要求Redis此时可用；go-redis会在后续命令中自动重连
 func NewClient(cfg config.RedisConfig) (*Client, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
-	
-	ctx := context.Background()
+	opts, err := buildUniversalOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
 	
-	// 测试连接
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("failed to ping Redis: %w", err)
+	var rdb redis.UniversalClient
+	switch connectionMode(cfg) {
+	case modeCluster:
+		rdb = redis.NewClusterClient(opts.Cluster())
+	case modeSentinel:
+		rdb = redis.NewFailoverClient(opts.Failover())
+	default:
+		rdb = redis.NewClient(opts.Simple())
 	}
 	
 	return &Client{
 		client: rdb,
-		ctx:    ctx,
+		ctx:    context.Background(),
 	}, nil
 }
 
+// Ping 测试Redis连接
+func (c *Client) Ping() error {
+	if err := c.client.Ping(c.ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping Redis: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) Close() error {
 	return c.client.Close()
 }
@@ -54,7 +74,7 @@ func (c *Client) Close() error {
 func (c *Client) GetAllActiveAccounts() ([]ClaudeAccount, error) {
 	// 修复：使用正确的key前缀 claude:account:*
 	pattern := "claude:account:*"
-	keys, err := c.client.Keys(c.ctx, pattern).Result()
+	keys, err := c.keys(pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account keys: %w", err)
 	}
@@ -97,6 +117,28 @@ func (c *Client) GetAllActiveAccounts() ([]ClaudeAccount, error) {
 	return accounts, nil
 }
 
+// keys 获取匹配模式的所有key；集群模式下需要遍历所有主节点
+func (c *Client) keys(pattern string) ([]string, error) {
+	cluster, ok := c.client.(*redis.ClusterClient)
+	if !ok {
+		return c.client.Keys(c.ctx, pattern).Result()
+	}
+	
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(c.ctx, func(ctx context.Context, node *redis.Client) error {
+		nodeKeys, err := node.Keys(ctx, pattern).Result()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
 // parseAccountData 解析Redis中的账户数据
 func (c *Client) parseAccountData(data map[string]string) (ClaudeAccount, error) {
 	account := ClaudeAccount{}
@@ -119,6 +161,12 @@ func (c *Client) parseAccountData(data map[string]string) (ClaudeAccount, error)
 		account.Status = status
 	}
 	
+	// 兼容旧数据，未设置时视为共享账户
+	account.AccountType = "shared"
+	if accountType, ok := data["accountType"]; ok && accountType != "" {
+		account.AccountType = accountType
+	}
+	
 	if lastUsedAt, ok := data["lastUsedAt"]; ok {
 		account.LastUsedAt = lastUsedAt
 	}
@@ -139,4 +187,185 @@ func (c *Client) parseAccountData(data map[string]string) (ClaudeAccount, error)
 	}
 	
 	return account, nil
-}
\ No newline at end of file
+}
+
+// SharedPool 共享池信息（与Node.js服务的 shared_pool:* 结构保持一致）
+type SharedPool struct {
+	ID                       string   `json:"id"`
+	Name                     string   `json:"name"`
+	IsActive                 bool     `json:"isActive"`
+	Priority                 int      `json:"priority"`
+	AccountSelectionStrategy string   `json:"accountSelectionStrategy"`
+	AccountIDs               []string `json:"accountIds"`
+}
+
+const (
+	sharedPoolKeyPrefix         = "shared_pool:"
+	sharedPoolAccountsKeyPrefix = "shared_pool_accounts:"
+	// Node.js服务中存在两种API Key与共享池的关联前缀，这里同时读取
+	apiKeyPoolsKeyPrefix       = "apikey_pools:"
+	legacyAPIKeyPoolsKeyPrefix = "api_key_pools:"
+	apiKeyHashMapKey           = "apikey:hash_map"
+	apiKeyKeyPrefix            = "apikey:"
+
+	// DefaultSharedPoolID 默认共享池ID
+	DefaultSharedPoolID = "default-shared-pool"
+)
+
+// GetAllSharedPools 获取所有共享池及其账户（只读操作）
+func (c *Client) GetAllSharedPools() ([]SharedPool, error) {
+	keys, err := c.keys(sharedPoolKeyPrefix + "*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared pool keys: %w", err)
+	}
+
+	var pools []SharedPool
+	for _, key := range keys {
+		poolData, err := c.client.HGetAll(c.ctx, key).Result()
+		if err != nil {
+			log.Printf("⚠️  Error reading shared pool %s: %v", key, err)
+			continue
+		}
+		if len(poolData) == 0 {
+			continue
+		}
+
+		pool := parseSharedPoolData(strings.TrimPrefix(key, sharedPoolKeyPrefix), poolData)
+
+		accountIDs, err := c.client.SMembers(c.ctx, sharedPoolAccountsKeyPrefix+pool.ID).Result()
+		if err != nil {
+			log.Printf("⚠️  Error reading accounts of shared pool %s: %v", pool.ID, err)
+			continue
+		}
+		pool.AccountIDs = accountIDs
+
+		pools = append(pools, pool)
+	}
+
+	// 按优先级排序（数字越大优先级越高）
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Priority > pools[j].Priority
+	})
+
+	return pools, nil
+}
+
+// FindAPIKeyID 根据API Key的哈希值查找其ID（哈希算法与Node.js服务一致）
+func (c *Client) FindAPIKeyID(apiKey, encryptionKey string) (string, error) {
+	sum := sha256.Sum256([]byte(apiKey + encryptionKey))
+	hashedKey := hex.EncodeToString(sum[:])
+
+	keyID, err := c.client.HGet(c.ctx, apiKeyHashMapKey, hashedKey).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up api key: %w", err)
+	}
+	return keyID, nil
+}
+
+// GetAPIKeyPoolIDs 获取API Key关联的共享池ID
+func (c *Client) GetAPIKeyPoolIDs(apiKeyID string) ([]string, error) {
+	seen := make(map[string]bool)
+	var poolIDs []string
+
+	for _, prefix := range []string{apiKeyPoolsKeyPrefix, legacyAPIKeyPoolsKeyPrefix} {
+		ids, err := c.client.SMembers(c.ctx, prefix+apiKeyID).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pools for api key %s: %w", apiKeyID, err)
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				poolIDs = append(poolIDs, id)
+			}
+		}
+	}
+
+	return poolIDs, nil
+}
+
+// GetAPIKeyBoundAccountID 获取API Key绑定的专属Claude账户ID，未绑定时返回空字符串
+func (c *Client) GetAPIKeyBoundAccountID(apiKeyID string) (string, error) {
+	accountID, err := c.client.HGet(c.ctx, apiKeyKeyPrefix+apiKeyID, "claudeAccountId").Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get bound account for api key %s: %w", apiKeyID, err)
+	}
+	return accountID, nil
+}
+
+// GetAPIKeyName 获取Node.js服务中API Key的名称
+func (c *Client) GetAPIKeyName(apiKeyID string) (string, error) {
+	name, err := c.client.HGet(c.ctx, apiKeyKeyPrefix+apiKeyID, "name").Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get name for api key %s: %w", apiKeyID, err)
+	}
+	return name, nil
+}
+
+// GetAPIKeyRestrictedModels 获取Node.js服务中API Key禁止使用的模型，未启用模型限制时返回nil
+func (c *Client) GetAPIKeyRestrictedModels(apiKeyID string) ([]string, error) {
+	values, err := c.client.HMGet(c.ctx, apiKeyKeyPrefix+apiKeyID, "enableModelRestriction", "restrictedModels").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model restriction for api key %s: %w", apiKeyID, err)
+	}
+
+	enabled, _ := values[0].(string)
+	restricted, _ := values[1].(string)
+	if enabled != "true" || restricted == "" {
+		return nil, nil
+	}
+
+	var models []string
+	if err := json.Unmarshal([]byte(restricted), &models); err != nil {
+		return nil, fmt.Errorf("invalid restrictedModels for api key %s: %w", apiKeyID, err)
+	}
+	return models, nil
+}
+
+// parseSharedPoolData 解析Redis中的共享池数据
+func parseSharedPoolData(id string, data map[string]string) SharedPool {
+	pool := SharedPool{
+		ID:                       id,
+		Name:                     data["name"],
+		IsActive:                 data["isActive"] == "true",
+		Priority:                 100,
+		AccountSelectionStrategy: data["accountSelectionStrategy"],
+	}
+
+	if priority, err := strconv.Atoi(data["priority"]); err == nil {
+		pool.Priority = priority
+	}
+	if pool.AccountSelectionStrategy == "" {
+		pool.AccountSelectionStrategy = "least_used"
+	}
+
+	return pool
+}
+
+// GetCachedResponse 读取中间层自己写入的响应缓存，不存在时返回nil
+func (c *Client) GetCachedResponse(key string) ([]byte, error) {
+	data, err := c.client.Get(c.ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached response %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// SetCachedResponse 写入响应缓存，只使用中间层自己的键前缀，不修改Node.js服务的数据
+func (c *Client) SetCachedResponse(key string, data []byte, ttl time.Duration) error {
+	if err := c.client.Set(c.ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set cached response %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+
+	"claude-middleware/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 连接模式
+const (
+	modeStandalone = "standalone"
+	modeSentinel   = "sentinel"
+	modeCluster    = "cluster"
+)
+
+// connectionMode 根据配置判断连接模式
+func connectionMode(cfg config.RedisConfig) string {
+	switch {
+	case len(cfg.ClusterAddrs) > 0:
+		return modeCluster
+	case cfg.SentinelMaster != "":
+		return modeSentinel
+	default:
+		return modeStandalone
+	}
+}
+
+// buildUniversalOptions 将配置转换为go-redis的连接选项
+func buildUniversalOptions(cfg config.RedisConfig) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            []string{cfg.Host + ":" + strconv.Itoa(cfg.Port)},
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		SentinelUsername: cfg.SentinelUsername,
+		SentinelPassword: cfg.SentinelPassword,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      cfg.DialTimeout.Duration,
+		ReadTimeout:      cfg.ReadTimeout.Duration,
+		WriteTimeout:     cfg.WriteTimeout.Duration,
+	}
+
+	// redis:// 或 rediss:// URL覆盖单独的地址和认证配置
+	if cfg.URL != "" {
+		parsed, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis url: %w", err)
+		}
+		opts.Addrs = []string{parsed.Addr}
+		opts.Username = parsed.Username
+		opts.Password = parsed.Password
+		opts.DB = parsed.DB
+		opts.TLSConfig = parsed.TLSConfig
+	}
+
+	switch connectionMode(cfg) {
+	case modeCluster:
+		opts.Addrs = cfg.ClusterAddrs
+	case modeSentinel:
+		opts.Addrs = cfg.SentinelAddrs
+		opts.MasterName = cfg.SentinelMaster
+	}
+
+	tlsConfig, err := buildTLSConfig(cfg.TLS, opts.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	opts.TLSConfig = tlsConfig
+
+	return opts, nil
+}
+
+// buildTLSConfig 构建TLS配置，base为rediss:// URL解析出的配置
+func buildTLSConfig(cfg config.RedisTLSConfig, base *tls.Config) (*tls.Config, error) {
+	if !cfg.Enabled && base == nil {
+		return nil, nil
+	}
+
+	tlsConfig := base
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if cfg.ServerName != "" {
+		tlsConfig.ServerName = cfg.ServerName
+	}
+	tlsConfig.InsecureSkipVerify = tlsConfig.InsecureSkipVerify || cfg.InsecureSkipVerify
+
+	if cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in redis CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strconv"
+
+	"claude-middleware/internal/config"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// New 根据配置创建HTTP服务器（HTTP或HTTPS，可选HTTP/2）
+func New(handler http.Handler, cfg config.ServerConfig) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:    ":" + strconv.Itoa(cfg.Port),
+		Handler: handler,
+	}
+
+	if !cfg.TLS.Enabled {
+		if cfg.H2C {
+			srv.Handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+		return srv, nil
+	}
+
+	reloader, err := newCertReloader(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if interval := cfg.TLS.ReloadInterval.Duration; interval > 0 {
+		go reloader.watch(interval)
+	}
+
+	srv.TLSConfig = reloader.tlsConfig(cfg.HTTP2)
+	if !cfg.HTTP2 {
+		// 非nil的空map会禁用net/http内置的HTTP/2
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return srv, nil
+}
+
+// ListenAndServe 启动服务器，HTTPS时证书由TLSConfig提供
+func ListenAndServe(srv *http.Server) error {
+	if srv.TLSConfig == nil {
+		return srv.ListenAndServe()
+	}
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,237 @@
+// Package tokens 在本地粗略估算请求的输入Token数（不调用任何接口）
+package tokens
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// charsPerToken 英文等拉丁文本平均每个Token的字符数
+	charsPerToken = 4
+	// ImageTokens 每张图片按固定Token数估算（约为1092x1092图片的用量）
+	ImageTokens = 1600
+	// DocumentTokens 每个文档（PDF等）或其他内联文件按固定Token数估算（约为两页PDF的用量）
+	DocumentTokens = 3000
+	// messageOverhead 每条消息的角色、分隔符等额外Token
+	messageOverhead = 4
+)
+
+// skippedKeys 不计入Token的字段（模型名、枚举值和参数）
+var skippedKeys = map[string]bool{
+	"model":       true,
+	"role":        true,
+	"type":        true,
+	"stream":      true,
+	"media_type":  true,
+	"mime_type":   true,
+	"mimeType":    true,
+	"max_tokens":  true,
+	"temperature": true,
+	"top_p":       true,
+	"top_k":       true,
+}
+
+// Estimate 估算请求体的输入Token数
+//
+// 支持Anthropic Messages、OpenAI Chat Completions和Gemini generateContent格式：
+// 累加所有文本字段（system、消息内容、工具定义和工具调用参数等）的估算值，
+// 图片按 ImageTokens、文档和其他内联文件按 DocumentTokens 计算，每条消息额外计 messageOverhead。
+// 非JSON请求体按字节数估算。
+func Estimate(body []byte) int {
+	estimated, _ := EstimateReader(bytes.NewReader(body))
+	return estimated
+}
+
+// EstimateReader 从Reader流式读取请求体并估算输入Token数，只返回读取错误
+// 逐个读取JSON Token累加，内存占用只取决于最长的单个字符串，不会把整个请求体解码到内存
+func EstimateReader(r io.Reader) (int, error) {
+	counter := &countingReader{r: r}
+	decoder := json.NewDecoder(counter)
+
+	estimated, err := estimateNext(decoder)
+	if err == nil {
+		// 顶层值之后还有其他内容时不是合法的JSON
+		if _, err = decoder.Token(); err == io.EOF {
+			return estimated, nil
+		}
+		if err == nil {
+			err = errTrailingData
+		}
+	}
+	if counter.err != nil && counter.err != io.EOF {
+		return 0, counter.err
+	}
+
+	// 非JSON请求体按字节数估算
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return 0, err
+	}
+	return int((counter.n + charsPerToken - 1) / charsPerToken), nil
+}
+
+// errTrailingData 顶层JSON值之后还有其他内容
+var errTrailingData = errors.New("invalid data after top-level value")
+
+// countingReader 记录已读取的字节数和读取错误，用于区分JSON格式错误和读取失败
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// blockInfo 已读取完的JSON对象的估算值，以及判断内容块类型需要的字段
+type blockInfo struct {
+	tokens   int
+	typ      string // type字段
+	mimeType string // mimeType、mime_type或media_type字段
+}
+
+// estimateNext 读取并估算下一个JSON值
+func estimateNext(decoder *json.Decoder) (int, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return 0, err
+	}
+	info, err := estimateToken(decoder, token)
+	return info.tokens, err
+}
+
+// estimateToken 估算以token开头的JSON值，对象和数组继续从decoder读取到结束
+func estimateToken(decoder *json.Decoder, token json.Token) (blockInfo, error) {
+	switch v := token.(type) {
+	case string:
+		return blockInfo{tokens: Text(v)}, nil
+	case json.Delim:
+		if v == '{' {
+			return estimateObject(decoder)
+		}
+		total := 0
+		for decoder.More() {
+			estimated, err := estimateNext(decoder)
+			if err != nil {
+				return blockInfo{}, err
+			}
+			total += estimated
+		}
+		_, err := decoder.Token()
+		return blockInfo{tokens: total}, err
+	default:
+		// 数字、布尔值、null等
+		return blockInfo{}, nil
+	}
+}
+
+// estimateObject 估算已读取起始分隔符的JSON对象
+// 图片、文档等二进制内容块在对象结束后按固定Token数计算，其中的base64数据不计入
+func estimateObject(decoder *json.Decoder) (blockInfo, error) {
+	var info blockInfo
+	var sourceType string
+	inlineData, hasRole := false, false
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return blockInfo{}, err
+		}
+		key, _ := token.(string)
+		if token, err = decoder.Token(); err != nil {
+			return blockInfo{}, err
+		}
+		value, err := estimateToken(decoder, token)
+		if err != nil {
+			return blockInfo{}, err
+		}
+
+		switch key {
+		case "role":
+			hasRole = true
+		case "type":
+			info.typ, _ = token.(string)
+		case "mimeType", "mime_type", "media_type":
+			info.mimeType, _ = token.(string)
+		case "source":
+			sourceType = value.typ
+		case "inlineData", "inline_data", "fileData", "file_data":
+			// Gemini内联数据和文件引用
+			inlineData = true
+			info.mimeType = value.mimeType
+		}
+		if !skippedKeys[key] {
+			info.tokens += value.tokens
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return blockInfo{}, err
+	}
+
+	switch {
+	case isImage(info.typ, inlineData, info.mimeType):
+		info.tokens = ImageTokens
+	case isDocument(info.typ, inlineData, sourceType):
+		info.tokens = DocumentTokens
+	case hasRole:
+		info.tokens += messageOverhead
+	}
+	return info, nil
+}
+
+// isImage 判断是否为图片内容块
+// Anthropic: {"type":"image"}；OpenAI: {"type":"image_url"}；Gemini: {"inlineData"|"inline_data"|"fileData":{...image/*}}
+func isImage(typ string, inlineData bool, mimeType string) bool {
+	switch typ {
+	case "image", "image_url", "input_image":
+		return true
+	}
+	return inlineData && strings.HasPrefix(mimeType, "image/")
+}
+
+// isDocument 判断是否为文档等非图片的二进制内容块
+// Anthropic: {"type":"document"}（纯文本来源除外）；OpenAI: {"type":"file"|"input_file"}；Gemini: 非图片的内联数据和文件引用
+func isDocument(typ string, inlineData bool, sourceType string) bool {
+	switch typ {
+	case "document":
+		return sourceType != "text" && sourceType != "content"
+	case "file", "input_file":
+		return true
+	}
+	return inlineData
+}
+
+// Text 估算一段文本的Token数
+// 中日韩文字按每个字符一个Token计算，其余字符按每 charsPerToken 个字符一个Token计算
+func Text(s string) int {
+	if s == "" {
+		return 0
+	}
+	wide, other := 0, 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if isWide(r) {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return wide + (other+charsPerToken-1)/charsPerToken
+}
+
+// isWide 中日韩文字（汉字、假名、谚文）
+func isWide(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
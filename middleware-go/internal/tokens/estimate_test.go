@@ -0,0 +1,116 @@
+package tokens
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"empty body", ``, 0},
+		{"empty object", `{}`, 0},
+		{"null", `null`, 0},
+		{"not JSON counts bytes", `hello world!`, 3},
+		{"parameters are not counted", `{"model":"claude-sonnet-4","max_tokens":1024,"temperature":0,"stream":true}`, 0},
+		{"system prompt string", `{"model":"claude-x","system":"abcdefgh","messages":[{"role":"user","content":"abcd"}]}`, 2 + messageOverhead + 1},
+		{"system prompt blocks", `{"system":[{"type":"text","text":"abcdefgh"},{"type":"text","text":"abcd"}],"messages":[]}`, 2 + 1},
+		{"conversation", `{"messages":[{"role":"user","content":"abcd"},{"role":"assistant","content":"abcdefgh"}]}`,
+			2*messageOverhead + 1 + 2},
+		{"tool definitions", `{"tools":[{"name":"get_weather","description":"abcdefgh","input_schema":{"type":"object",
+			"properties":{"city":{"type":"string","description":"abcd"}}}}],"messages":[]}`, 3 + 2 + 1},
+		{"tool use and result", `{"messages":[{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"get_weather",
+			"input":{"city":"Paris"}}]},{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"abcd"}]}]}`,
+			messageOverhead + 2 + 3 + 2 + messageOverhead + 2 + 1},
+		{"anthropic image", `{"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png",
+			"data":"` + strings.Repeat("A", 4000) + `"}},{"type":"text","text":"abcd"}]}]}`, messageOverhead + ImageTokens + 1},
+		{"openai image", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA"}},
+			{"type":"text","text":"abcd"}]}]}`, messageOverhead + ImageTokens + 1},
+		{"gemini image", `{"contents":[{"role":"user","parts":[{"inlineData":{"mimeType":"image/jpeg","data":"AAAA"}},{"text":"abcd"}]}]}`,
+			messageOverhead + ImageTokens + 1},
+		{"gemini non-image inline data", `{"contents":[{"parts":[{"inline_data":{"mime_type":"application/pdf","data":"abcdefgh"}}]}]}`, DocumentTokens},
+		{"gemini image file", `{"contents":[{"parts":[{"fileData":{"mimeType":"image/png","fileUri":"gs://bucket/a.png"}}]}]}`, ImageTokens},
+		{"gemini pdf file", `{"contents":[{"parts":[{"file_data":{"mime_type":"application/pdf","file_uri":"gs://bucket/a.pdf"}},{"text":"abcd"}]}]}`,
+			DocumentTokens + 1},
+		{"anthropic pdf document", `{"messages":[{"role":"user","content":[{"type":"document","source":{"type":"base64",
+			"media_type":"application/pdf","data":"` + strings.Repeat("A", 4000) + `"}},{"type":"text","text":"abcd"}]}]}`,
+			messageOverhead + DocumentTokens + 1},
+		{"anthropic url document", `{"messages":[{"role":"user","content":[{"type":"document","source":{"type":"url","url":"https://example.com/a.pdf"}}]}]}`,
+			messageOverhead + DocumentTokens},
+		{"anthropic text document", `{"messages":[{"role":"user","content":[{"type":"document","source":{"type":"text",
+			"media_type":"text/plain","data":"abcdefgh"}}]}]}`, messageOverhead + 2},
+		{"openai file", `{"messages":[{"role":"user","content":[{"type":"file","file":{"filename":"a.pdf","file_data":"data:application/pdf;base64,AAAA"}}]}]}`,
+			messageOverhead + DocumentTokens},
+		{"trailing data counts bytes", `{"system":"abcd"} extra`, 6},
+		{"truncated JSON counts bytes", `{"system":"abcdefgh"`, 5},
+		{"multiple images", `{"messages":[{"role":"user","content":[{"type":"image","source":{}},{"type":"image","source":{}}]}]}`,
+			messageOverhead + 2*ImageTokens},
+		{"openai format", `{"model":"gpt-x","messages":[{"role":"system","content":"abcdefgh"},{"role":"user","content":"abcd"}]}`,
+			2*messageOverhead + 2 + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Estimate([]byte(tt.body)); got != tt.want {
+				t.Errorf("Estimate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateReader(t *testing.T) {
+	got, err := EstimateReader(strings.NewReader(`{"system":"abcdefgh"}`))
+	if err != nil || got != 2 {
+		t.Errorf("EstimateReader() = %d, %v, want 2, nil", got, err)
+	}
+
+	// 按字节读取时结果不变
+	body := `{"messages":[{"role":"user","content":[{"type":"image","source":{}},{"type":"text","text":"你好 abcd"}]}]}`
+	got, err = EstimateReader(iotest.OneByteReader(strings.NewReader(body)))
+	if want := Estimate([]byte(body)); err != nil || got != want {
+		t.Errorf("EstimateReader(one byte) = %d, %v, want %d", got, err, want)
+	}
+}
+
+func TestEstimateReaderError(t *testing.T) {
+	readErr := errors.New("disk failure")
+	reader := io.MultiReader(strings.NewReader(`{"system":"abcd`), iotest.ErrReader(readErr))
+	if _, err := EstimateReader(reader); err != readErr {
+		t.Errorf("EstimateReader() error = %v, want %v", err, readErr)
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"你好世界", 4},
+		{"こんにちは", 5},
+		{"안녕", 2},
+		{"你好 ab", 2 + 1},
+		{"héllo", 2},
+	}
+	for _, tt := range tests {
+		if got := Text(tt.text); got != tt.want {
+			t.Errorf("Text(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateScalesWithLength(t *testing.T) {
+	short := Estimate([]byte(`{"messages":[{"role":"user","content":"` + strings.Repeat("word ", 10) + `"}]}`))
+	long := Estimate([]byte(`{"messages":[{"role":"user","content":"` + strings.Repeat("word ", 10000) + `"}]}`))
+	if long < 1000*short/10 || long != messageOverhead+50000/charsPerToken {
+		t.Errorf("Estimate(long) = %d, Estimate(short) = %d", long, short)
+	}
+}
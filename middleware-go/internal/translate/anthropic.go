@@ -0,0 +1,128 @@
+package translate
+
+import "encoding/json"
+
+// AnthropicVersion 请求Anthropic Messages接口时使用的API版本
+const AnthropicVersion = "2023-06-01"
+
+// AnthropicRequest Anthropic Messages请求
+type AnthropicRequest struct {
+	Model         string               `json:"model"`
+	System        json.RawMessage      `json:"system,omitempty"` // 字符串或文本块数组
+	Messages      []AnthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	TopK          *int                 `json:"top_k,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Tools         []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *AnthropicToolChoice `json:"tool_choice,omitempty"`
+	Metadata      *AnthropicMetadata   `json:"metadata,omitempty"`
+}
+
+// AnthropicMessage 一条消息，content可以是字符串或内容块数组
+type AnthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// AnthropicBlock 内容块（text、image、tool_use、tool_result、thinking等）
+type AnthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *AnthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage  `json:"content,omitempty"` // tool_result的内容，字符串或内容块数组
+	IsError   bool             `json:"is_error,omitempty"`
+}
+
+// AnthropicSource 图片来源
+type AnthropicSource struct {
+	Type      string `json:"type"` // base64 或 url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicTool 工具定义
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// AnthropicToolChoice 工具选择策略
+type AnthropicToolChoice struct {
+	Type                   string `json:"type"` // auto、any、tool、none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+// AnthropicMetadata 请求元数据
+type AnthropicMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// AnthropicResponse Anthropic Messages非流式响应
+type AnthropicResponse struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Model        string           `json:"model"`
+	Content      []AnthropicBlock `json:"content"`
+	StopReason   string           `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        AnthropicUsage   `json:"usage"`
+}
+
+// AnthropicUsage Token用量
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// AnthropicError 错误响应
+type AnthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStreamEvent 流式事件中用到的字段
+type anthropicStreamEvent struct {
+	Type         string             `json:"type"`
+	Index        int                `json:"index"`
+	Message      *AnthropicResponse `json:"message"`
+	ContentBlock *AnthropicBlock    `json:"content_block"`
+	Delta        *struct {
+		Type         string  `json:"type"`
+		Text         string  `json:"text"`
+		PartialJSON  string  `json:"partial_json"`
+		StopReason   string  `json:"stop_reason"`
+		StopSequence *string `json:"stop_sequence"`
+	} `json:"delta"`
+	Usage *AnthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// blocks 解析字符串或内容块数组形式的content
+func blocks(content json.RawMessage) []AnthropicBlock {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return []AnthropicBlock{{Type: "text", Text: text}}
+	}
+	var result []AnthropicBlock
+	json.Unmarshal(content, &result)
+	return result
+}
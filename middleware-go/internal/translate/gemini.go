@@ -0,0 +1,702 @@
+package translate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GeminiRequest Gemini generateContent请求
+type GeminiRequest struct {
+	Contents          []GeminiContent         `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// GeminiContent 一轮对话内容，role为user或model
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+// GeminiPart 内容片段，每个片段只设置一种数据
+type GeminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// GeminiBlob base64编码的内联数据
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// GeminiFileData 通过URI引用的文件
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiFunctionCall 模型发起的函数调用
+type GeminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse 函数调用结果
+type GeminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+// GeminiTool 工具定义
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+// GeminiFunctionDeclaration 函数声明
+type GeminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	Parameters           json.RawMessage `json:"parameters,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+// GeminiToolConfig 函数调用策略
+type GeminiToolConfig struct {
+	FunctionCallingConfig *struct {
+		Mode                 string   `json:"mode,omitempty"` // AUTO、ANY、NONE
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig,omitempty"`
+}
+
+// GeminiGenerationConfig 生成参数
+type GeminiGenerationConfig struct {
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	TopK            *int     `json:"topK,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	CandidateCount  int      `json:"candidateCount,omitempty"`
+}
+
+// GeminiResponse generateContent响应（流式响应的每个事件也是这个结构）
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate `json:"candidates"`
+	UsageMetadata *GeminiUsage      `json:"usageMetadata,omitempty"`
+	ModelVersion  string            `json:"modelVersion,omitempty"`
+	ResponseID    string            `json:"responseId,omitempty"`
+}
+
+// GeminiCandidate 候选结果
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+// GeminiUsage Token用量
+type GeminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount,omitempty"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount,omitempty"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+}
+
+// GeminiError 错误响应
+type GeminiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// AnthropicToGemini 将Anthropic Messages请求转换为Gemini generateContent请求
+// 返回的模型名和是否流式用于构造上游路径
+func AnthropicToGemini(body []byte) (*GeminiRequest, *AnthropicRequest, error) {
+	var req AnthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, invalidRequest("malformed JSON: %v", err)
+	}
+	if req.Model == "" {
+		return nil, nil, invalidRequest("model is required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, nil, invalidRequest("messages must not be empty")
+	}
+
+	out := &GeminiRequest{
+		GenerationConfig: &GeminiGenerationConfig{
+			MaxOutputTokens: req.MaxTokens,
+			Temperature:     req.Temperature,
+			TopP:            req.TopP,
+			TopK:            req.TopK,
+			StopSequences:   req.StopSequences,
+		},
+	}
+
+	if len(req.System) > 0 && string(req.System) != "null" {
+		var texts []string
+		for _, block := range blocks(req.System) {
+			if block.Type == "text" && block.Text != "" {
+				texts = append(texts, block.Text)
+			}
+		}
+		if len(texts) > 0 {
+			out.SystemInstruction = &GeminiContent{Parts: []GeminiPart{{Text: strings.Join(texts, "\n\n")}}}
+		}
+	}
+
+	// tool_result只带tool_use_id，Gemini的functionResponse需要函数名
+	toolNames := make(map[string]string)
+	for i, msg := range req.Messages {
+		role := "user"
+		switch msg.Role {
+		case "user":
+		case "assistant":
+			role = "model"
+		default:
+			return nil, nil, invalidRequest("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+
+		var parts []GeminiPart
+		for _, block := range blocks(msg.Content) {
+			switch block.Type {
+			case "text":
+				if block.Text != "" {
+					parts = append(parts, GeminiPart{Text: block.Text})
+				}
+			case "image":
+				part, err := geminiImagePart(block.Source)
+				if err != nil {
+					return nil, nil, invalidRequest("messages[%d]: %v", i, err)
+				}
+				parts = append(parts, part)
+			case "tool_use":
+				toolNames[block.ID] = block.Name
+				args := block.Input
+				if len(args) == 0 {
+					args = json.RawMessage(`{}`)
+				}
+				parts = append(parts, GeminiPart{FunctionCall: &GeminiFunctionCall{ID: block.ID, Name: block.Name, Args: args}})
+			case "tool_result":
+				name, ok := toolNames[block.ToolUseID]
+				if !ok {
+					return nil, nil, invalidRequest("messages[%d]: tool_result references unknown tool_use_id %q", i, block.ToolUseID)
+				}
+				key := "content"
+				if block.IsError {
+					key = "error"
+				}
+				response, err := json.Marshal(map[string]string{key: blockText(block.Content)})
+				if err != nil {
+					return nil, nil, err
+				}
+				parts = append(parts, GeminiPart{FunctionResponse: &GeminiFunctionResponse{
+					ID:       block.ToolUseID,
+					Name:     name,
+					Response: response,
+				}})
+			}
+			// thinking等其他内容块Gemini无法使用，直接忽略
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		if n := len(out.Contents); n > 0 && out.Contents[n-1].Role == role {
+			out.Contents[n-1].Parts = append(out.Contents[n-1].Parts, parts...)
+		} else {
+			out.Contents = append(out.Contents, GeminiContent{Role: role, Parts: parts})
+		}
+	}
+	if len(out.Contents) == 0 {
+		return nil, nil, invalidRequest("messages must contain at least one non-empty message")
+	}
+
+	if len(req.Tools) > 0 {
+		tool := GeminiTool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, GeminiFunctionDeclaration{
+				Name:                 t.Name,
+				Description:          t.Description,
+				ParametersJSONSchema: t.InputSchema,
+			})
+		}
+		out.Tools = []GeminiTool{tool}
+	}
+
+	if req.ToolChoice != nil {
+		config := &GeminiToolConfig{}
+		config.FunctionCallingConfig = &struct {
+			Mode                 string   `json:"mode,omitempty"`
+			AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+		}{}
+		switch req.ToolChoice.Type {
+		case "auto":
+			config.FunctionCallingConfig.Mode = "AUTO"
+		case "any":
+			config.FunctionCallingConfig.Mode = "ANY"
+		case "tool":
+			config.FunctionCallingConfig.Mode = "ANY"
+			config.FunctionCallingConfig.AllowedFunctionNames = []string{req.ToolChoice.Name}
+		case "none":
+			config.FunctionCallingConfig.Mode = "NONE"
+		default:
+			return nil, nil, invalidRequest("unsupported tool_choice type %q", req.ToolChoice.Type)
+		}
+		out.ToolConfig = config
+	}
+
+	return out, &req, nil
+}
+
+// geminiImagePart 将Anthropic图片来源转换为Gemini内容片段
+func geminiImagePart(source *AnthropicSource) (GeminiPart, error) {
+	if source == nil {
+		return GeminiPart{}, fmt.Errorf("image source is required")
+	}
+	switch source.Type {
+	case "base64":
+		return GeminiPart{InlineData: &GeminiBlob{MimeType: source.MediaType, Data: source.Data}}, nil
+	case "url":
+		return GeminiPart{FileData: &GeminiFileData{FileURI: source.URL}}, nil
+	}
+	return GeminiPart{}, fmt.Errorf("unsupported image source type %q", source.Type)
+}
+
+// blockText 提取tool_result内容中的文本
+func blockText(content json.RawMessage) string {
+	if len(content) == 0 || string(content) == "null" {
+		return ""
+	}
+	var texts []string
+	for _, block := range blocks(content) {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// GeminiToAnthropic 将Gemini generateContent请求转换为Anthropic Messages请求
+// model和stream来自请求路径，请求未指定maxOutputTokens时使用defaultMaxTokens
+func GeminiToAnthropic(body []byte, model string, stream bool, defaultMaxTokens int) (*AnthropicRequest, error) {
+	var req GeminiRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, invalidRequest("malformed JSON: %v", err)
+	}
+	if len(req.Contents) == 0 {
+		return nil, invalidRequest("contents must not be empty")
+	}
+
+	out := &AnthropicRequest{Model: model, MaxTokens: defaultMaxTokens, Stream: stream}
+	if gen := req.GenerationConfig; gen != nil {
+		if gen.CandidateCount > 1 {
+			return nil, invalidRequest("candidateCount > 1 is not supported")
+		}
+		if gen.MaxOutputTokens > 0 {
+			out.MaxTokens = gen.MaxOutputTokens
+		}
+		out.Temperature = gen.Temperature
+		out.TopP = gen.TopP
+		out.TopK = gen.TopK
+		out.StopSequences = gen.StopSequences
+	}
+
+	if req.SystemInstruction != nil {
+		var texts []string
+		for _, part := range req.SystemInstruction.Parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+		if len(texts) > 0 {
+			system, err := json.Marshal(strings.Join(texts, "\n\n"))
+			if err != nil {
+				return nil, err
+			}
+			out.System = system
+		}
+	}
+
+	// Gemini的函数调用可能没有ID，按顺序生成并用函数名匹配结果
+	var pending []AnthropicBlock
+	callCount := 0
+	for i, content := range req.Contents {
+		role := "user"
+		switch content.Role {
+		case "", "user", "function":
+		case "model":
+			role = "assistant"
+		default:
+			return nil, invalidRequest("contents[%d]: unsupported role %q", i, content.Role)
+		}
+
+		var result []AnthropicBlock
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					callCount++
+					id = fmt.Sprintf("toolu_gemini_%d", callCount)
+				}
+				input := part.FunctionCall.Args
+				if len(input) == 0 || string(input) == "null" {
+					input = json.RawMessage(`{}`)
+				}
+				block := AnthropicBlock{Type: "tool_use", ID: id, Name: part.FunctionCall.Name, Input: input}
+				pending = append(pending, block)
+				result = append(result, block)
+			case part.FunctionResponse != nil:
+				id := part.FunctionResponse.ID
+				for j, call := range pending {
+					if (id != "" && call.ID == id) || (id == "" && call.Name == part.FunctionResponse.Name) {
+						id = call.ID
+						pending = append(pending[:j], pending[j+1:]...)
+						break
+					}
+				}
+				if id == "" {
+					return nil, invalidRequest("contents[%d]: functionResponse %q has no matching functionCall", i, part.FunctionResponse.Name)
+				}
+				content, err := json.Marshal(string(part.FunctionResponse.Response))
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, AnthropicBlock{Type: "tool_result", ToolUseID: id, Content: content})
+			case part.InlineData != nil:
+				result = append(result, AnthropicBlock{Type: "image", Source: &AnthropicSource{
+					Type: "base64", MediaType: part.InlineData.MimeType, Data: part.InlineData.Data,
+				}})
+			case part.FileData != nil:
+				result = append(result, AnthropicBlock{Type: "image", Source: &AnthropicSource{Type: "url", URL: part.FileData.FileURI}})
+			case part.Text != "":
+				result = append(result, AnthropicBlock{Type: "text", Text: part.Text})
+			}
+		}
+		if len(result) > 0 {
+			messages, err := appendMessage(out.Messages, role, result)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = messages
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, invalidRequest("contents must contain at least one non-empty part")
+	}
+
+	for _, tool := range req.Tools {
+		for _, decl := range tool.FunctionDeclarations {
+			schema := decl.ParametersJSONSchema
+			if len(schema) == 0 {
+				schema = lowercaseSchemaTypes(decl.Parameters)
+			}
+			if len(schema) == 0 || string(schema) == "null" {
+				schema = json.RawMessage(`{"type":"object","properties":{}}`)
+			}
+			out.Tools = append(out.Tools, AnthropicTool{Name: decl.Name, Description: decl.Description, InputSchema: schema})
+		}
+	}
+
+	if req.ToolConfig != nil && req.ToolConfig.FunctionCallingConfig != nil {
+		config := req.ToolConfig.FunctionCallingConfig
+		switch strings.ToUpper(config.Mode) {
+		case "", "AUTO", "MODE_UNSPECIFIED":
+			out.ToolChoice = &AnthropicToolChoice{Type: "auto"}
+		case "ANY":
+			out.ToolChoice = &AnthropicToolChoice{Type: "any"}
+			if len(config.AllowedFunctionNames) == 1 {
+				out.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: config.AllowedFunctionNames[0]}
+			}
+		case "NONE":
+			out.ToolChoice = &AnthropicToolChoice{Type: "none"}
+		default:
+			return nil, invalidRequest("unsupported functionCallingConfig mode %q", config.Mode)
+		}
+	}
+
+	return out, nil
+}
+
+// lowercaseSchemaTypes Gemini的OpenAPI schema中type为大写（如OBJECT），转换为JSON Schema的小写形式
+func lowercaseSchemaTypes(schema json.RawMessage) json.RawMessage {
+	if len(schema) == 0 {
+		return schema
+	}
+	var value interface{}
+	if json.Unmarshal(schema, &value) != nil {
+		return schema
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			for key, child := range node {
+				if typ, ok := child.(string); ok && key == "type" {
+					node[key] = strings.ToLower(typ)
+					continue
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	walk(value)
+	converted, err := json.Marshal(value)
+	if err != nil {
+		return schema
+	}
+	return converted
+}
+
+// anthropicStopReason 将Gemini的finishReason映射为Anthropic的stop_reason
+func anthropicStopReason(finishReason string, hasToolUse bool) string {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "refusal"
+	}
+	if hasToolUse {
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+// geminiFinishReason 将Anthropic的stop_reason映射为Gemini的finishReason
+func geminiFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "MAX_TOKENS"
+	case "refusal":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// anthropicUsageFromGemini 将Gemini用量转换为Anthropic用量
+func anthropicUsageFromGemini(usage *GeminiUsage) AnthropicUsage {
+	if usage == nil {
+		return AnthropicUsage{}
+	}
+	return AnthropicUsage{
+		InputTokens:          usage.PromptTokenCount - usage.CachedContentTokenCount,
+		OutputTokens:         usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+		CacheReadInputTokens: usage.CachedContentTokenCount,
+	}
+}
+
+// geminiUsage 将Anthropic用量转换为Gemini用量
+func geminiUsage(usage AnthropicUsage) *GeminiUsage {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return &GeminiUsage{
+		PromptTokenCount:        prompt,
+		CandidatesTokenCount:    usage.OutputTokens,
+		CachedContentTokenCount: usage.CacheReadInputTokens,
+		TotalTokenCount:         prompt + usage.OutputTokens,
+	}
+}
+
+// GeminiToAnthropicResponse 将Gemini响应转换为Anthropic Messages响应，model为客户端请求的模型
+func GeminiToAnthropicResponse(body []byte, model string) ([]byte, error) {
+	var resp GeminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("malformed upstream response: %w", err)
+	}
+
+	out := AnthropicResponse{
+		ID:      geminiMessageID(resp.ResponseID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []AnthropicBlock{},
+		Usage:   anthropicUsageFromGemini(resp.UsageMetadata),
+	}
+
+	var finishReason string
+	hasToolUse := false
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		finishReason = candidate.FinishReason
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.Thought:
+			case part.FunctionCall != nil:
+				hasToolUse = true
+				out.Content = append(out.Content, geminiToolUse(part.FunctionCall))
+			case part.Text != "":
+				if n := len(out.Content); n > 0 && out.Content[n-1].Type == "text" {
+					out.Content[n-1].Text += part.Text
+				} else {
+					out.Content = append(out.Content, AnthropicBlock{Type: "text", Text: part.Text})
+				}
+			}
+		}
+	}
+	out.StopReason = anthropicStopReason(finishReason, hasToolUse)
+
+	return json.Marshal(out)
+}
+
+// geminiToolUse 将Gemini函数调用转换为tool_use内容块，没有ID时随机生成
+func geminiToolUse(call *GeminiFunctionCall) AnthropicBlock {
+	id := call.ID
+	if id == "" {
+		var b [12]byte
+		rand.Read(b[:])
+		id = "toolu_" + hex.EncodeToString(b[:])
+	}
+	input := call.Args
+	if len(input) == 0 || string(input) == "null" {
+		input = json.RawMessage(`{}`)
+	}
+	return AnthropicBlock{Type: "tool_use", ID: id, Name: call.Name, Input: input}
+}
+
+// geminiMessageID 使用Gemini的responseId生成消息ID
+func geminiMessageID(responseID string) string {
+	if responseID == "" {
+		responseID = "gemini"
+	}
+	return "msg_" + responseID
+}
+
+// AnthropicToGeminiResponse 将Anthropic Messages响应转换为Gemini响应
+func AnthropicToGeminiResponse(body []byte) ([]byte, error) {
+	var resp AnthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("malformed upstream response: %w", err)
+	}
+
+	parts := []GeminiPart{}
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			parts = append(parts, GeminiPart{Text: block.Text})
+		case "tool_use":
+			parts = append(parts, GeminiPart{FunctionCall: &GeminiFunctionCall{ID: block.ID, Name: block.Name, Args: block.Input}})
+		}
+	}
+
+	return json.Marshal(GeminiResponse{
+		Candidates: []GeminiCandidate{{
+			Content:      GeminiContent{Role: "model", Parts: parts},
+			FinishReason: geminiFinishReason(resp.StopReason),
+		}},
+		UsageMetadata: geminiUsage(resp.Usage),
+		ModelVersion:  resp.Model,
+		ResponseID:    resp.ID,
+	})
+}
+
+// geminiStatus 将HTTP状态码映射为Google API错误状态
+func geminiStatus(status int) string {
+	switch status {
+	case 400:
+		return "INVALID_ARGUMENT"
+	case 401:
+		return "UNAUTHENTICATED"
+	case 403:
+		return "PERMISSION_DENIED"
+	case 404:
+		return "NOT_FOUND"
+	case 429:
+		return "RESOURCE_EXHAUSTED"
+	case 503, 529:
+		return "UNAVAILABLE"
+	case 504:
+		return "DEADLINE_EXCEEDED"
+	}
+	if status >= 500 {
+		return "INTERNAL"
+	}
+	return "FAILED_PRECONDITION"
+}
+
+// GeminiErrorBody 生成Gemini格式的错误响应
+func GeminiErrorBody(status int, message string) []byte {
+	var out GeminiError
+	out.Error.Code = status
+	out.Error.Message = message
+	out.Error.Status = geminiStatus(status)
+	data, _ := json.Marshal(out) // 只包含字符串和整数，编码不会失败
+	return data
+}
+
+// AnthropicErrorBody 生成Anthropic格式的错误响应
+func AnthropicErrorBody(status int, message string) []byte {
+	var out AnthropicError
+	out.Type = "error"
+	out.Error.Type = anthropicErrorType(status)
+	out.Error.Message = message
+	data, _ := json.Marshal(out) // 只包含字符串，编码不会失败
+	return data
+}
+
+// anthropicErrorType 将HTTP状态码映射为Anthropic错误类型
+func anthropicErrorType(status int) string {
+	switch {
+	case status == 401:
+		return "authentication_error"
+	case status == 403:
+		return "permission_error"
+	case status == 404:
+		return "not_found_error"
+	case status == 413:
+		return "request_too_large"
+	case status == 429:
+		return "rate_limit_error"
+	case status == 529:
+		return "overloaded_error"
+	case status >= 500:
+		return "api_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// GeminiToAnthropicError 将Gemini错误响应转换为Anthropic格式
+func GeminiToAnthropicError(status int, body []byte) []byte {
+	var upstream GeminiError
+	if json.Unmarshal(body, &upstream) == nil && upstream.Error.Message != "" {
+		return AnthropicErrorBody(status, upstream.Error.Message)
+	}
+	return AnthropicErrorBody(status, errorMessage(status, body))
+}
+
+// AnthropicToGeminiError 将Anthropic错误响应转换为Gemini格式
+func AnthropicToGeminiError(status int, body []byte) []byte {
+	var upstream AnthropicError
+	if json.Unmarshal(body, &upstream) == nil && upstream.Error.Message != "" {
+		return GeminiErrorBody(status, upstream.Error.Message)
+	}
+	return GeminiErrorBody(status, errorMessage(status, body))
+}
+
+// errorMessage 无法解析的错误响应使用原始内容或状态描述
+func errorMessage(status int, body []byte) string {
+	if message := strings.TrimSpace(string(body)); message != "" {
+		return message
+	}
+	return http.StatusText(status)
+}
@@ -0,0 +1,350 @@
+package translate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// anthropicStream 将Gemini流式响应（alt=sse）转换为Anthropic SSE事件
+type anthropicStream struct {
+	w       io.Writer
+	decoder *sseDecoder
+	model   string
+
+	started      bool
+	blockIndex   int    // 下一个内容块的索引
+	openBlock    string // 当前未结束的内容块类型，空表示没有
+	hasToolUse   bool
+	finishReason string
+	usage        AnthropicUsage
+	done         bool
+}
+
+// NewAnthropicStream 返回一个Writer，写入Gemini SSE流，向w输出Anthropic SSE流
+// Gemini流没有结束事件，Close时补发message_delta和message_stop
+func NewAnthropicStream(w io.Writer, model string) io.WriteCloser {
+	s := &anthropicStream{w: w, model: model}
+	s.decoder = &sseDecoder{onEvent: s.event}
+	return s
+}
+
+func (s *anthropicStream) Write(p []byte) (int, error) {
+	return s.decoder.Write(p)
+}
+
+func (s *anthropicStream) Close() error {
+	if err := s.decoder.Close(); err != nil {
+		return err
+	}
+	return s.finish()
+}
+
+func (s *anthropicStream) event(_ string, data []byte) error {
+	if s.done {
+		return nil
+	}
+
+	var upstreamErr GeminiError
+	if json.Unmarshal(data, &upstreamErr) == nil && upstreamErr.Error.Message != "" {
+		s.done = true
+		return s.emit("error", map[string]interface{}{
+			"type":  "error",
+			"error": map[string]string{"type": anthropicErrorType(upstreamErr.Error.Code), "message": upstreamErr.Error.Message},
+		})
+	}
+
+	var chunk GeminiResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+	if chunk.UsageMetadata != nil {
+		s.usage = anthropicUsageFromGemini(chunk.UsageMetadata)
+	}
+	if err := s.start(chunk.ResponseID); err != nil {
+		return err
+	}
+	if len(chunk.Candidates) == 0 {
+		return nil
+	}
+
+	candidate := chunk.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.Thought:
+		case part.FunctionCall != nil:
+			// Gemini一次给出完整的函数调用参数
+			s.hasToolUse = true
+			block := geminiToolUse(part.FunctionCall)
+			input := block.Input
+			block.Input = json.RawMessage(`{}`)
+			if err := s.startBlock("tool_use", block); err != nil {
+				return err
+			}
+			if err := s.delta(map[string]string{"type": "input_json_delta", "partial_json": string(input)}); err != nil {
+				return err
+			}
+			if err := s.stopBlock(); err != nil {
+				return err
+			}
+		case part.Text != "":
+			if s.openBlock != "text" {
+				if err := s.startBlock("text", map[string]string{"type": "text", "text": ""}); err != nil {
+					return err
+				}
+			}
+			if err := s.delta(map[string]string{"type": "text_delta", "text": part.Text}); err != nil {
+				return err
+			}
+		}
+	}
+	if candidate.FinishReason != "" {
+		s.finishReason = candidate.FinishReason
+	}
+	return nil
+}
+
+// start 输出message_start，只执行一次
+func (s *anthropicStream) start(responseID string) error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	return s.emit("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            geminiMessageID(responseID),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         s.model,
+			"content":       []AnthropicBlock{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         AnthropicUsage{InputTokens: s.usage.InputTokens, CacheReadInputTokens: s.usage.CacheReadInputTokens},
+		},
+	})
+}
+
+func (s *anthropicStream) startBlock(blockType string, block interface{}) error {
+	if err := s.stopBlock(); err != nil {
+		return err
+	}
+	s.openBlock = blockType
+	return s.emit("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         s.blockIndex,
+		"content_block": block,
+	})
+}
+
+func (s *anthropicStream) delta(delta map[string]string) error {
+	return s.emit("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": s.blockIndex,
+		"delta": delta,
+	})
+}
+
+func (s *anthropicStream) stopBlock() error {
+	if s.openBlock == "" {
+		return nil
+	}
+	s.openBlock = ""
+	index := s.blockIndex
+	s.blockIndex++
+	return s.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index})
+}
+
+// finish 结束当前内容块并输出message_delta和message_stop，只执行一次
+func (s *anthropicStream) finish() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	if err := s.start(""); err != nil {
+		return err
+	}
+	if err := s.stopBlock(); err != nil {
+		return err
+	}
+	if err := s.emit("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": anthropicStopReason(s.finishReason, s.hasToolUse), "stop_sequence": nil},
+		"usage": map[string]int{"output_tokens": s.usage.OutputTokens},
+	}); err != nil {
+		return err
+	}
+	return s.emit("message_stop", map[string]string{"type": "message_stop"})
+}
+
+func (s *anthropicStream) emit(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeSSE(s.w, event, data)
+}
+
+// geminiStream 将Anthropic SSE事件转换为Gemini流式响应
+// sse为false时按不带alt=sse的streamGenerateContent输出JSON数组
+type geminiStream struct {
+	w       io.Writer
+	decoder *sseDecoder
+	sse     bool
+
+	model      string
+	id         string
+	tools      map[int]*GeminiFunctionCall // 内容块索引 -> 正在接收参数的函数调用
+	args       map[int][]byte
+	stopReason string
+	usage      AnthropicUsage
+	chunks     int
+	done       bool
+}
+
+// NewGeminiStream 返回一个Writer，写入Anthropic SSE流，向w输出Gemini流式响应
+func NewGeminiStream(w io.Writer, sse bool) io.WriteCloser {
+	s := &geminiStream{
+		w:     w,
+		sse:   sse,
+		tools: make(map[int]*GeminiFunctionCall),
+		args:  make(map[int][]byte),
+	}
+	s.decoder = &sseDecoder{onEvent: s.event}
+	return s
+}
+
+func (s *geminiStream) Write(p []byte) (int, error) {
+	return s.decoder.Write(p)
+}
+
+func (s *geminiStream) Close() error {
+	if err := s.decoder.Close(); err != nil {
+		return err
+	}
+	return s.finish()
+}
+
+func (s *geminiStream) event(_ string, data []byte) error {
+	if s.done {
+		return nil
+	}
+	var event anthropicStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.id = event.Message.ID
+			s.model = event.Message.Model
+			s.usage = event.Message.Usage
+		}
+
+	case "content_block_start":
+		if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+			s.tools[event.Index] = &GeminiFunctionCall{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name}
+		}
+
+	case "content_block_delta":
+		if event.Delta == nil {
+			return nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			return s.chunk([]GeminiPart{{Text: event.Delta.Text}}, "", nil)
+		case "input_json_delta":
+			s.args[event.Index] = append(s.args[event.Index], event.Delta.PartialJSON...)
+		}
+
+	case "content_block_stop":
+		call, ok := s.tools[event.Index]
+		if !ok {
+			return nil
+		}
+		delete(s.tools, event.Index)
+		call.Args = toolArguments(string(s.args[event.Index]))
+		delete(s.args, event.Index)
+		return s.chunk([]GeminiPart{{FunctionCall: call}}, "", nil)
+
+	case "message_delta":
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			s.stopReason = event.Delta.StopReason
+		}
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+
+	case "message_stop":
+		return s.finish()
+
+	case "error":
+		message := "upstream stream error"
+		if event.Error != nil && event.Error.Message != "" {
+			message = event.Error.Message
+		}
+		s.done = true
+		if err := s.write(GeminiErrorBody(http.StatusInternalServerError, message)); err != nil {
+			return err
+		}
+		return s.closeArray()
+	}
+	return nil
+}
+
+// chunk 输出一个Gemini流式响应块
+func (s *geminiStream) chunk(parts []GeminiPart, finishReason string, usage *GeminiUsage) error {
+	data, err := json.Marshal(GeminiResponse{
+		Candidates: []GeminiCandidate{{
+			Content:      GeminiContent{Role: "model", Parts: parts},
+			FinishReason: finishReason,
+		}},
+		UsageMetadata: usage,
+		ModelVersion:  s.model,
+		ResponseID:    s.id,
+	})
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+// finish 输出带finishReason和用量的最后一块，只执行一次
+func (s *geminiStream) finish() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	if err := s.chunk([]GeminiPart{}, geminiFinishReason(s.stopReason), geminiUsage(s.usage)); err != nil {
+		return err
+	}
+	return s.closeArray()
+}
+
+func (s *geminiStream) write(data []byte) error {
+	if s.sse {
+		return writeSSE(s.w, "", data)
+	}
+	prefix := ",\r\n"
+	if s.chunks == 0 {
+		prefix = "["
+	}
+	s.chunks++
+	_, err := fmt.Fprintf(s.w, "%s%s", prefix, data)
+	return err
+}
+
+// closeArray 非SSE模式下结束JSON数组
+func (s *geminiStream) closeArray() error {
+	if s.sse {
+		return nil
+	}
+	if s.chunks == 0 {
+		_, err := io.WriteString(s.w, "[]")
+		return err
+	}
+	_, err := io.WriteString(s.w, "]")
+	return err
+}
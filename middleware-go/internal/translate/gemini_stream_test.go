@@ -0,0 +1,127 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicStream(t *testing.T) {
+	tests := []string{"text", "tool_call", "error", "empty"}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := readTestdata(t, "anthropic_stream/"+name+".sse")
+			var out bytes.Buffer
+			stream := NewAnthropicStream(&out, "claude-sonnet-4-20250514")
+			if _, err := stream.Write(input); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := stream.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			checkGolden(t, "anthropic_stream/"+name+".golden", out.Bytes())
+
+			// 上游响应按任意位置切分写入时输出不变
+			var chunked bytes.Buffer
+			stream = NewAnthropicStream(&chunked, "claude-sonnet-4-20250514")
+			writeChunked(t, stream, input, 7)
+			stream.Close()
+			if chunked.String() != out.String() {
+				t.Errorf("chunked output differs:\n%s", chunked.String())
+			}
+		})
+	}
+}
+
+// TestAnthropicStreamEvents 检查转换后的事件序列符合Anthropic流式协议
+func TestAnthropicStreamEvents(t *testing.T) {
+	var out bytes.Buffer
+	stream := NewAnthropicStream(&out, "claude-sonnet-4-20250514")
+	stream.Write(readTestdata(t, "anthropic_stream/tool_call.sse"))
+	stream.Close()
+
+	var types []string
+	var input strings.Builder
+	decoder := &sseDecoder{onEvent: func(event string, data []byte) error {
+		var parsed anthropicStreamEvent
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			t.Fatalf("event %s: invalid JSON %s", event, data)
+		}
+		if parsed.Type != event {
+			t.Errorf("event %q carries type %q", event, parsed.Type)
+		}
+		types = append(types, event)
+		if parsed.Delta != nil && parsed.Delta.Type == "input_json_delta" && parsed.Index == 1 {
+			input.WriteString(parsed.Delta.PartialJSON)
+		}
+		return nil
+	}}
+	decoder.Write(out.Bytes())
+	decoder.Close()
+
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if !jsonEqual(json.RawMessage(input.String()), json.RawMessage(`{"city":"Paris"}`)) {
+		t.Errorf("tool input = %s, want {\"city\":\"Paris\"}", input.String())
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	tests := []string{"text", "tool_use", "error", "truncated"}
+	for _, name := range tests {
+		for _, sse := range []bool{true, false} {
+			golden := "gemini_stream/" + name + ".json.golden"
+			if sse {
+				golden = "gemini_stream/" + name + ".sse.golden"
+			}
+			t.Run(golden, func(t *testing.T) {
+				input := readTestdata(t, "gemini_stream/"+name+".sse")
+				var out bytes.Buffer
+				stream := NewGeminiStream(&out, sse)
+				writeChunked(t, stream, input, 5)
+				if err := stream.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				if !sse && !json.Valid(out.Bytes()) {
+					t.Errorf("streamGenerateContent output is not a JSON array: %s", out.Bytes())
+				}
+				checkGolden(t, golden, out.Bytes())
+			})
+		}
+	}
+}
+
+func TestGeminiStreamEmpty(t *testing.T) {
+	var out bytes.Buffer
+	stream := NewGeminiStream(&out, false)
+	stream.Close()
+	var chunks []GeminiResponse
+	if err := json.Unmarshal(out.Bytes(), &chunks); err != nil || len(chunks) != 1 || chunks[0].Candidates[0].FinishReason != "STOP" {
+		t.Errorf("empty stream output = %s, want a single final chunk", out.Bytes())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("client gone") }
+
+func TestStreamWriteErrors(t *testing.T) {
+	anthropic := NewAnthropicStream(failingWriter{}, "claude-sonnet-4")
+	if _, err := anthropic.Write(readTestdata(t, "anthropic_stream/text.sse")); err == nil {
+		t.Error("anthropic stream: write error not returned")
+	}
+	gemini := NewGeminiStream(failingWriter{}, true)
+	if _, err := gemini.Write(readTestdata(t, "gemini_stream/text.sse")); err == nil {
+		t.Error("gemini stream: write error not returned")
+	}
+}
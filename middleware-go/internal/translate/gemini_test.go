@@ -0,0 +1,367 @@
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicToGemini(t *testing.T) {
+	tests := []string{
+		"system_string",
+		"system_blocks",
+		"tool_round_trip",
+		"images",
+	}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			input := readTestdata(t, "anthropic_to_gemini/"+name+".json")
+			out, req, err := AnthropicToGemini(input)
+			if err != nil {
+				t.Fatalf("AnthropicToGemini: %v", err)
+			}
+			var want AnthropicRequest
+			json.Unmarshal(input, &want)
+			if req.Model != want.Model || req.Stream != want.Stream {
+				t.Errorf("request model/stream = %s/%v, want %s/%v", req.Model, req.Stream, want.Model, want.Stream)
+			}
+			got, err := json.Marshal(out)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			checkGolden(t, "anthropic_to_gemini/"+name+".golden", got)
+		})
+	}
+}
+
+func TestAnthropicToGeminiToolChoice(t *testing.T) {
+	tests := []struct {
+		choice  string
+		mode    string
+		allowed []string
+	}{
+		{`{"type":"auto"}`, "AUTO", nil},
+		{`{"type":"any"}`, "ANY", nil},
+		{`{"type":"tool","name":"get_weather"}`, "ANY", []string{"get_weather"}},
+		{`{"type":"none"}`, "NONE", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			body := `{"model":"gemini-2.5-pro","max_tokens":10,"messages":[{"role":"user","content":"hi"}],"tool_choice":` + tt.choice + `}`
+			out, _, err := AnthropicToGemini([]byte(body))
+			if err != nil {
+				t.Fatalf("AnthropicToGemini: %v", err)
+			}
+			config := out.ToolConfig.FunctionCallingConfig
+			if config.Mode != tt.mode || !reflect.DeepEqual(config.AllowedFunctionNames, tt.allowed) {
+				t.Errorf("functionCallingConfig = %+v, want mode %s allowed %v", config, tt.mode, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestAnthropicToGeminiInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"malformed JSON", `{"model":`, "malformed JSON"},
+		{"missing model", `{"messages":[{"role":"user","content":"hi"}]}`, "model is required"},
+		{"no messages", `{"model":"gemini-2.5-pro","messages":[]}`, "messages must not be empty"},
+		{"unsupported role", `{"model":"gemini-2.5-pro","messages":[{"role":"system","content":"hi"}]}`, `unsupported role "system"`},
+		{"only empty messages", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":""}]}`, "at least one non-empty message"},
+		{"unknown tool_use_id", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_x","content":"ok"}]}]}`,
+			`unknown tool_use_id "toolu_x"`},
+		{"image without source", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":[{"type":"image"}]}]}`, "image source is required"},
+		{"unsupported image source", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":[{"type":"image","source":{"type":"file","file_id":"f"}}]}]}`,
+			`unsupported image source type "file"`},
+		{"unsupported tool_choice", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"tool_choice":{"type":"required"}}`,
+			`unsupported tool_choice type "required"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := AnthropicToGemini([]byte(tt.body))
+			if !errors.Is(err, ErrInvalidRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("AnthropicToGemini() error = %v, want invalid request containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeminiToAnthropic(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		stream bool
+	}{
+		{"generation_config", "claude-sonnet-4-20250514", false},
+		{"defaults", "claude-opus-4-20250514", true},
+		{"function_calls", "claude-sonnet-4-20250514", false},
+		{"media", "claude-sonnet-4-20250514", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := readTestdata(t, "gemini_to_anthropic/"+tt.name+".json")
+			out, err := GeminiToAnthropic(input, tt.model, tt.stream, 4096)
+			if err != nil {
+				t.Fatalf("GeminiToAnthropic: %v", err)
+			}
+			got, err := json.Marshal(out)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			checkGolden(t, "gemini_to_anthropic/"+tt.name+".golden", got)
+		})
+	}
+}
+
+func TestGeminiToAnthropicToolConfig(t *testing.T) {
+	tests := []struct {
+		config string
+		want   AnthropicToolChoice
+	}{
+		{`{}`, AnthropicToolChoice{Type: "auto"}},
+		{`{"mode":"auto"}`, AnthropicToolChoice{Type: "auto"}},
+		{`{"mode":"MODE_UNSPECIFIED"}`, AnthropicToolChoice{Type: "auto"}},
+		{`{"mode":"ANY"}`, AnthropicToolChoice{Type: "any"}},
+		{`{"mode":"ANY","allowedFunctionNames":["a","b"]}`, AnthropicToolChoice{Type: "any"}},
+		{`{"mode":"ANY","allowedFunctionNames":["a"]}`, AnthropicToolChoice{Type: "tool", Name: "a"}},
+		{`{"mode":"NONE"}`, AnthropicToolChoice{Type: "none"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			body := `{"contents":[{"parts":[{"text":"hi"}]}],"toolConfig":{"functionCallingConfig":` + tt.config + `}}`
+			out, err := GeminiToAnthropic([]byte(body), "claude-sonnet-4", false, 100)
+			if err != nil {
+				t.Fatalf("GeminiToAnthropic: %v", err)
+			}
+			if out.ToolChoice == nil || *out.ToolChoice != tt.want {
+				t.Errorf("tool_choice = %+v, want %+v", out.ToolChoice, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeminiToAnthropicInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"malformed JSON", `{"contents":`, "malformed JSON"},
+		{"no contents", `{"contents":[]}`, "contents must not be empty"},
+		{"candidate count", `{"contents":[{"parts":[{"text":"hi"}]}],"generationConfig":{"candidateCount":2}}`, "candidateCount > 1"},
+		{"unsupported role", `{"contents":[{"role":"system","parts":[{"text":"hi"}]}]}`, `unsupported role "system"`},
+		{"only empty parts", `{"contents":[{"parts":[{"text":""}]}]}`, "at least one non-empty part"},
+		{"unmatched function response", `{"contents":[{"parts":[{"functionResponse":{"name":"get_weather","response":{}}}]}]}`,
+			`functionResponse "get_weather" has no matching functionCall`},
+		{"unsupported mode", `{"contents":[{"parts":[{"text":"hi"}]}],"toolConfig":{"functionCallingConfig":{"mode":"VALIDATED"}}}`,
+			`unsupported functionCallingConfig mode "VALIDATED"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GeminiToAnthropic([]byte(tt.body), "claude-sonnet-4", false, 100)
+			if !errors.Is(err, ErrInvalidRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GeminiToAnthropic() error = %v, want invalid request containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestToolCallRoundTrip Anthropic请求转换为Gemini后再转换回来，工具调用和结果的对应关系保持不变
+func TestToolCallRoundTrip(t *testing.T) {
+	input := readTestdata(t, "anthropic_to_gemini/tool_round_trip.json")
+	gemini, original, err := AnthropicToGemini(input)
+	if err != nil {
+		t.Fatalf("AnthropicToGemini: %v", err)
+	}
+	geminiBody, _ := json.Marshal(gemini)
+	back, err := GeminiToAnthropic(geminiBody, original.Model, original.Stream, original.MaxTokens)
+	if err != nil {
+		t.Fatalf("GeminiToAnthropic: %v", err)
+	}
+
+	if len(back.Tools) != len(original.Tools) {
+		t.Fatalf("tools = %d, want %d", len(back.Tools), len(original.Tools))
+	}
+	for i, tool := range back.Tools {
+		if tool.Name != original.Tools[i].Name || !jsonEqual(tool.InputSchema, original.Tools[i].InputSchema) {
+			t.Errorf("tools[%d] = %s %s, want %s %s", i, tool.Name, tool.InputSchema, original.Tools[i].Name, original.Tools[i].InputSchema)
+		}
+	}
+	if back.ToolChoice == nil || *back.ToolChoice != *original.ToolChoice {
+		t.Errorf("tool_choice = %+v, want %+v", back.ToolChoice, original.ToolChoice)
+	}
+
+	var uses, results []AnthropicBlock
+	for _, msg := range back.Messages {
+		for _, block := range blocks(msg.Content) {
+			switch block.Type {
+			case "tool_use":
+				uses = append(uses, block)
+			case "tool_result":
+				results = append(results, block)
+			}
+		}
+	}
+	wantUses := []struct{ id, name, input string }{
+		{"toolu_01", "get_weather", `{"city":"Paris"}`},
+		{"toolu_02", "get_time", `{}`},
+	}
+	if len(uses) != len(wantUses) {
+		t.Fatalf("tool_use blocks = %d, want %d", len(uses), len(wantUses))
+	}
+	for i, want := range wantUses {
+		if uses[i].ID != want.id || uses[i].Name != want.name || !jsonEqual(uses[i].Input, json.RawMessage(want.input)) {
+			t.Errorf("tool_use[%d] = %s %s %s, want %s %s %s", i, uses[i].ID, uses[i].Name, uses[i].Input, want.id, want.name, want.input)
+		}
+	}
+	wantResults := []struct{ id, content string }{
+		{"toolu_01", `{"content":"18C, cloudy"}`},
+		{"toolu_02", `{"error":"timeout"}`},
+	}
+	if len(results) != len(wantResults) {
+		t.Fatalf("tool_result blocks = %d, want %d", len(results), len(wantResults))
+	}
+	for i, want := range wantResults {
+		var content string
+		json.Unmarshal(results[i].Content, &content)
+		if results[i].ToolUseID != want.id || !jsonEqual(json.RawMessage(content), json.RawMessage(want.content)) {
+			t.Errorf("tool_result[%d] = %s %s, want %s %s", i, results[i].ToolUseID, content, want.id, want.content)
+		}
+	}
+}
+
+func TestGeminiToAnthropicResponse(t *testing.T) {
+	tests := []string{"text_and_tool", "max_tokens", "safety"}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := GeminiToAnthropicResponse(readTestdata(t, "gemini_response/"+name+".json"), "claude-sonnet-4-20250514")
+			if err != nil {
+				t.Fatalf("GeminiToAnthropicResponse: %v", err)
+			}
+			checkGolden(t, "gemini_response/"+name+".golden", got)
+		})
+	}
+}
+
+func TestGeminiToAnthropicResponseGeneratesToolIDs(t *testing.T) {
+	body := `{"candidates":[{"content":{"parts":[{"functionCall":{"name":"a"}},{"functionCall":{"name":"b","args":null}}]},"finishReason":"STOP"}]}`
+	got, err := GeminiToAnthropicResponse([]byte(body), "claude-sonnet-4")
+	if err != nil {
+		t.Fatalf("GeminiToAnthropicResponse: %v", err)
+	}
+	var resp AnthropicResponse
+	json.Unmarshal(got, &resp)
+	if len(resp.Content) != 2 || resp.StopReason != "tool_use" || resp.ID != "msg_gemini" {
+		t.Fatalf("response = %s", got)
+	}
+	first, second := resp.Content[0], resp.Content[1]
+	if !strings.HasPrefix(first.ID, "toolu_") || len(first.ID) != len("toolu_")+24 || first.ID == second.ID {
+		t.Errorf("generated IDs = %q, %q, want distinct toolu_ IDs", first.ID, second.ID)
+	}
+	if string(second.Input) != `{}` {
+		t.Errorf("null args converted to %s, want {}", second.Input)
+	}
+}
+
+func TestGeminiToAnthropicResponseMalformed(t *testing.T) {
+	if _, err := GeminiToAnthropicResponse([]byte(`<html>`), "claude-sonnet-4"); err == nil || !strings.Contains(err.Error(), "malformed upstream response") {
+		t.Errorf("error = %v, want malformed upstream response", err)
+	}
+	if _, err := AnthropicToGeminiResponse([]byte(`<html>`)); err == nil || !strings.Contains(err.Error(), "malformed upstream response") {
+		t.Errorf("error = %v, want malformed upstream response", err)
+	}
+}
+
+func TestAnthropicToGeminiResponse(t *testing.T) {
+	tests := []string{"text_and_tool", "max_tokens"}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := AnthropicToGeminiResponse(readTestdata(t, "anthropic_response/"+name+".json"))
+			if err != nil {
+				t.Fatalf("AnthropicToGeminiResponse: %v", err)
+			}
+			checkGolden(t, "anthropic_response/"+name+".golden", got)
+		})
+	}
+}
+
+func TestStopReasonMapping(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		hasToolUse   bool
+		want         string
+	}{
+		{"STOP", false, "end_turn"},
+		{"STOP", true, "tool_use"},
+		{"", false, "end_turn"},
+		{"MAX_TOKENS", true, "max_tokens"},
+		{"SAFETY", false, "refusal"},
+		{"RECITATION", false, "refusal"},
+		{"PROHIBITED_CONTENT", true, "refusal"},
+		{"OTHER", false, "end_turn"},
+	}
+	for _, tt := range tests {
+		if got := anthropicStopReason(tt.finishReason, tt.hasToolUse); got != tt.want {
+			t.Errorf("anthropicStopReason(%q, %v) = %q, want %q", tt.finishReason, tt.hasToolUse, got, tt.want)
+		}
+	}
+	for stopReason, want := range map[string]string{
+		"end_turn": "STOP", "tool_use": "STOP", "stop_sequence": "STOP", "max_tokens": "MAX_TOKENS", "refusal": "SAFETY",
+	} {
+		if got := geminiFinishReason(stopReason); got != want {
+			t.Errorf("geminiFinishReason(%q) = %q, want %q", stopReason, got, want)
+		}
+	}
+}
+
+func TestGeminiErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"gemini error body", GeminiErrorBody(429, "slow down"),
+			`{"error":{"code":429,"message":"slow down","status":"RESOURCE_EXHAUSTED"}}`},
+		{"gemini error body 5xx", GeminiErrorBody(502, "bad gateway"),
+			`{"error":{"code":502,"message":"bad gateway","status":"INTERNAL"}}`},
+		{"gemini error body 529", GeminiErrorBody(529, "overloaded"),
+			`{"error":{"code":529,"message":"overloaded","status":"UNAVAILABLE"}}`},
+		{"gemini error body 409", GeminiErrorBody(409, "conflict"),
+			`{"error":{"code":409,"message":"conflict","status":"FAILED_PRECONDITION"}}`},
+		{"anthropic error body", AnthropicErrorBody(413, "too large"),
+			`{"type":"error","error":{"type":"request_too_large","message":"too large"}}`},
+		{"gemini to anthropic", GeminiToAnthropicError(403, []byte(`{"error":{"code":403,"message":"API key not valid","status":"PERMISSION_DENIED"}}`)),
+			`{"type":"error","error":{"type":"permission_error","message":"API key not valid"}}`},
+		{"gemini to anthropic plain text", GeminiToAnthropicError(502, []byte("upstream connect error\n")),
+			`{"type":"error","error":{"type":"api_error","message":"upstream connect error"}}`},
+		{"gemini to anthropic empty", GeminiToAnthropicError(503, nil),
+			`{"type":"error","error":{"type":"api_error","message":"Service Unavailable"}}`},
+		{"anthropic to gemini", AnthropicToGeminiError(529, []byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)),
+			`{"error":{"code":529,"message":"Overloaded","status":"UNAVAILABLE"}}`},
+		{"anthropic to gemini 401", AnthropicToGeminiError(401, []byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)),
+			`{"error":{"code":401,"message":"invalid x-api-key","status":"UNAUTHENTICATED"}}`},
+		{"anthropic to gemini plain text", AnthropicToGeminiError(504, []byte("timeout")),
+			`{"error":{"code":504,"message":"timeout","status":"DEADLINE_EXCEEDED"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if string(tt.got) != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+// jsonEqual 忽略格式和字段顺序比较两段JSON
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
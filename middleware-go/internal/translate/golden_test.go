@@ -0,0 +1,66 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// readTestdata 读取testdata下的输入文件
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read input: %v", err)
+	}
+	return data
+}
+
+// checkGolden 对比输出与testdata下的golden文件，-update时重写golden文件
+// JSON对象缩进后再对比，便于阅读golden文件；流式输出（包括JSON数组）按原样对比
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	if bytes.HasPrefix(got, []byte("{")) && json.Valid(got) {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, got, "", "  "); err == nil {
+			indented.WriteByte('\n')
+			got = indented.Bytes()
+		}
+	}
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden (run go test -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// writeChunked 按size字节分块写入，模拟上游流式响应被任意切分
+func writeChunked(t *testing.T, w io.Writer, data []byte, size int) {
+	t.Helper()
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		data = data[n:]
+	}
+}
@@ -0,0 +1,646 @@
+package translate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIRequest OpenAI Chat Completions请求中支持转换的字段
+type OpenAIRequest struct {
+	Model               string          `json:"model"`
+	Messages            []OpenAIMessage `json:"messages"`
+	MaxTokens           int             `json:"max_tokens"`
+	MaxCompletionTokens int             `json:"max_completion_tokens"`
+	Temperature         *float64        `json:"temperature"`
+	TopP                *float64        `json:"top_p"`
+	Stop                json.RawMessage `json:"stop"` // 字符串或字符串数组
+	Stream              bool            `json:"stream"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Tools             []OpenAITool    `json:"tools"`
+	ToolChoice        json.RawMessage `json:"tool_choice"` // "auto"、"none"、"required" 或 {"type":"function","function":{"name":...}}
+	ParallelToolCalls *bool           `json:"parallel_tool_calls"`
+	User              string          `json:"user"`
+	N                 int             `json:"n"`
+}
+
+// OpenAIMessage 一条消息，content可以是字符串或内容片段数组
+type OpenAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// OpenAIContentPart 内容片段
+type OpenAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// OpenAITool 工具定义
+type OpenAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// OpenAIToolCall 助手发起的工具调用
+type OpenAIToolCall struct {
+	Index    *int   `json:"index,omitempty"` // 仅流式响应使用
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ErrInvalidRequest 客户端请求无法转换，应返回400
+var ErrInvalidRequest = errors.New("invalid request")
+
+func invalidRequest(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, fmt.Sprintf(format, args...))
+}
+
+// OpenAIToAnthropic 将OpenAI Chat Completions请求转换为Anthropic Messages请求
+// 请求未指定max_tokens时使用defaultMaxTokens
+func OpenAIToAnthropic(body []byte, defaultMaxTokens int) (*AnthropicRequest, *OpenAIRequest, error) {
+	var req OpenAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, nil, invalidRequest("malformed JSON: %v", err)
+	}
+	if req.Model == "" {
+		return nil, nil, invalidRequest("model is required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, nil, invalidRequest("messages must not be empty")
+	}
+	if req.N > 1 {
+		return nil, nil, invalidRequest("n > 1 is not supported")
+	}
+
+	out := &AnthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   defaultMaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	if req.MaxCompletionTokens > 0 {
+		out.MaxTokens = req.MaxCompletionTokens
+	} else if req.MaxTokens > 0 {
+		out.MaxTokens = req.MaxTokens
+	}
+	if req.User != "" {
+		out.Metadata = &AnthropicMetadata{UserID: req.User}
+	}
+
+	stop, err := stopSequences(req.Stop)
+	if err != nil {
+		return nil, nil, err
+	}
+	out.StopSequences = stop
+
+	var system []string
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system", "developer":
+			text, err := openAIText(msg.Content)
+			if err != nil {
+				return nil, nil, invalidRequest("messages[%d]: %v", i, err)
+			}
+			system = append(system, text)
+
+		case "user":
+			content, err := openAIUserBlocks(msg.Content)
+			if err != nil {
+				return nil, nil, invalidRequest("messages[%d]: %v", i, err)
+			}
+			if out.Messages, err = appendMessage(out.Messages, "user", content); err != nil {
+				return nil, nil, err
+			}
+
+		case "assistant":
+			var content []AnthropicBlock
+			if len(msg.Content) > 0 && string(msg.Content) != "null" {
+				text, err := openAIText(msg.Content)
+				if err != nil {
+					return nil, nil, invalidRequest("messages[%d]: %v", i, err)
+				}
+				if text != "" {
+					content = append(content, AnthropicBlock{Type: "text", Text: text})
+				}
+			}
+			for _, call := range msg.ToolCalls {
+				content = append(content, AnthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: toolArguments(call.Function.Arguments),
+				})
+			}
+			if len(content) == 0 {
+				continue
+			}
+			if out.Messages, err = appendMessage(out.Messages, "assistant", content); err != nil {
+				return nil, nil, err
+			}
+
+		case "tool":
+			text, err := openAIText(msg.Content)
+			if err != nil {
+				return nil, nil, invalidRequest("messages[%d]: %v", i, err)
+			}
+			result, err := json.Marshal(text)
+			if err != nil {
+				return nil, nil, err
+			}
+			content := []AnthropicBlock{{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: result}}
+			if out.Messages, err = appendMessage(out.Messages, "user", content); err != nil {
+				return nil, nil, err
+			}
+
+		default:
+			return nil, nil, invalidRequest("messages[%d]: unsupported role %q", i, msg.Role)
+		}
+	}
+	if len(system) > 0 {
+		if out.System, err = json.Marshal(strings.Join(system, "\n\n")); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, nil, invalidRequest("at least one user or assistant message is required")
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			return nil, nil, invalidRequest("unsupported tool type %q", tool.Type)
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 || string(schema) == "null" {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, AnthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	choice, err := toolChoice(req.ToolChoice)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls && len(out.Tools) > 0 {
+		if choice == nil {
+			choice = &AnthropicToolChoice{Type: "auto"}
+		}
+		if choice.Type != "none" {
+			choice.DisableParallelToolUse = true
+		}
+	}
+	out.ToolChoice = choice
+
+	return out, &req, nil
+}
+
+// appendMessage 追加消息，与上一条角色相同时合并（Anthropic要求user/assistant交替）
+func appendMessage(messages []AnthropicMessage, role string, content []AnthropicBlock) ([]AnthropicMessage, error) {
+	n := len(messages)
+	merge := n > 0 && messages[n-1].Role == role
+	if merge {
+		content = append(blocks(messages[n-1].Content), content...)
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	if merge {
+		messages[n-1].Content = data
+		return messages, nil
+	}
+	return append(messages, AnthropicMessage{Role: role, Content: data}), nil
+}
+
+// openAIText 提取字符串或文本片段数组形式的内容
+func openAIText(content json.RawMessage) (string, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return "", nil
+	}
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text, nil
+	}
+	var parts []OpenAIContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", fmt.Errorf("content must be a string or an array of content parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// openAIUserBlocks 转换用户消息中的文本和图片
+func openAIUserBlocks(content json.RawMessage) ([]AnthropicBlock, error) {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return []AnthropicBlock{{Type: "text", Text: text}}, nil
+	}
+	var parts []OpenAIContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("content must be a string or an array of content parts")
+	}
+
+	result := make([]AnthropicBlock, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			result = append(result, AnthropicBlock{Type: "text", Text: part.Text})
+		case "image_url":
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return nil, fmt.Errorf("image_url.url is required")
+			}
+			source, err := imageSource(part.ImageURL.URL)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, AnthropicBlock{Type: "image", Source: source})
+		default:
+			return nil, fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	return result, nil
+}
+
+// imageSource 将data URL或http(s) URL转换为Anthropic图片来源
+func imageSource(url string) (*AnthropicSource, error) {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		header, data, found := strings.Cut(rest, ",")
+		mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+		if !found || !isBase64 || mediaType == "" {
+			return nil, fmt.Errorf("image data URL must be base64 encoded")
+		}
+		return &AnthropicSource{Type: "base64", MediaType: mediaType, Data: data}, nil
+	}
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return &AnthropicSource{Type: "url", URL: url}, nil
+	}
+	return nil, fmt.Errorf("unsupported image URL")
+}
+
+// toolArguments 解析工具调用参数，无效JSON时使用空对象
+func toolArguments(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) && strings.HasPrefix(strings.TrimSpace(arguments), "{") {
+		return json.RawMessage(arguments)
+	}
+	return json.RawMessage(`{}`)
+}
+
+// stopSequences 解析字符串或字符串数组形式的stop
+func stopSequences(stop json.RawMessage) ([]string, error) {
+	if len(stop) == 0 || string(stop) == "null" {
+		return nil, nil
+	}
+	var single string
+	if json.Unmarshal(stop, &single) == nil {
+		return []string{single}, nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(stop, &multiple); err != nil {
+		return nil, invalidRequest("stop must be a string or an array of strings")
+	}
+	return multiple, nil
+}
+
+// toolChoice 转换tool_choice
+func toolChoice(raw json.RawMessage) (*AnthropicToolChoice, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var mode string
+	if json.Unmarshal(raw, &mode) == nil {
+		switch mode {
+		case "auto":
+			return &AnthropicToolChoice{Type: "auto"}, nil
+		case "none":
+			return &AnthropicToolChoice{Type: "none"}, nil
+		case "required":
+			return &AnthropicToolChoice{Type: "any"}, nil
+		}
+		return nil, invalidRequest("unsupported tool_choice %q", mode)
+	}
+
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return nil, invalidRequest("tool_choice must name a function")
+	}
+	return &AnthropicToolChoice{Type: "tool", Name: named.Function.Name}, nil
+}
+
+// OpenAIResponse chat.completion响应
+type OpenAIResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+}
+
+// OpenAIChoice 响应中的候选结果（非流式使用Message，流式使用Delta）
+type OpenAIChoice struct {
+	Index        int           `json:"index"`
+	Message      *OpenAIOutput `json:"message,omitempty"`
+	Delta        *OpenAIOutput `json:"delta,omitempty"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+// OpenAIOutput 助手输出
+type OpenAIOutput struct {
+	Role      string           `json:"role,omitempty"`
+	Content   *string          `json:"content,omitempty"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+}
+
+// OpenAIUsage Token用量
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// openAIFinishReason 将Anthropic的stop_reason映射为OpenAI的finish_reason
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func openAIUsage(usage AnthropicUsage) *OpenAIUsage {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return &OpenAIUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      prompt + usage.OutputTokens,
+	}
+}
+
+// AnthropicToOpenAIResponse 将Anthropic Messages响应转换为chat.completion响应
+func AnthropicToOpenAIResponse(body []byte) ([]byte, error) {
+	var resp AnthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("malformed upstream response: %w", err)
+	}
+
+	output := &OpenAIOutput{Role: "assistant"}
+	var texts []string
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			call := OpenAIToolCall{ID: block.ID, Type: "function"}
+			call.Function.Name = block.Name
+			call.Function.Arguments = string(block.Input)
+			if len(block.Input) == 0 {
+				call.Function.Arguments = "{}"
+			}
+			output.ToolCalls = append(output.ToolCalls, call)
+		}
+	}
+	if len(texts) > 0 || len(output.ToolCalls) == 0 {
+		text := strings.Join(texts, "")
+		output.Content = &text
+	}
+
+	finish := openAIFinishReason(resp.StopReason)
+	return json.Marshal(OpenAIResponse{
+		ID:      "chatcmpl-" + resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []OpenAIChoice{{Message: output, FinishReason: &finish}},
+		Usage:   openAIUsage(resp.Usage),
+	})
+}
+
+// openAIErrorType 将HTTP状态码映射为OpenAI错误类型
+func openAIErrorType(status int) string {
+	switch {
+	case status == 401:
+		return "authentication_error"
+	case status == 403:
+		return "permission_error"
+	case status == 404:
+		return "not_found_error"
+	case status == 429:
+		return "rate_limit_error"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// OpenAIError 生成OpenAI格式的错误响应
+func OpenAIError(status int, message string) []byte {
+	// 只包含字符串和nil，编码不会失败
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    openAIErrorType(status),
+			"param":   nil,
+			"code":    nil,
+		},
+	})
+	return data
+}
+
+// AnthropicToOpenAIError 将Anthropic错误响应转换为OpenAI格式，无法解析时原样包装
+func AnthropicToOpenAIError(status int, body []byte) []byte {
+	var upstream AnthropicError
+	if json.Unmarshal(body, &upstream) == nil && upstream.Error.Message != "" {
+		return OpenAIError(status, upstream.Error.Message)
+	}
+	return OpenAIError(status, errorMessage(status, body))
+}
+
+// openAIStream 将Anthropic流式事件转换为chat.completion.chunk
+type openAIStream struct {
+	w            io.Writer
+	decoder      *sseDecoder
+	includeUsage bool
+
+	id        string
+	model     string
+	created   int64
+	toolIndex map[int]int // Anthropic内容块索引 -> tool_calls索引
+	usage     AnthropicUsage
+	done      bool
+}
+
+// NewOpenAIStream 返回一个Writer，写入Anthropic SSE流，向w输出OpenAI SSE流
+// includeUsage对应请求中的stream_options.include_usage
+func NewOpenAIStream(w io.Writer, includeUsage bool) io.WriteCloser {
+	s := &openAIStream{
+		w:            w,
+		includeUsage: includeUsage,
+		created:      time.Now().Unix(),
+		toolIndex:    make(map[int]int),
+	}
+	s.decoder = &sseDecoder{onEvent: s.event}
+	return s
+}
+
+func (s *openAIStream) Write(p []byte) (int, error) {
+	return s.decoder.Write(p)
+}
+
+// Close 上游未正常结束时也补发[DONE]
+func (s *openAIStream) Close() error {
+	if err := s.decoder.Close(); err != nil {
+		return err
+	}
+	return s.finish()
+}
+
+func (s *openAIStream) event(_ string, data []byte) error {
+	var event anthropicStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			s.id = "chatcmpl-" + event.Message.ID
+			s.model = event.Message.Model
+			s.usage = event.Message.Usage
+		}
+		empty := ""
+		return s.chunk(&OpenAIOutput{Role: "assistant", Content: &empty}, nil)
+
+	case "content_block_start":
+		if event.ContentBlock == nil || event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		index := len(s.toolIndex)
+		s.toolIndex[event.Index] = index
+		call := OpenAIToolCall{Index: &index, ID: event.ContentBlock.ID, Type: "function"}
+		call.Function.Name = event.ContentBlock.Name
+		return s.chunk(&OpenAIOutput{ToolCalls: []OpenAIToolCall{call}}, nil)
+
+	case "content_block_delta":
+		if event.Delta == nil {
+			return nil
+		}
+		switch event.Delta.Type {
+		case "text_delta":
+			text := event.Delta.Text
+			return s.chunk(&OpenAIOutput{Content: &text}, nil)
+		case "input_json_delta":
+			index, ok := s.toolIndex[event.Index]
+			if !ok {
+				return nil
+			}
+			call := OpenAIToolCall{Index: &index}
+			call.Function.Arguments = event.Delta.PartialJSON
+			return s.chunk(&OpenAIOutput{ToolCalls: []OpenAIToolCall{call}}, nil)
+		}
+
+	case "message_delta":
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+		if event.Delta != nil && event.Delta.StopReason != "" {
+			finish := openAIFinishReason(event.Delta.StopReason)
+			return s.chunk(&OpenAIOutput{}, &finish)
+		}
+
+	case "message_stop":
+		return s.finish()
+
+	case "error":
+		message := "upstream stream error"
+		if event.Error != nil && event.Error.Message != "" {
+			message = event.Error.Message
+		}
+		if err := writeSSE(s.w, "", OpenAIError(http.StatusInternalServerError, message)); err != nil {
+			return err
+		}
+		return s.finish()
+	}
+	return nil
+}
+
+// chunk 输出一个chat.completion.chunk
+func (s *openAIStream) chunk(delta *OpenAIOutput, finishReason *string) error {
+	if s.done {
+		return nil
+	}
+	data, err := json.Marshal(OpenAIResponse{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []OpenAIChoice{{Delta: delta, FinishReason: finishReason}},
+	})
+	if err != nil {
+		return err
+	}
+	return writeSSE(s.w, "", data)
+}
+
+// finish 输出可选的用量块和[DONE]，只执行一次
+func (s *openAIStream) finish() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	if s.includeUsage {
+		data, err := json.Marshal(OpenAIResponse{
+			ID:      s.id,
+			Object:  "chat.completion.chunk",
+			Created: s.created,
+			Model:   s.model,
+			Choices: []OpenAIChoice{},
+			Usage:   openAIUsage(s.usage),
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeSSE(s.w, "", data); err != nil {
+			return err
+		}
+	}
+	return writeSSE(s.w, "", []byte("[DONE]"))
+}
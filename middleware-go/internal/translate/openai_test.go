@@ -0,0 +1,320 @@
+package translate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createdField 响应中的created为当前时间，对比golden文件前替换为0
+var createdField = regexp.MustCompile(`"created":\d+`)
+
+func normalizeCreated(t *testing.T, data []byte) []byte {
+	t.Helper()
+	matches := createdField.FindAll(data, -1)
+	if len(matches) == 0 {
+		t.Fatalf("output has no created field: %s", data)
+	}
+	now := time.Now().Unix()
+	for _, match := range matches {
+		var created int64
+		json.Unmarshal(bytes.TrimPrefix(match, []byte(`"created":`)), &created)
+		if created < now-60 || created > now+60 {
+			t.Errorf("created = %d, want current time", created)
+		}
+	}
+	return createdField.ReplaceAll(data, []byte(`"created":0`))
+}
+
+func TestOpenAIToAnthropic(t *testing.T) {
+	tests := []struct {
+		name             string
+		wantIncludeUsage bool
+	}{
+		{"system_and_params", false},
+		{"stream_options", true},
+		{"images", false},
+		{"tools", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, req, err := OpenAIToAnthropic(readTestdata(t, "openai_to_anthropic/"+tt.name+".json"), 4096)
+			if err != nil {
+				t.Fatalf("OpenAIToAnthropic: %v", err)
+			}
+			includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+			if includeUsage != tt.wantIncludeUsage {
+				t.Errorf("stream_options.include_usage = %v, want %v", includeUsage, tt.wantIncludeUsage)
+			}
+			got, err := json.Marshal(out)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			checkGolden(t, "openai_to_anthropic/"+tt.name+".golden", got)
+		})
+	}
+}
+
+func TestOpenAIToAnthropicMaxTokens(t *testing.T) {
+	tests := []struct {
+		fields string
+		want   int
+	}{
+		{``, 4096},
+		{`,"max_tokens":100`, 100},
+		{`,"max_completion_tokens":200`, 200},
+		{`,"max_tokens":100,"max_completion_tokens":200`, 200},
+	}
+	for _, tt := range tests {
+		body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]` + tt.fields + `}`
+		out, _, err := OpenAIToAnthropic([]byte(body), 4096)
+		if err != nil {
+			t.Fatalf("OpenAIToAnthropic(%s): %v", tt.fields, err)
+		}
+		if out.MaxTokens != tt.want {
+			t.Errorf("max_tokens with %q = %d, want %d", tt.fields, out.MaxTokens, tt.want)
+		}
+	}
+}
+
+func TestOpenAIToolChoice(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   string
+		want     *AnthropicToolChoice
+		wantErr  string
+		withTool bool
+	}{
+		{"unset", ``, nil, "", true},
+		{"auto", `,"tool_choice":"auto"`, &AnthropicToolChoice{Type: "auto"}, "", true},
+		{"none", `,"tool_choice":"none"`, &AnthropicToolChoice{Type: "none"}, "", true},
+		{"required", `,"tool_choice":"required"`, &AnthropicToolChoice{Type: "any"}, "", true},
+		{"named", `,"tool_choice":{"type":"function","function":{"name":"get_weather"}}`,
+			&AnthropicToolChoice{Type: "tool", Name: "get_weather"}, "", true},
+		{"parallel disabled", `,"parallel_tool_calls":false`,
+			&AnthropicToolChoice{Type: "auto", DisableParallelToolUse: true}, "", true},
+		{"parallel disabled with required", `,"tool_choice":"required","parallel_tool_calls":false`,
+			&AnthropicToolChoice{Type: "any", DisableParallelToolUse: true}, "", true},
+		{"parallel disabled with none", `,"tool_choice":"none","parallel_tool_calls":false`,
+			&AnthropicToolChoice{Type: "none"}, "", true},
+		{"parallel disabled without tools", `,"parallel_tool_calls":false`, nil, "", false},
+		{"unknown mode", `,"tool_choice":"sometimes"`, nil, `unsupported tool_choice "sometimes"`, true},
+		{"unnamed function", `,"tool_choice":{"type":"function","function":{}}`, nil, "tool_choice must name a function", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools := ``
+			if tt.withTool {
+				tools = `,"tools":[{"type":"function","function":{"name":"get_weather"}}]`
+			}
+			body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]` + tools + tt.fields + `}`
+			out, _, err := OpenAIToAnthropic([]byte(body), 100)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want invalid request containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenAIToAnthropic: %v", err)
+			}
+			if (out.ToolChoice == nil) != (tt.want == nil) || (tt.want != nil && *out.ToolChoice != *tt.want) {
+				t.Errorf("tool_choice = %+v, want %+v", out.ToolChoice, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIImageSource(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    AnthropicSource
+		wantErr string
+	}{
+		{"data:image/jpeg;base64,/9j/4AAQ", AnthropicSource{Type: "base64", MediaType: "image/jpeg", Data: "/9j/4AAQ"}, ""},
+		{"data:image/webp;base64,", AnthropicSource{Type: "base64", MediaType: "image/webp"}, ""},
+		{"https://example.com/a.png?size=large", AnthropicSource{Type: "url", URL: "https://example.com/a.png?size=large"}, ""},
+		{"http://example.com/a.gif", AnthropicSource{Type: "url", URL: "http://example.com/a.gif"}, ""},
+		{"data:image/png,rawbytes", AnthropicSource{}, "must be base64 encoded"},
+		{"data:;base64,AAAA", AnthropicSource{}, "must be base64 encoded"},
+		{"data:image/png;base64", AnthropicSource{}, "must be base64 encoded"},
+		{"ftp://example.com/a.png", AnthropicSource{}, "unsupported image URL"},
+		{"file:///etc/passwd", AnthropicSource{}, "unsupported image URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := imageSource(tt.url)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("imageSource() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || *got != tt.want {
+				t.Errorf("imageSource() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIToAnthropicInvalid(t *testing.T) {
+	user := `{"role":"user","content":"hi"}`
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"malformed JSON", `{"model":`, "malformed JSON"},
+		{"missing model", `{"messages":[` + user + `]}`, "model is required"},
+		{"no messages", `{"model":"claude-sonnet-4","messages":[]}`, "messages must not be empty"},
+		{"multiple choices", `{"model":"claude-sonnet-4","n":2,"messages":[` + user + `]}`, "n > 1 is not supported"},
+		{"bad stop", `{"model":"claude-sonnet-4","stop":42,"messages":[` + user + `]}`, "stop must be a string or an array of strings"},
+		{"unsupported role", `{"model":"claude-sonnet-4","messages":[{"role":"function","content":"hi"}]}`, `messages[0]: unsupported role "function"`},
+		{"only system", `{"model":"claude-sonnet-4","messages":[{"role":"system","content":"be nice"}]}`, "at least one user or assistant message"},
+		{"bad user content", `{"model":"claude-sonnet-4","messages":[{"role":"user","content":42}]}`, "content must be a string or an array"},
+		{"bad system content", `{"model":"claude-sonnet-4","messages":[{"role":"system","content":{"text":"x"}},` + user + `]}`, "messages[0]: content must be"},
+		{"unsupported part", `{"model":"claude-sonnet-4","messages":[{"role":"user","content":[{"type":"input_audio"}]}]}`,
+			`unsupported content part type "input_audio"`},
+		{"image without url", `{"model":"claude-sonnet-4","messages":[{"role":"user","content":[{"type":"image_url","image_url":{}}]}]}`,
+			"image_url.url is required"},
+		{"image not base64", `{"model":"claude-sonnet-4","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png,xx"}}]}]}`,
+			"image data URL must be base64 encoded"},
+		{"unsupported tool type", `{"model":"claude-sonnet-4","messages":[` + user + `],"tools":[{"type":"retrieval"}]}`,
+			`unsupported tool type "retrieval"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := OpenAIToAnthropic([]byte(tt.body), 100)
+			if !errors.Is(err, ErrInvalidRequest) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("OpenAIToAnthropic() error = %v, want invalid request containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAnthropicToOpenAIResponse(t *testing.T) {
+	tests := []string{"text", "tool_calls", "max_tokens", "refusal"}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := AnthropicToOpenAIResponse(readTestdata(t, "openai_response/"+name+".json"))
+			if err != nil {
+				t.Fatalf("AnthropicToOpenAIResponse: %v", err)
+			}
+			checkGolden(t, "openai_response/"+name+".golden", normalizeCreated(t, got))
+		})
+	}
+	if _, err := AnthropicToOpenAIResponse([]byte(`<html>`)); err == nil || !strings.Contains(err.Error(), "malformed upstream response") {
+		t.Errorf("error = %v, want malformed upstream response", err)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"bad request", OpenAIError(400, "bad"), `{"error":{"code":null,"message":"bad","param":null,"type":"invalid_request_error"}}`},
+		{"unauthorized", OpenAIError(401, "no key"), `{"error":{"code":null,"message":"no key","param":null,"type":"authentication_error"}}`},
+		{"forbidden", OpenAIError(403, "denied"), `{"error":{"code":null,"message":"denied","param":null,"type":"permission_error"}}`},
+		{"not found", OpenAIError(404, "missing"), `{"error":{"code":null,"message":"missing","param":null,"type":"not_found_error"}}`},
+		{"rate limited", OpenAIError(429, "slow"), `{"error":{"code":null,"message":"slow","param":null,"type":"rate_limit_error"}}`},
+		{"server error", OpenAIError(529, "busy"), `{"error":{"code":null,"message":"busy","param":null,"type":"server_error"}}`},
+		{"from anthropic", AnthropicToOpenAIError(429, []byte(`{"type":"error","error":{"type":"rate_limit_error","message":"Number of requests exceeded"}}`)),
+			`{"error":{"code":null,"message":"Number of requests exceeded","param":null,"type":"rate_limit_error"}}`},
+		{"from plain text", AnthropicToOpenAIError(502, []byte(" Bad Gateway \n")),
+			`{"error":{"code":null,"message":"Bad Gateway","param":null,"type":"server_error"}}`},
+		{"from empty body", AnthropicToOpenAIError(503, nil),
+			`{"error":{"code":null,"message":"Service Unavailable","param":null,"type":"server_error"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if string(tt.got) != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		includeUsage bool
+	}{
+		{"text", false},
+		{"text", true},
+		{"tool_use", false},
+		{"parallel_tools", true},
+		{"error", false},
+		{"truncated", true},
+	}
+	for _, tt := range tests {
+		golden := "openai_stream/" + tt.name + ".golden"
+		if tt.includeUsage {
+			golden = "openai_stream/" + tt.name + ".usage.golden"
+		}
+		t.Run(golden, func(t *testing.T) {
+			var out bytes.Buffer
+			stream := NewOpenAIStream(&out, tt.includeUsage)
+			writeChunked(t, stream, readTestdata(t, "openai_stream/"+tt.name+".sse"), 11)
+			if err := stream.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if !strings.HasSuffix(out.String(), "data: [DONE]\n\n") || strings.Count(out.String(), "[DONE]") != 1 {
+				t.Errorf("stream does not end with a single [DONE]:\n%s", out.String())
+			}
+			checkGolden(t, golden, normalizeCreated(t, out.Bytes()))
+		})
+	}
+}
+
+// TestOpenAIStreamToolCalls 按OpenAI客户端的方式拼接流式工具调用参数
+func TestOpenAIStreamToolCalls(t *testing.T) {
+	var out bytes.Buffer
+	stream := NewOpenAIStream(&out, false)
+	stream.Write(readTestdata(t, "openai_stream/parallel_tools.sse"))
+	stream.Close()
+
+	type call struct{ id, name, arguments string }
+	var calls []call
+	var finish string
+	decoder := &sseDecoder{onEvent: func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+		var chunk OpenAIResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			t.Fatalf("invalid chunk %s", data)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				finish = *choice.FinishReason
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				for len(calls) <= *tc.Index {
+					calls = append(calls, call{})
+				}
+				c := &calls[*tc.Index]
+				if tc.ID != "" {
+					c.id, c.name = tc.ID, tc.Function.Name
+				}
+				c.arguments += tc.Function.Arguments
+			}
+		}
+		return nil
+	}}
+	decoder.Write(out.Bytes())
+	decoder.Close()
+
+	want := []call{{"toolu_01", "get_weather", `{"city":"Paris"}`}, {"toolu_02", "get_time", `{}`}}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("tool calls = %+v, want %+v", calls, want)
+	}
+	if finish != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", finish)
+	}
+}
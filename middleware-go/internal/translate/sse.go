@@ -0,0 +1,77 @@
+package translate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// sseDecoder 增量解析SSE流，每收到一个完整事件调用一次onEvent
+type sseDecoder struct {
+	buf     bytes.Buffer
+	event   string
+	data    [][]byte
+	onEvent func(event string, data []byte) error
+}
+
+func (d *sseDecoder) Write(p []byte) (int, error) {
+	d.buf.Write(p)
+	for {
+		line, err := d.buf.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次写入
+			remaining := append([]byte(nil), line...)
+			d.buf.Reset()
+			d.buf.Write(remaining)
+			return len(p), nil
+		}
+		if err := d.line(bytes.TrimRight(line, "\r\n")); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (d *sseDecoder) line(line []byte) error {
+	switch {
+	case len(line) == 0:
+		return d.dispatch()
+	case line[0] == ':':
+		// 注释行（如心跳）
+	case bytes.HasPrefix(line, []byte("event:")):
+		d.event = string(bytes.TrimSpace(line[len("event:"):]))
+	case bytes.HasPrefix(line, []byte("data:")):
+		d.data = append(d.data, bytes.TrimPrefix(line[len("data:"):], []byte(" ")))
+	}
+	return nil
+}
+
+func (d *sseDecoder) dispatch() error {
+	if d.event == "" && len(d.data) == 0 {
+		return nil
+	}
+	event, data := d.event, bytes.Join(d.data, []byte("\n"))
+	d.event, d.data = "", nil
+	return d.onEvent(event, data)
+}
+
+// Close 处理末尾没有空行结束的事件
+func (d *sseDecoder) Close() error {
+	if d.buf.Len() > 0 {
+		if err := d.line(bytes.TrimRight(d.buf.Bytes(), "\r\n")); err != nil {
+			return err
+		}
+		d.buf.Reset()
+	}
+	return d.dispatch()
+}
+
+// writeSSE 写出一个SSE事件，event为空时只写data
+func writeSSE(w io.Writer, event string, data []byte) error {
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
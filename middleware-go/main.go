@@ -1,31 +1,69 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"claude-middleware/internal/auth"
 	"claude-middleware/internal/config"
+	"claude-middleware/internal/metrics"
 	"claude-middleware/internal/proxy"
 	"claude-middleware/internal/redis"
+	"claude-middleware/internal/server"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	// 初始化配置
-	cfg := config.Load()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to YAML/TOML config file")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and exit")
+	flag.Parse()
+
+	// 初始化配置（配置文件 + 环境变量覆盖）
+	configs, err := config.NewManager(*configPath)
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("✅ Configuration is valid")
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("❌ Invalid configuration:\n%v", err)
+	}
+	cfg := configs.Current()
 	
 	// 打印环境变量配置状态
 	log.Println("========================================")
 	log.Println("Claude Middleware Configuration Status")
 	log.Println("========================================")
+	if *configPath != "" {
+		log.Printf("Config File: %s", *configPath)
+	}
 	log.Printf("Server Port: %d", cfg.Server.Port)
 	log.Printf("Server Mode: %s", cfg.Server.Mode)
 	log.Printf("Redis Host: %s", cfg.Redis.Host)
-	log.Printf("Redis Port: %s", cfg.Redis.Port)
+	log.Printf("Redis Port: %d", cfg.Redis.Port)
 	log.Printf("Redis DB: %d", cfg.Redis.DB)
+	if cfg.Redis.URL != "" {
+		log.Printf("Redis URL: (set, overrides host/port/password/db)")
+	}
+	if cfg.Redis.Username != "" {
+		log.Printf("Redis Username: %s", cfg.Redis.Username)
+	}
+	log.Printf("Redis TLS: %v", cfg.Redis.TLS.Enabled || strings.HasPrefix(cfg.Redis.URL, "rediss://"))
+	if len(cfg.Redis.ClusterAddrs) > 0 {
+		log.Printf("Redis Cluster: %v", cfg.Redis.ClusterAddrs)
+	} else if cfg.Redis.SentinelMaster != "" {
+		log.Printf("Redis Sentinel: master=%s sentinels=%v", cfg.Redis.SentinelMaster, cfg.Redis.SentinelAddrs)
+	}
 	log.Printf("Redis Password: %s", func() string {
 		if cfg.Redis.Password == "" {
 			return "(not set)"
@@ -34,22 +72,40 @@ func main() {
 	}())
 	log.Printf("Target URL: %s", cfg.Proxy.TargetURL)
 	log.Printf("Proxy Timeout: %d seconds", cfg.Proxy.Timeout)
+	log.Printf("Upstream Account Header: %s (signed: %v)", cfg.Proxy.AccountHeader, cfg.Proxy.SigningSecret != "")
+	if cfg.Proxy.EgressProxy != "" {
+		egress, _ := url.Parse(cfg.Proxy.EgressProxy)
+		log.Printf("Upstream Egress Proxy: %s", egress.Redacted())
+	}
+	log.Printf("Shared Pools: %v", cfg.SharedPool.Enabled)
+	if cfg.SharedPool.Enabled && cfg.SharedPool.EncryptionKey == "" {
+		log.Printf("⚠️  ENCRYPTION_KEY not set, API keys cannot be resolved to their shared pools")
+	}
 	log.Println("========================================")
 
-	// 初始化Redis连接
+	// 初始化Redis连接（Redis不可用时使用本地账户快照降级启动）
 	log.Println("Connecting to Redis...")
 	redisClient, err := redis.NewClient(cfg.Redis)
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to Redis: %v", err)
+		log.Fatalf("❌ Invalid Redis configuration: %v", err)
+	}
+	if err := redisClient.Ping(); err != nil {
+		log.Printf("⚠️  Redis is unavailable, starting in degraded mode: %v", err)
+	} else {
+		log.Println("✅ Successfully connected to Redis")
 	}
-	log.Println("✅ Successfully connected to Redis")
 	defer redisClient.Close()
 
 	// 初始化代理服务
-	proxyService := proxy.NewService(redisClient, cfg)
+	proxyService := proxy.NewService(redisClient, configs)
 
-	// 初始化认证配置
-	authConfig := auth.NewAuthConfig()
+	// 初始化认证配置（热加载时替换）
+	var currentAuthConfig atomic.Pointer[auth.AuthConfig]
+	authConfig := auth.NewAuthConfig(cfg.Auth)
+	currentAuthConfig.Store(authConfig)
+	configs.OnReload(func(newConfig *config.Config) {
+		currentAuthConfig.Store(auth.NewAuthConfig(newConfig.Auth))
+	})
 	
 	// 打印认证配置状态
 	log.Println("Authentication Configuration:")
@@ -81,21 +137,27 @@ func main() {
 	r.Use(gin.Recovery())
 
 	// 健康检查（不需要认证）
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ok",
-			"service": "claude-middleware",
-		})
-	})
+	r.GET("/health", proxyService.HealthHandler)
+
+	// 监控指标（需要管理Token，指标中包含账户ID）
+	r.GET("/metrics", auth.AdminMiddleware(currentAuthConfig.Load), gin.WrapH(metrics.Handler()))
+
+	// 管理API（需要管理Token）
+	admin := r.Group("/admin")
+	admin.Use(auth.AdminMiddleware(currentAuthConfig.Load))
+	admin.GET("/captures", proxyService.Captures().ListHandler)
+	admin.GET("/captures/:id", proxyService.Captures().GetHandler)
+	admin.DELETE("/captures", proxyService.Captures().ClearHandler)
+	admin.GET("/accounts", proxyService.AccountsHandler)
 
-	// 创建需要认证的路由组
+	// 创建需要认证的路由组（认证中间件始终挂载，以便热加载启用/禁用认证）
 	api := r.Group("/")
 	if authConfig.Enabled {
 		log.Printf("API Key authentication enabled")
-		api.Use(auth.AuthMiddleware(authConfig))
 	} else {
 		log.Printf("API Key authentication disabled")
 	}
+	api.Use(auth.AuthMiddleware(currentAuthConfig.Load))
 
 	// 代理所有请求到Claude API（需要认证）
 	api.Any("/v1/*path", proxyService.ProxyHandler)
@@ -107,8 +169,18 @@ func main() {
 
 	// 启动服务器
 	port := strconv.Itoa(cfg.Server.Port)
+	srv, err := server.New(r, cfg.Server)
+	if err != nil {
+		log.Fatalf("❌ Failed to configure server: %v", err)
+	}
 	log.Println("========================================")
 	log.Printf("🚀 Claude Middleware starting on port %s", port)
+	log.Printf("🔒 TLS: %s", func() string {
+		if !cfg.Server.TLS.Enabled {
+			return "Disabled"
+		}
+		return fmt.Sprintf("Enabled (HTTP/2: %v, client auth: %s)", cfg.Server.HTTP2, cfg.Server.TLS.ClientAuth)
+	}())
 	log.Printf("🎯 Proxying requests to: %s", cfg.Proxy.TargetURL)
 	log.Printf("🔐 Authentication: %s", func() string {
 		if authConfig.Enabled {
@@ -118,7 +190,10 @@ func main() {
 	}())
 	log.Println("========================================")
 
-	if err := r.Run(":" + port); err != nil {
+	// 监听SIGHUP和配置文件变化，热加载配置
+	go configs.Watch()
+
+	if err := server.ListenAndServe(srv); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }